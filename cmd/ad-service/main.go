@@ -2,45 +2,86 @@ package main
 
 import (
 	"ad-tracking-system/internal/api"
+	"ad-tracking-system/internal/archive"
+	"ad-tracking-system/internal/auth"
 	"ad-tracking-system/internal/config"
+	"ad-tracking-system/internal/domain/models"
 	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/events/schema"
+	"ad-tracking-system/internal/health"
+	"ad-tracking-system/internal/jobs"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/messaging"
 	"ad-tracking-system/internal/repository"
-	"ad-tracking-system/pkg/kafka"
+	"ad-tracking-system/internal/tracing"
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"ad-tracking-system/internal/utils/metrics"
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
 func main() {
 	// Load configuration
-	cfg := config.Load()
-
-	// Enable debug mode if DEBUG environment variable is set
-	debugMode := os.Getenv("DEBUG") == "true"
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
 
-	// Initialize structured logging
-	handler := slog.NewJSONHandler(os.Stdout, nil)
-	logger := slog.New(handler)
+	// Initialize structured logging; the logger is passed to every component.
+	// Records carry the request, trace and span IDs of their context, and
+	// secrets are redacted. The level can be changed by reloading the
+	// configuration.
+	var logLevel slog.LevelVar
+	logger, err := logging.New(os.Stdout, logging.Config{
+		Level:     cfg.LogLevel,
+		Format:    cfg.LogFormat,
+		RedactIPs: cfg.LogRedactIPs,
+		LevelVar:  &logLevel,
+	})
+	if err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
 	slog.SetDefault(logger)
+	circuitbreaker.SetFailureThreshold(cfg.CircuitBreakerFailureThreshold)
 
-	if debugMode {
-		logger.Info("Debug mode enabled")
+	// Requests are logged by the router's middleware; gin's own debug output
+	// is not structured
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Log configuration for debugging
-	if debugMode {
-		logger.Info("Loaded configuration", "config", cfg)
+	// Initialize tracing; with the none exporter trace context is still propagated
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: cfg.ServiceName,
+		Exporter:    cfg.TracingExporter,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.Error("Failed to set up tracing", "exporter", cfg.TracingExporter, "error", err)
+		os.Exit(1)
 	}
 
+	// Secrets and the passwords of URLs are redacted
+	logger.Debug("Loaded configuration", "config", cfg)
+
 	// Initialize the database
 	db, err := sql.Open("postgres", cfg.DatabaseURL)
 	if err != nil {
@@ -49,18 +90,22 @@ func main() {
 	}
 	defer db.Close()
 
+	// Startup checks are bounded by the per-operation deadlines too
+	startupCtx, cancelStartup := context.WithTimeout(context.Background(), cfg.DatabaseTimeout)
+	defer cancelStartup()
+
 	// Test database connection
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(startupCtx); err != nil {
 		logger.Error("Failed to ping the database", "error", err)
 		os.Exit(1)
 	}
 	logger.Info("Successfully connected to the database")
 
 	// Initialize repositories
-	adRepo := repository.NewAdRepository(db)
+	adRepo := repository.NewAdRepository(db, logger)
 
-	// Check if the ads table is empty
-	count, err := adRepo.CountAds()
+	// Check if the default tenant has no ads
+	count, err := adRepo.CountAds(startupCtx, models.DefaultTenantID)
 	if err != nil {
 		logger.Error("Failed to count ads", "error", err)
 		os.Exit(1)
@@ -69,11 +114,10 @@ func main() {
 	// Seed the database only if it's empty
 	if count == 0 {
 		logger.Info("Seeding database with dummy ads...")
-		if err := adRepo.Seed(); err != nil {
+		if err := adRepo.Seed(startupCtx, models.DefaultTenantID); err != nil {
 			logger.Error("Failed to seed database", "error", err)
 			os.Exit(1)
 		}
-		logger.Info("Database seeded with 10 dummy ads")
 	} else {
 		logger.Info("Database already contains data, skipping seeding")
 	}
@@ -90,25 +134,185 @@ func main() {
 	}
 	logger.Info("Successfully connected to Redis")
 
+	// Export the connection pool stats of Postgres and Redis
+	prometheus.MustRegister(
+		collectors.NewDBStatsCollector(db, "advertisements"),
+		metrics.NewRedisPoolCollector(redisClient, "main"),
+	)
+
 	// Initialize repositories
-	clickRepo := repository.NewClickRepository(db)
-	analyticsRepo := repository.NewAnalyticsRepository(redisClient)
+	clickRepo := repository.NewClickRepository(db, logger)
+	analyticsRepo := repository.NewAnalyticsRepository(redisClient, logger)
+	rollupRepo := repository.NewRollupRepository(db, logger)
+
+	// Start background jobs; they stop when jobsCtx is cancelled on shutdown
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	var jobsWG sync.WaitGroup
+	startJob := func(name string, run func(context.Context)) {
+		jobsWG.Add(1)
+		go func() {
+			defer jobsWG.Done()
+			run(jobsCtx)
+		}()
+		logger.Info("Background job started", "job", name)
+	}
+
+	archiveStore, err := archive.NewStore(cfg)
+	if err != nil {
+		logger.Error("Failed to create archive store", "error", err)
+		os.Exit(1)
+	}
+	archiver := archive.NewArchiver(clickRepo, archiveStore, logger)
+
+	partitionMaintainer := jobs.NewPartitionMaintainer(repository.NewPartitionRepository(db, logger), archiver, jobs.PartitionMaintenanceConfig{
+		Interval:      cfg.PartitionInterval,
+		Premake:       cfg.PartitionPremake,
+		RetentionDays: cfg.ClickRetentionDays,
+		RetentionMode: cfg.PartitionRetentionMode,
+		RunEvery:      cfg.PartitionMaintenanceInterval,
+	}, logger)
+	startJob("partition-maintenance", partitionMaintainer.Run)
+
+	rollupJob := jobs.NewRollupJob(rollupRepo, cfg.RollupLookback, cfg.RollupInterval, logger)
+	startJob("click-rollup", rollupJob.Run)
 
 	// Initialize services
-	adService := services.NewAdService(adRepo)
-	clickService := services.NewClickService(clickRepo, analyticsRepo)
+	timeouts := services.Timeouts{Database: cfg.DatabaseTimeout, Cache: cfg.RedisTimeout}
+	// Services call their stores through tracing wrappers
+	tracedAnalytics := repository.TraceAnalyticsStore(analyticsRepo)
+	tracedRollups := repository.TraceRollupStore(rollupRepo)
+	auditService := services.NewAuditService(repository.TraceAuditStore(repository.NewAuditRepository(db, logger)), repository.NewTransactor(db), timeouts, logger)
+	tenantService := services.NewTenantService(
+		repository.TraceTenantStore(repository.NewTenantRepository(db, logger)),
+		repository.TraceQuotaStore(repository.NewQuotaRepository(redisClient, logger)),
+		auditService, timeouts, logger)
+	adService := services.NewAdService(repository.TraceAdStore(adRepo), timeouts, logger)
+	clickService := services.NewClickService(repository.TraceClickStore(clickRepo), tracedAnalytics, tracedRollups, tenantService, timeouts, logger)
+	clickService.SetIPClickLimit(cfg.ClickIPLimit)
+	reconciliationService := services.NewReconciliationService(tracedRollups, tracedAnalytics, auditService, timeouts, logger)
 
-	// Initialize Kafka producer
-	kafkaProducer, err := kafka.NewProducer(cfg.KafkaBrokers, cfg.KafkaTopic)
+	reconciliationJob := jobs.NewReconciliationJob(reconciliationService, tenantService, int64(cfg.ReconcileDriftThreshold), cfg.ReconcileAutoRepair, cfg.ReconcileInterval, logger)
+	startJob("counter-reconciliation", reconciliationJob.Run)
+
+	// Initialize the event publisher; only Kafka spools undeliverable events to disk
+	var kafkaSpool *messaging.DiskSpool
+	if cfg.EventBroker == messaging.BrokerKafka {
+		kafkaSpool, err = messaging.NewDiskSpool(cfg.KafkaSpoolDir, int64(cfg.KafkaSpoolSegmentBytes), int64(cfg.KafkaSpoolMaxBytes), logger)
+		if err != nil {
+			logger.Error("Failed to open Kafka spool", "error", err)
+			os.Exit(1)
+		}
+		defer kafkaSpool.Close()
+	}
+
+	eventPublisher, err := messaging.NewPublisher(cfg, redisClient, kafkaSpool, logger)
 	if err != nil {
-		logger.Error("Failed to create Kafka producer", "error", err)
+		logger.Error("Failed to create event publisher", "broker", cfg.EventBroker, "error", err)
 		os.Exit(1)
 	}
-	defer kafkaProducer.Close()
-	logger.Info("Kafka producer initialized")
+	logger.Info("Event publisher initialized", "broker", cfg.EventBroker)
+
+	publisher := messaging.WithPublishMiddleware(eventPublisher,
+		messaging.PublishMetrics(),
+		messaging.PublishTracing(cfg.EventBroker),
+	)
 
-	// Initialize the API router
-	router := api.NewRouter(adService, clickService)
+	// Initialize the schema registry and register the click event schema
+	schemaRegistry, err := schema.NewRegistry(cfg.SchemaRegistryURL, cfg.SchemaRegistryFile)
+	if err != nil {
+		logger.Error("Failed to open schema registry", "error", err)
+		os.Exit(1)
+	}
+	clickSerde, err := schema.NewClickEventSerde(schemaRegistry, cfg.KafkaTopic+"-value")
+	if err != nil {
+		logger.Error("Failed to register click event schema", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("Click event schema registered", "schema_id", clickSerde.SchemaID())
+
+	// Replay messages spooled by this or a previous run
+	if kafkaPublisher, ok := eventPublisher.(*messaging.KafkaPublisher); ok {
+		startJob("kafka-spool-drain", func(ctx context.Context) {
+			kafkaPublisher.Run(ctx, cfg.KafkaSpoolDrainEvery)
+		})
+	}
+
+	outboxRelay := jobs.NewOutboxRelay(repository.NewOutboxRepository(db, logger), publisher, cfg.KafkaTopic, clickSerde, jobs.OutboxRelayConfig{
+		BatchSize:      cfg.OutboxBatchSize,
+		PollInterval:   cfg.OutboxPollInterval,
+		Retention:      cfg.OutboxRetention,
+		PublishTimeout: cfg.PublishTimeout,
+	}, logger)
+	startJob("outbox-relay", outboxRelay.Run)
+
+	// Initialize API key authentication and click signing
+	apiKeyService := services.NewAPIKeyService(repository.TraceAPIKeyStore(repository.NewAPIKeyRepository(db, logger)), cfg.APIKeyRotationGrace, auditService, timeouts, logger)
+
+	clickSigningSecret := []byte(cfg.ClickSigningSecret)
+	if len(clickSigningSecret) == 0 {
+		// Tokens signed by one replica are rejected by the others
+		logger.Warn("CLICK_SIGNING_SECRET is not set, using a random secret; click tokens will not survive a restart or work across replicas")
+		clickSigningSecret = make([]byte, 32)
+		if _, err := rand.Read(clickSigningSecret); err != nil {
+			logger.Error("Failed to generate click signing secret", "error", err)
+			os.Exit(1)
+		}
+	}
+	clickSigner := auth.NewClickSigner(clickSigningSecret, cfg.ClickTokenTTL)
+
+	// Accept the identity provider's bearer tokens when a JWKS is configured
+	var oidcVerifier *auth.OIDCVerifier
+	if cfg.OIDCJWKSURL != "" {
+		if cfg.OIDCIssuer == "" {
+			logger.Error("OIDC_ISSUER is required with OIDC_JWKS_URL")
+			os.Exit(1)
+		}
+		roleMap, err := auth.ParseRoleMap(cfg.OIDCRoleMap)
+		if err != nil {
+			logger.Error("Invalid OIDC_ROLE_MAP", "error", err)
+			os.Exit(1)
+		}
+		jwks := auth.NewJWKS(cfg.OIDCJWKSURL, cfg.OIDCJWKSRefresh, logger)
+		loadCtx, cancelLoad := context.WithTimeout(context.Background(), 10*time.Second)
+		err = jwks.Load(loadCtx)
+		cancelLoad()
+		if err != nil {
+			logger.Error("Failed to load OIDC signing keys", "source", cfg.OIDCJWKSURL, "error", err)
+			os.Exit(1)
+		}
+		oidcVerifier = auth.NewOIDCVerifier(jwks, auth.OIDCConfig{
+			Issuer:      cfg.OIDCIssuer,
+			Audience:    cfg.OIDCAudience,
+			RolesClaim:  cfg.OIDCRolesClaim,
+			RoleMap:     roleMap,
+			TenantClaim: cfg.OIDCTenantClaim,
+		})
+		logger.Info("OIDC bearer tokens enabled", "issuer", cfg.OIDCIssuer, "jwks", cfg.OIDCJWKSURL)
+	}
+
+	// Readiness checks of the dependencies served at /readyz
+	healthChecker := health.NewChecker(cfg.HealthCheckTimeout)
+	healthChecker.Add("postgres", db.PingContext)
+	healthChecker.Add("redis", func(ctx context.Context) error {
+		return redisClient.Ping(ctx).Err()
+	})
+	if pinger, ok := eventPublisher.(messaging.Pinger); ok {
+		// Clicks reach the broker through the outbox, so an outage delays events
+		// rather than failing requests and must not take every replica out
+		healthChecker.AddInformational(cfg.EventBroker, pinger.Ping)
+	}
+
+	// Initialize the public API router, and the router of the internal
+	// endpoints served on the metrics port
+	router := api.NewRouter(adService, clickService, apiKeyService, tenantService, clickSigner, oidcVerifier, logger)
+	internalRouter := api.NewInternalRouter(reconciliationService, apiKeyService, tenantService, auditService, oidcVerifier, healthChecker, logger)
+
+	// Request contexts derive from serverCtx, which is cancelled once shutdown
+	// gives up waiting so that requests still running abandon their work
+	serverCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	// Create HTTP server with timeouts
 	server := &http.Server{
@@ -116,9 +320,19 @@ func main() {
 		Handler:      router,
 		ReadTimeout:  cfg.ReadTimeout,
 		WriteTimeout: cfg.WriteTimeout,
+		BaseContext:  func(net.Listener) context.Context { return serverCtx },
 	}
 
-	// Start the HTTP server in a goroutine
+	// The internal server has no write timeout so that CPU profiles and
+	// traces can run for longer than a request may
+	internalServer := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.MetricsPort),
+		Handler:           internalRouter,
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		BaseContext:       func(net.Listener) context.Context { return serverCtx },
+	}
+
+	// Start the HTTP servers in goroutines
 	go func() {
 		logger.Info("Starting HTTP server", "port", cfg.HTTPPort)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -126,6 +340,24 @@ func main() {
 			os.Exit(1)
 		}
 	}()
+	go func() {
+		logger.Info("Starting internal HTTP server", "port", cfg.MetricsPort)
+		if err := internalServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Internal HTTP server error", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Apply the reloadable settings of the configuration on SIGHUP; the
+	// others need a restart
+	startJob("config-reload", func(ctx context.Context) {
+		config.Watch(ctx, cfg, logger, func(reloaded *config.Config) {
+			// The level was validated by config.Load
+			_ = logLevel.UnmarshalText([]byte(reloaded.LogLevel))
+			circuitbreaker.SetFailureThreshold(reloaded.CircuitBreakerFailureThreshold)
+			clickService.SetIPClickLimit(reloaded.ClickIPLimit)
+		})
+	})
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -133,21 +365,37 @@ func main() {
 	<-quit
 	logger.Info("Shutting down server...")
 
+	// Report not ready and give load balancers time to notice before the
+	// server stops accepting connections
+	healthChecker.ShutDown()
+	logger.Info("Draining before shutdown", "delay", cfg.ShutdownDrainDelay)
+	time.Sleep(cfg.ShutdownDrainDelay)
+
 	// Create a context with a timeout for shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Shutdown the HTTP server
+	// Shutdown the HTTP servers. The internal one stops last, so that /readyz
+	// keeps reporting the shutdown while the public one drains.
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("HTTP server shutdown error", "error", err)
 	}
-	logger.Info("HTTP server stopped")
+	if err := internalServer.Shutdown(ctx); err != nil {
+		logger.Error("Internal HTTP server shutdown error", "error", err)
+	}
+	cancelRequests()
+	logger.Info("HTTP servers stopped")
+
+	// Stop background jobs and wait for them to finish
+	cancelJobs()
+	jobsWG.Wait()
+	logger.Info("Background jobs stopped")
 
-	// Close Kafka producer
-	if err := kafkaProducer.Close(); err != nil {
-		logger.Error("Kafka producer shutdown error", "error", err)
+	// Close the event publisher
+	if err := publisher.Close(); err != nil {
+		logger.Error("Event publisher shutdown error", "error", err)
 	}
-	logger.Info("Kafka producer stopped")
+	logger.Info("Event publisher stopped")
 
 	// Close Redis connection
 	if err := redisClient.Close(); err != nil {
@@ -161,5 +409,12 @@ func main() {
 	}
 	logger.Info("Database connection closed")
 
+	// Flush the spans still buffered
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		logger.Error("Tracing shutdown error", "error", err)
+	}
+
 	logger.Info("Server shutdown complete")
-}
\ No newline at end of file
+}
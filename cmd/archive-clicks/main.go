@@ -0,0 +1,85 @@
+package main
+
+import (
+	"ad-tracking-system/internal/archive"
+	"ad-tracking-system/internal/config"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"database/sql"
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	from := flag.String("from", "", "start of the range to archive, inclusive (YYYY-MM-DD)")
+	to := flag.String("to", "", "end of the range to archive, exclusive (YYYY-MM-DD)")
+	deleteAfter := flag.Bool("delete", false, "delete the archived clicks from the database once the archive is verified")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stdout, logging.Config{Level: cfg.LogLevel, Format: cfg.LogFormat, RedactIPs: cfg.LogRedactIPs})
+	if err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	fromTime, err := time.Parse("2006-01-02", *from)
+	if err != nil {
+		logger.Error("Invalid -from date", "error", err)
+		os.Exit(2)
+	}
+	toTime, err := time.Parse("2006-01-02", *to)
+	if err != nil {
+		logger.Error("Invalid -to date", "error", err)
+		os.Exit(2)
+	}
+	if !toTime.After(fromTime) {
+		logger.Error("-to must be after -from")
+		os.Exit(2)
+	}
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		logger.Error("Failed to connect to the database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	store, err := archive.NewStore(cfg)
+	if err != nil {
+		logger.Error("Failed to create archive store", "error", err)
+		os.Exit(1)
+	}
+	archiver := archive.NewArchiver(repository.NewClickRepository(db, logger), store, logger)
+
+	ctx := context.Background()
+	var manifest *archive.Manifest
+	if *deleteAfter {
+		manifest, err = archiver.ArchiveAndDelete(ctx, fromTime, toTime)
+	} else {
+		manifest, err = archiver.Archive(ctx, fromTime, toTime)
+	}
+	if err != nil {
+		logger.Error("Archival failed", "error", err)
+		os.Exit(1)
+	}
+
+	logger.Info("Archival complete",
+		"object", manifest.Object,
+		"rows", manifest.RowCount,
+		"bytes", manifest.Bytes,
+		"sha256", manifest.SHA256,
+		"deleted", *deleteAfter,
+	)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"ad-tracking-system/internal/config"
+	"ad-tracking-system/internal/events/aggregator"
+	"ad-tracking-system/internal/events/schema"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"ad-tracking-system/internal/tracing"
+	"context"
+	"database/sql"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq"
+)
+
+// runner is an aggregator or a sink
+type runner interface {
+	Run(ctx context.Context) error
+	Close() error
+}
+
+func main() {
+	mode := flag.String("mode", "aggregate", "aggregate, postgres-sink or redis-sink")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stdout, logging.Config{Level: cfg.LogLevel, Format: cfg.LogFormat, RedactIPs: cfg.LogRedactIPs})
+	if err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: "click-aggregator-" + *mode,
+		Exporter:    cfg.TracingExporter,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.Error("Failed to set up tracing", "exporter", cfg.TracingExporter, "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("Tracing shutdown error", "error", err)
+		}
+	}()
+
+	var r runner
+	switch *mode {
+	case "aggregate":
+		registry, err := schema.NewRegistry(cfg.SchemaRegistryURL, cfg.SchemaRegistryFile)
+		if err != nil {
+			logger.Error("Failed to open schema registry", "error", err)
+			os.Exit(1)
+		}
+		serde, err := schema.NewClickEventSerde(registry, cfg.KafkaTopic+"-value")
+		if err != nil {
+			logger.Error("Failed to register click event schema", "error", err)
+			os.Exit(1)
+		}
+		r, err = aggregator.New(aggregator.Config{
+			Brokers:        cfg.KafkaBrokers,
+			GroupID:        cfg.AggregatorGroupID,
+			ClickTopic:     cfg.KafkaTopic,
+			AggregateTopic: cfg.KafkaAggregateTopic,
+			Window:         cfg.AggregateWindow,
+			FlushInterval:  cfg.AggregateFlushInterval,
+			MaxBatch:       cfg.AggregateMaxBatch,
+		}, serde, logger)
+		if err != nil {
+			logger.Error("Failed to create click aggregator", "error", err)
+			os.Exit(1)
+		}
+
+	case "postgres-sink":
+		db, err := sql.Open("postgres", cfg.DatabaseURL)
+		if err != nil {
+			logger.Error("Failed to connect to the database", "error", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		r, err = aggregator.NewSink("postgres", cfg.KafkaBrokers, cfg.AggregatorGroupID+"-postgres-sink", cfg.KafkaAggregateTopic,
+			repository.NewAggregateRepository(db, logger).Apply, logger)
+		if err != nil {
+			logger.Error("Failed to create Postgres sink", "error", err)
+			os.Exit(1)
+		}
+
+	case "redis-sink":
+		redisClient := redis.NewClient(&redis.Options{
+			Addr: cfg.RedisURL,
+		})
+		defer redisClient.Close()
+		var err error
+		r, err = aggregator.NewSink("redis", cfg.KafkaBrokers, cfg.AggregatorGroupID+"-redis-sink", cfg.KafkaAggregateTopic,
+			repository.NewAnalyticsRepository(redisClient, logger).ApplyAggregateBatch, logger)
+		if err != nil {
+			logger.Error("Failed to create Redis sink", "error", err)
+			os.Exit(1)
+		}
+
+	default:
+		logger.Error("Unknown mode", "mode", *mode)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("Starting click aggregator", "mode", *mode)
+	if err := r.Run(ctx); err != nil {
+		logger.Error("Click aggregator failed", "error", err)
+	}
+	if err := r.Close(); err != nil {
+		logger.Error("Click aggregator shutdown error", "error", err)
+	}
+	logger.Info("Click aggregator stopped")
+}
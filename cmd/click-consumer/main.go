@@ -0,0 +1,138 @@
+package main
+
+import (
+	"ad-tracking-system/internal/config"
+	"ad-tracking-system/internal/events/handlers"
+	"ad-tracking-system/internal/events/schema"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/messaging"
+	"ad-tracking-system/internal/repository"
+	"ad-tracking-system/internal/tracing"
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler retries before a failure is reported to the subscriber, which
+// redelivers the message
+const (
+	handlerAttempts = 3
+	handlerBackoff  = 100 * time.Millisecond
+)
+
+func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stdout, logging.Config{Level: cfg.LogLevel, Format: cfg.LogFormat, RedactIPs: cfg.LogRedactIPs})
+	if err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+	circuitbreaker.SetFailureThreshold(cfg.CircuitBreakerFailureThreshold)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		ServiceName: "click-consumer",
+		Exporter:    cfg.TracingExporter,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		logger.Error("Failed to set up tracing", "exporter", cfg.TracingExporter, "error", err)
+		os.Exit(1)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("Tracing shutdown error", "error", err)
+		}
+	}()
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		logger.Error("Failed to connect to the database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	registry, err := schema.NewRegistry(cfg.SchemaRegistryURL, cfg.SchemaRegistryFile)
+	if err != nil {
+		logger.Error("Failed to open schema registry", "error", err)
+		os.Exit(1)
+	}
+	serde, err := schema.NewClickEventSerde(registry, cfg.KafkaTopic+"-value")
+	if err != nil {
+		logger.Error("Failed to register click event schema", "error", err)
+		os.Exit(1)
+	}
+
+	// Only Redis Streams needs a Redis client
+	var redisClient *redis.Client
+	if cfg.EventBroker == messaging.BrokerRedis {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr: cfg.RedisURL,
+		})
+		defer redisClient.Close()
+	}
+
+	subscriber, err := messaging.NewSubscriber(cfg, redisClient, logger)
+	if err != nil {
+		logger.Error("Failed to create event subscriber", "broker", cfg.EventBroker, "error", err)
+		os.Exit(1)
+	}
+
+	handler := messaging.WithHandlerMiddleware(handlers.NewClickHandler(serde, repository.NewClickRepository(db, logger), logger),
+		messaging.HandlerTracing(cfg.EventBroker),
+		messaging.HandlerMetrics(),
+		messaging.HandlerRetry(handlerAttempts, handlerBackoff),
+	)
+
+	// Metrics, including the consumer lag and latency, are served on the metrics port
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	metricsServer := &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.MetricsPort),
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.ReadTimeout,
+	}
+	go func() {
+		logger.Info("Starting metrics server", "port", cfg.MetricsPort)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Metrics server error", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("Starting click consumer", "broker", cfg.EventBroker, "topic", cfg.KafkaTopic, "group", cfg.EventConsumerGroup)
+	if err := subscriber.Subscribe(ctx, cfg.KafkaTopic, handler); err != nil {
+		logger.Error("Click consumer failed", "error", err)
+	}
+	if err := subscriber.Close(); err != nil {
+		logger.Error("Event subscriber shutdown error", "error", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Metrics server shutdown error", "error", err)
+	}
+	logger.Info("Click consumer stopped")
+}
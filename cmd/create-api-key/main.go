@@ -0,0 +1,71 @@
+package main
+
+import (
+	"ad-tracking-system/internal/config"
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"strings"
+
+	_ "github.com/lib/pq"
+)
+
+// create-api-key issues an API key directly in the database, for instance the
+// first admin key, which is needed before keys can be managed over the API
+func main() {
+	tenant := flag.String("tenant", models.DefaultTenantID, "tenant the key belongs to")
+	name := flag.String("name", "", "name of the key, e.g. the team or service using it")
+	scopes := flag.String("scopes", "", "comma-separated scopes: ads:read, clicks:write, analytics:read, admin")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stderr, logging.Config{Level: cfg.LogLevel, Format: cfg.LogFormat, RedactIPs: cfg.LogRedactIPs})
+	if err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	if *name == "" || *scopes == "" {
+		logger.Error("-name and -scopes are required")
+		os.Exit(2)
+	}
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		logger.Error("Failed to connect to the database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	timeouts := services.Timeouts{Database: cfg.DatabaseTimeout}
+	auditService := services.NewAuditService(repository.NewAuditRepository(db, logger), repository.NewTransactor(db), timeouts, logger)
+	apiKeyService := services.NewAPIKeyService(repository.NewAPIKeyRepository(db, logger), cfg.APIKeyRotationGrace, auditService, timeouts, logger)
+
+	ctx := services.WithActor(context.Background(), services.CommandActor())
+	key, secret, err := apiKeyService.Create(ctx, *tenant, *name, strings.Split(*scopes, ","))
+	if err != nil {
+		logger.Error("Failed to create API key", "error", err)
+		os.Exit(1)
+	}
+
+	// Print the key on stdout; it is not stored and cannot be shown again
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(map[string]interface{}{"key": secret, "api_key": key}); err != nil {
+		logger.Error("Failed to write key", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"ad-tracking-system/internal/config"
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+
+	_ "github.com/lib/pq"
+)
+
+// create-tenant adds a tenant with its quotas. Its first admin key can then be
+// issued with create-api-key -tenant.
+func main() {
+	id := flag.String("id", "", "tenant ID: lowercase letters, digits, '-' or '_'")
+	name := flag.String("name", "", "display name of the tenant")
+	requestsPerMinute := flag.Int("requests-per-minute", 0, "API requests allowed per minute, 0 for unlimited")
+	clicksPerDay := flag.Int64("clicks-per-day", 0, "clicks recorded per UTC day, 0 for unlimited")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stderr, logging.Config{Level: cfg.LogLevel, Format: cfg.LogFormat, RedactIPs: cfg.LogRedactIPs})
+	if err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	if *id == "" || *name == "" {
+		logger.Error("-id and -name are required")
+		os.Exit(2)
+	}
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		logger.Error("Failed to connect to the database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	// Quotas are only enforced by the ad service, so no quota store is needed here
+	timeouts := services.Timeouts{Database: cfg.DatabaseTimeout}
+	auditService := services.NewAuditService(repository.NewAuditRepository(db, logger), repository.NewTransactor(db), timeouts, logger)
+	tenantService := services.NewTenantService(repository.NewTenantRepository(db, logger), nil, auditService, timeouts, logger)
+
+	tenant := &models.Tenant{ID: *id, Name: *name, RequestsPerMinute: *requestsPerMinute, ClicksPerDay: *clicksPerDay}
+	ctx := services.WithActor(context.Background(), services.CommandActor())
+	if err := tenantService.Create(ctx, tenant); err != nil {
+		logger.Error("Failed to create tenant", "error", err)
+		os.Exit(1)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(tenant); err != nil {
+		logger.Error("Failed to write tenant", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"ad-tracking-system/internal/config"
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-redis/redis/v8"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	tenant := flag.String("tenant", models.DefaultTenantID, "tenant whose counters to reconcile")
+	dryRun := flag.Bool("dry-run", false, "only report drifted counters, do not rewrite them")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stderr, logging.Config{Level: cfg.LogLevel, Format: cfg.LogFormat, RedactIPs: cfg.LogRedactIPs})
+	if err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		logger.Error("Failed to connect to the database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	redisClient := redis.NewClient(&redis.Options{
+		Addr: cfg.RedisURL,
+	})
+	defer redisClient.Close()
+	if _, err := redisClient.Ping(ctx).Result(); err != nil {
+		logger.Error("Failed to connect to Redis", "error", err)
+		os.Exit(1)
+	}
+
+	timeouts := services.Timeouts{Database: cfg.DatabaseTimeout, Cache: cfg.RedisTimeout}
+	reconciliationService := services.NewReconciliationService(
+		repository.NewRollupRepository(db, logger),
+		repository.NewAnalyticsRepository(redisClient, logger),
+		services.NewAuditService(repository.NewAuditRepository(db, logger), repository.NewTransactor(db), timeouts, logger),
+		timeouts,
+		logger,
+	)
+
+	ctx = services.WithActor(ctx, services.CommandActor())
+	report, err := reconciliationService.Reconcile(ctx, *tenant, *dryRun)
+	if err != nil {
+		logger.Error("Reconciliation failed", "error", err)
+		os.Exit(1)
+	}
+
+	// Print the report on stdout so it can be piped into jq
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		logger.Error("Failed to write report", "error", err)
+		os.Exit(1)
+	}
+}
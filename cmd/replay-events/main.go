@@ -0,0 +1,156 @@
+package main
+
+import (
+	"ad-tracking-system/internal/config"
+	"ad-tracking-system/internal/events/handlers"
+	"ad-tracking-system/internal/events/replay"
+	"ad-tracking-system/internal/events/schema"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/messaging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	topic := flag.String("topic", "", "topic to replay (default KAFKA_TOPIC)")
+	from := flag.String("from", "", "replay messages published at or after this time (RFC 3339)")
+	to := flag.String("to", "", "replay messages published before this time (RFC 3339, default now)")
+	handlerName := flag.String("handler", "click", "handler to replay messages through: click")
+	target := flag.String("target", "scratch", "where handlers write: live or scratch")
+	scratchSchema := flag.String("scratch-schema", "replay", "schema used with -target scratch")
+	allowDuplicates := flag.Bool("allow-duplicates", false, "allow -target live, which inserts clicks already stored for the range again")
+	dryRun := flag.Bool("dry-run", false, "decode messages and report counts without writing anything")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	logger, err := logging.New(os.Stderr, logging.Config{Level: cfg.LogLevel, Format: cfg.LogFormat, RedactIPs: cfg.LogRedactIPs})
+	if err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
+	fromTime, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		logger.Error("Invalid -from time", "error", err)
+		os.Exit(2)
+	}
+	toTime := time.Now()
+	if *to != "" {
+		if toTime, err = time.Parse(time.RFC3339, *to); err != nil {
+			logger.Error("Invalid -to time", "error", err)
+			os.Exit(2)
+		}
+	}
+	if *target != "live" && *target != "scratch" {
+		logger.Error("-target must be live or scratch")
+		os.Exit(2)
+	}
+	// Clicks have no ID to deduplicate on, so every replayed click the live
+	// consumer already stored would be counted twice
+	if *target == "live" && !*dryRun && !*allowDuplicates {
+		logger.Error("-target live inserts clicks already stored for the range again; delete them first and pass -allow-duplicates")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *topic == "" {
+		*topic = cfg.KafkaTopic
+	}
+
+	registry, err := schema.NewRegistry(cfg.SchemaRegistryURL, cfg.SchemaRegistryFile)
+	if err != nil {
+		logger.Error("Failed to open schema registry", "error", err)
+		os.Exit(1)
+	}
+	serde, err := schema.NewClickEventSerde(registry, *topic+"-value")
+	if err != nil {
+		logger.Error("Failed to register click event schema", "error", err)
+		os.Exit(1)
+	}
+
+	var handler messaging.Handler
+	switch *handlerName {
+	case "click":
+		if *dryRun {
+			handler = func(ctx context.Context, envelope *messaging.Envelope) error {
+				_, err := serde.Decode(envelope.Value)
+				return err
+			}
+			break
+		}
+
+		db, err := openDatabase(ctx, cfg.DatabaseURL, *target, *scratchSchema)
+		if err != nil {
+			logger.Error("Failed to open the database", "error", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+
+		handler = handlers.NewClickHandler(serde, repository.NewClickRepository(db, logger), logger)
+	default:
+		logger.Error("Unknown handler", "handler", *handlerName)
+		os.Exit(2)
+	}
+
+	replayer, err := replay.New(cfg.KafkaBrokers, logger)
+	if err != nil {
+		logger.Error("Failed to connect to Kafka", "error", err)
+		os.Exit(1)
+	}
+	defer replayer.Close()
+
+	logger.Info("Replaying events", "topic", *topic, "from", fromTime, "to", toTime, "handler", *handlerName, "target", *target, "dry_run", *dryRun)
+	report, err := replayer.Replay(ctx, *topic, fromTime, toTime, handler)
+
+	// Print the report on stdout so it can be piped into jq, even after a failure
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+
+	if err != nil {
+		logger.Error("Replay failed", "error", err)
+		os.Exit(1)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// openDatabase connects to the live tables, or to a scratch schema it creates first
+func openDatabase(ctx context.Context, databaseURL, target, scratchSchema string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if target == "live" {
+		return db, nil
+	}
+
+	defer db.Close()
+	if err := repository.CreateScratchSchema(ctx, db, scratchSchema); err != nil {
+		return nil, err
+	}
+	scratchURL, err := repository.ScratchDatabaseURL(databaseURL, scratchSchema)
+	if err != nil {
+		return nil, err
+	}
+	return sql.Open("postgres", scratchURL)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"ad-tracking-system/internal/api/middleware"
+	"ad-tracking-system/internal/domain/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReconcileCounters recomputes the tenant's Redis click counters from Postgres.
+// With ?dry_run=true it only reports the drift.
+func ReconcileCounters(reconciliationService *services.ReconciliationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun := false
+		if v := c.Query("dry_run"); v != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be a boolean"})
+				return
+			}
+		}
+
+		report, err := reconciliationService.Reconcile(c.Request.Context(), middleware.TenantID(c), dryRun)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile click counters"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -1,19 +1,36 @@
 package handlers
 
 import (
+	"ad-tracking-system/internal/api/middleware"
+	"ad-tracking-system/internal/auth"
+	"ad-tracking-system/internal/domain/models"
 	"ad-tracking-system/internal/domain/services"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetAds fetches all ads
-func GetAds(c *gin.Context, adService *services.AdService) {
-	ads, err := adService.GetAllAds()
+// signedAd is an ad with the token clients need to record clicks on it
+type signedAd struct {
+	models.Ad
+	ClickToken string `json:"click_token"`
+}
+
+// GetAds fetches all ads of the caller's tenant
+func GetAds(c *gin.Context, adService *services.AdService, signer *auth.ClickSigner) {
+	tenantID := middleware.TenantID(c)
+	ads, err := adService.GetAllAds(c.Request.Context(), tenantID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ads"})
 		return
 	}
 
-	c.JSON(http.StatusOK, ads)
+	now := time.Now()
+	signed := make([]signedAd, len(ads))
+	for i, ad := range ads {
+		signed[i] = signedAd{Ad: ad, ClickToken: signer.Sign(tenantID, ad.ID, now)}
+	}
+
+	c.JSON(http.StatusOK, signed)
 }
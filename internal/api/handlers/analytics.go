@@ -1,15 +1,18 @@
 package handlers
 
 import (
+	"ad-tracking-system/internal/api/middleware"
 	"ad-tracking-system/internal/domain/services"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetAnalytics returns analytics for a specific ad
+// GetAnalytics returns analytics for a specific ad of the caller's tenant
 func GetAnalytics(analyticsService *services.ClickService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		tenantID := middleware.TenantID(c)
 		adID := c.Query("ad_id")
 		if adID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "ad_id is required"})
@@ -17,7 +20,7 @@ func GetAnalytics(analyticsService *services.ClickService) gin.HandlerFunc {
 		}
 
 		// Check if the adID exists
-		adExists, err := analyticsService.AdExists(adID)
+		adExists, err := analyticsService.AdExists(c.Request.Context(), tenantID, adID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check if ad exists"})
 			return
@@ -26,8 +29,14 @@ func GetAnalytics(analyticsService *services.ClickService) gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "ad not found"})
 			return
 		}
+		// Return a time series from the rollups when a granularity is requested
+		if granularity := c.Query("granularity"); granularity != "" {
+			getClickSeries(c, analyticsService, tenantID, adID, granularity)
+			return
+		}
+
 		// Get the click count for the ad
-		count, err := analyticsService.GetClickCount(adID)
+		count, err := analyticsService.GetClickCount(c.Request.Context(), tenantID, adID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
 			return
@@ -36,3 +45,36 @@ func GetAnalytics(analyticsService *services.ClickService) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"ad_id": adID, "click_count": count})
 	}
 }
+
+// getClickSeries responds with the hourly or daily click counts of an ad between
+// the optional from and to query parameters (RFC 3339, default the last 24 hours)
+func getClickSeries(c *gin.Context, analyticsService *services.ClickService, tenantID, adID, granularity string) {
+	if granularity != "hour" && granularity != "day" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity must be hour or day"})
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+
+	series, err := analyticsService.GetClickSeries(c.Request.Context(), tenantID, adID, granularity, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analytics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ad_id": adID, "granularity": granularity, "from": from, "to": to, "clicks": series})
+}
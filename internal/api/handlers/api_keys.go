@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"ad-tracking-system/internal/api/middleware"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/repository"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+// CreateAPIKey issues a new API key of the caller's tenant. The key is only ever
+// shown in this response.
+func CreateAPIKey(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req createAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name and scopes are required"})
+			return
+		}
+
+		key, secret, err := apiKeyService.Create(c.Request.Context(), middleware.TenantID(c), req.Name, req.Scopes)
+		if errors.Is(err, services.ErrInvalidScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"key": secret, "api_key": key})
+	}
+}
+
+// ListAPIKeys lists all API keys of the caller's tenant, without the keys themselves
+func ListAPIKeys(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := apiKeyService.List(c.Request.Context(), middleware.TenantID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+// RotateAPIKey replaces an API key; the old key keeps working for the rotation grace period
+func RotateAPIKey(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id must be an integer"})
+			return
+		}
+
+		key, secret, err := apiKeyService.Rotate(c.Request.Context(), middleware.TenantID(c), id)
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found, revoked or expired"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate API key"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"key": secret, "api_key": key})
+	}
+}
+
+// RevokeAPIKey revokes an API key immediately
+func RevokeAPIKey(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "id must be an integer"})
+			return
+		}
+
+		err = apiKeyService.Revoke(c.Request.Context(), middleware.TenantID(c), id)
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
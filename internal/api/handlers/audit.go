@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"ad-tracking-system/internal/api/middleware"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/repository"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAuditEvents returns the caller's tenant's audit events, newest first,
+// filtered by the optional entity_type, entity_id, actor, from and to (RFC 3339)
+// and limit query parameters
+func ListAuditEvents(auditService *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := repository.AuditFilter{
+			TenantID:   middleware.TenantID(c),
+			EntityType: c.Query("entity_type"),
+			EntityID:   c.Query("entity_id"),
+			Actor:      c.Query("actor"),
+		}
+		var err error
+		if v := c.Query("from"); v != "" {
+			if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp"})
+				return
+			}
+		}
+		if v := c.Query("to"); v != "" {
+			if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp"})
+				return
+			}
+		}
+		if v := c.Query("limit"); v != "" {
+			if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+		}
+
+		events, err := auditService.List(c.Request.Context(), filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list audit events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, events)
+	}
+}
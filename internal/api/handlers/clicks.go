@@ -1,31 +1,69 @@
 package handlers
 
 import (
+	"ad-tracking-system/internal/api/middleware"
+	"ad-tracking-system/internal/auth"
 	"ad-tracking-system/internal/domain/models"
 	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/utils/metrics"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// RecordClick records a click event
-func RecordClick(c *gin.Context, clickService *services.ClickService) {
-	var click models.ClickEvent
-	if err := c.ShouldBindJSON(&click); err != nil {
+// clickRequest is a click event with the token served with the ad
+type clickRequest struct {
+	models.ClickEvent
+	ClickToken string `json:"click_token"`
+}
+
+// RecordClick records a click event. Anonymous clients must send the click token
+// served with the ad, which also names the tenant; callers with a clicks:write
+// API key don't need one and record clicks for their own tenant.
+func RecordClick(c *gin.Context, clickService *services.ClickService, signer *auth.ClickSigner) {
+	var req clickRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		metrics.ClickEventsTotal.WithLabelValues(metrics.ClickRejectedValidation).Inc()
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	click := req.ClickEvent
+
+	if key := middleware.APIKey(c); key != nil && key.HasScope(auth.ScopeClicksWrite) {
+		click.TenantID = key.TenantID
+	} else {
+		tenantID, err := signer.Verify(click.AdID, req.ClickToken, time.Now())
+		if err != nil {
+			metrics.ClickEventsTotal.WithLabelValues(metrics.ClickRejectedValidation).Inc()
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired click token"})
+			return
+		}
+		click.TenantID = tenantID
+	}
 
 	// Set the timestamp to the current time
 	click.Timestamp = time.Now()
 	click.IP = c.ClientIP()
 
 	// Record the click event
-	if err := clickService.RecordClick(click); err != nil {
+	err := clickService.RecordClick(c.Request.Context(), click)
+	switch {
+	case err == nil:
+		metrics.ClickEventsTotal.WithLabelValues(metrics.ClickAccepted).Inc()
+		c.JSON(http.StatusOK, gin.H{"status": "Click recorded"})
+	case errors.Is(err, services.ErrInvalidClick):
+		metrics.ClickEventsTotal.WithLabelValues(metrics.ClickRejectedValidation).Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrQuotaExceeded):
+		metrics.ClickEventsTotal.WithLabelValues(metrics.ClickRateLimited).Inc()
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Daily click quota exceeded"})
+	case errors.Is(err, services.ErrSuspectedFraud):
+		metrics.ClickEventsTotal.WithLabelValues(metrics.ClickFraud).Inc()
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many clicks from this IP"})
+	default:
+		metrics.ClickEventsTotal.WithLabelValues(metrics.ClickError).Inc()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record click"})
-		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{"status": "Click recorded"})
 }
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"ad-tracking-system/internal/auth"
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newClickRouter serves RecordClick for the ads seeded for acme, whose daily
+// click quota is clicksPerDay, allowing ipClickLimit clicks an hour per IP
+func newClickRouter(t *testing.T, clicksPerDay int64, ipClickLimit int) (*gin.Engine, *auth.ClickSigner) {
+	t.Helper()
+	ads := repository.NewMemoryAdRepository()
+	if err := ads.Seed(context.Background(), "acme"); err != nil {
+		t.Fatal(err)
+	}
+	clicks := repository.NewMemoryClickRepository(ads)
+	tenants := services.NewTenantService(
+		repository.NewMemoryTenantRepository(models.Tenant{ID: "acme", Name: "Acme", ClicksPerDay: clicksPerDay}),
+		repository.NewMemoryQuotaRepository(),
+		nil,
+		services.Timeouts{},
+		logging.Discard(),
+	)
+	clickService := services.NewClickService(clicks, repository.NewMemoryAnalyticsRepository(), clicks, tenants, services.Timeouts{}, logging.Discard())
+	clickService.SetIPClickLimit(ipClickLimit)
+	signer := auth.NewClickSigner([]byte("secret"), time.Hour)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/ads/click", func(c *gin.Context) {
+		RecordClick(c, clickService, signer)
+	})
+	return router, signer
+}
+
+func postClick(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/ads/click", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRecordClickStatusCodes(t *testing.T) {
+	router, signer := newClickRouter(t, 0, 30)
+	token := signer.Sign("acme", "1", time.Now())
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"valid click", `{"ad_id":"1","playback_time":42,"click_token":"` + token + `"}`, http.StatusOK},
+		{"malformed JSON", `{"ad_id":`, http.StatusBadRequest},
+		{"invalid playback time", `{"ad_id":"1","playback_time":-1,"click_token":"` + token + `"}`, http.StatusBadRequest},
+		{"unknown ad", `{"ad_id":"404","playback_time":42,"click_token":"` + signer.Sign("acme", "404", time.Now()) + `"}`, http.StatusBadRequest},
+		{"token of another ad", `{"ad_id":"2","playback_time":42,"click_token":"` + token + `"}`, http.StatusForbidden},
+		{"no token", `{"ad_id":"1","playback_time":42}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postClick(router, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestRecordClickTooManyRequests(t *testing.T) {
+	tests := []struct {
+		name         string
+		clicksPerDay int64
+		ipClickLimit int
+		allowed      int
+	}{
+		// The per-IP limit refuses clicks once an IP has more than the limit
+		{"per-IP limit", 0, 1, 2},
+		{"daily quota", 2, 30, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, signer := newClickRouter(t, tt.clicksPerDay, tt.ipClickLimit)
+			body := `{"ad_id":"1","playback_time":42,"click_token":"` + signer.Sign("acme", "1", time.Now()) + `"}`
+			for i := 1; i <= tt.allowed; i++ {
+				if w := postClick(router, body); w.Code != http.StatusOK {
+					t.Fatalf("click %d: status = %d, want %d: %s", i, w.Code, http.StatusOK, w.Body)
+				}
+			}
+			if w := postClick(router, body); w.Code != http.StatusTooManyRequests {
+				t.Errorf("status = %d, want %d: %s", w.Code, http.StatusTooManyRequests, w.Body)
+			}
+		})
+	}
+}
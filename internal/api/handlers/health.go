@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"ad-tracking-system/internal/health"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz reports that the process is alive. It checks no dependencies, so an
+// outage of Postgres, Redis or the broker does not get the pod restarted.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the service can take traffic: 200 when every
+// dependency is up, 503 when one is down or the service is shutting down
+func Readyz(checker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checker.Check(c.Request.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"ad-tracking-system/internal/auth"
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/logging"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gin context keys the authenticated credential is stored under
+const (
+	apiKeyContextKey   = "api_key"
+	identityContextKey = "identity"
+)
+
+// RequireAuth rejects requests without an active API key granting scope. When
+// verifier is set, a bearer token from the identity provider whose roles grant
+// scope is accepted too. The credential is read from "Authorization: Bearer
+// <credential>" or, for API keys, the X-API-Key header. Failures to reach the
+// credential stores are logged to logger.
+func RequireAuth(apiKeyService *services.APIKeyService, verifier *auth.OIDCVerifier, scope string, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credential := apiKeyFromRequest(c.Request)
+		if credential == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="api"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "API key or bearer token required"})
+			return
+		}
+
+		if verifier != nil && !auth.LooksLikeKey(credential) {
+			identity, ok := verifyToken(c, verifier, credential, logger)
+			if !ok {
+				return
+			}
+			if !identity.HasScope(scope) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Roles do not grant scope " + scope})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		key, ok := authenticate(c, apiKeyService, logger)
+		if !ok {
+			return
+		}
+		if !key.HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// OptionalAPIKey authenticates the API key if the request has one, for public
+// routes that grant more to authenticated callers. An invalid key is rejected.
+func OptionalAPIKey(apiKeyService *services.APIKeyService, logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKeyFromRequest(c.Request) == "" {
+			c.Next()
+			return
+		}
+		if _, ok := authenticate(c, apiKeyService, logger); ok {
+			c.Next()
+		}
+	}
+}
+
+// APIKey returns the key the request was authenticated with, or nil
+func APIKey(c *gin.Context) *models.APIKey {
+	key, _ := c.Get(apiKeyContextKey)
+	apiKey, _ := key.(*models.APIKey)
+	return apiKey
+}
+
+// Identity returns the identity-provider user the request was authenticated as, or nil
+func Identity(c *gin.Context) *auth.Identity {
+	value, _ := c.Get(identityContextKey)
+	identity, _ := value.(*auth.Identity)
+	return identity
+}
+
+// TenantID returns the tenant of the credential the request was authenticated
+// with, or "" for unauthenticated requests. Tokens without a tenant claim
+// belong to the default tenant.
+func TenantID(c *gin.Context) string {
+	if key := APIKey(c); key != nil {
+		return key.TenantID
+	}
+	if identity := Identity(c); identity != nil {
+		if identity.TenantID == "" {
+			return models.DefaultTenantID
+		}
+		return identity.TenantID
+	}
+	return ""
+}
+
+// verifyToken stores the token's identity in c, or aborts the request and returns false
+func verifyToken(c *gin.Context, verifier *auth.OIDCVerifier, token string, logger *slog.Logger) (*auth.Identity, bool) {
+	identity, err := verifier.Verify(c.Request.Context(), token, time.Now())
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrExpiredToken) {
+		c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired bearer token"})
+		return nil, false
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to verify bearer token", "error", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to authenticate"})
+		return nil, false
+	}
+
+	c.Set(identityContextKey, identity)
+	setActor(c, "user:"+identity.Subject)
+	return identity, true
+}
+
+// setActor makes changes made by the request be audited as made by actor
+func setActor(c *gin.Context, actor string) {
+	ctx := services.WithActor(c.Request.Context(), services.Actor{
+		ID:        actor,
+		RequestID: logging.RequestID(c.Request.Context()),
+		SourceIP:  c.ClientIP(),
+	})
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// authenticate stores the request's key in c, or aborts the request and returns false
+func authenticate(c *gin.Context, apiKeyService *services.APIKeyService, logger *slog.Logger) (*models.APIKey, bool) {
+	key, err := apiKeyService.Authenticate(c.Request.Context(), apiKeyFromRequest(c.Request))
+	if errors.Is(err, services.ErrInvalidAPIKey) {
+		c.Header("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return nil, false
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request.Context(), "Failed to authenticate API key", "error", err)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to authenticate"})
+		return nil, false
+	}
+
+	c.Set(apiKeyContextKey, key)
+	setActor(c, "api_key:"+strconv.FormatInt(key.ID, 10))
+	return key, true
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"ad-tracking-system/internal/auth"
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unavailableAPIKeyStore fails every lookup by hash
+type unavailableAPIKeyStore struct {
+	*repository.MemoryAPIKeyRepository
+}
+
+func (unavailableAPIKeyStore) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	return nil, errors.New("connection refused")
+}
+
+func newTestAPIKeyService(repo repository.APIKeyStore) *services.APIKeyService {
+	audit := services.NewAuditService(repository.NewMemoryAuditRepository(), repository.MemoryTransactor{}, services.Timeouts{}, logging.Discard())
+	return services.NewAPIKeyService(repo, 0, audit, services.Timeouts{}, logging.Discard())
+}
+
+// newTestRouter serves GET /ads behind RequireAuth for ads:read and GET
+// /public behind OptionalAPIKey. Both answer with the tenant of the request.
+func newTestRouter(apiKeyService *services.APIKeyService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	tenant := func(c *gin.Context) { c.String(http.StatusOK, TenantID(c)) }
+	router.GET("/ads", RequireAuth(apiKeyService, nil, auth.ScopeAdsRead, logging.Discard()), tenant)
+	router.GET("/public", OptionalAPIKey(apiKeyService, logging.Discard()), tenant)
+	return router
+}
+
+func serve(router *gin.Engine, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header = header
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequireAuth(t *testing.T) {
+	ctx := context.Background()
+	apiKeyService := newTestAPIKeyService(repository.NewMemoryAPIKeyRepository())
+	router := newTestRouter(apiKeyService)
+
+	_, reader, err := apiKeyService.Create(ctx, "acme", "reader", []string{auth.ScopeAdsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, writer, err := apiKeyService.Create(ctx, "acme", "writer", []string{auth.ScopeClicksWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedKey, revoked, err := apiKeyService.Create(ctx, "acme", "revoked", []string{auth.ScopeAdsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := apiKeyService.Revoke(ctx, "acme", revokedKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	// Without a grace period a rotated key expires at once
+	expiredKey, expired, err := apiKeyService.Create(ctx, "acme", "expired", []string{auth.ScopeAdsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := apiKeyService.Rotate(ctx, "acme", expiredKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	unknown, _, err := auth.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"no credential", http.Header{}, http.StatusUnauthorized},
+		{"empty bearer token", http.Header{"Authorization": {"Bearer "}}, http.StatusUnauthorized},
+		{"malformed key", http.Header{"X-Api-Key": {"not-a-key"}}, http.StatusUnauthorized},
+		{"unknown key", http.Header{"X-Api-Key": {unknown}}, http.StatusUnauthorized},
+		{"revoked key", http.Header{"X-Api-Key": {revoked}}, http.StatusUnauthorized},
+		{"expired key", http.Header{"Authorization": {"Bearer " + expired}}, http.StatusUnauthorized},
+		{"key without the scope", http.Header{"X-Api-Key": {writer}}, http.StatusForbidden},
+		{"X-API-Key", http.Header{"X-Api-Key": {reader}}, http.StatusOK},
+		{"bearer key", http.Header{"Authorization": {"bearer " + reader}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, "/ads", tt.header)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+			if w.Code == http.StatusOK && w.Body.String() != "acme" {
+				t.Errorf("tenant = %q, want acme", w.Body)
+			}
+		})
+	}
+}
+
+func TestRequireAuthStoreUnavailable(t *testing.T) {
+	repo := repository.NewMemoryAPIKeyRepository()
+	_, secret, err := newTestAPIKeyService(repo).Create(context.Background(), "acme", "reader", []string{auth.ScopeAdsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A store outage is not the caller's fault, so it is not a 401
+	router := newTestRouter(newTestAPIKeyService(unavailableAPIKeyStore{repo}))
+	for _, path := range []string{"/ads", "/public"} {
+		if w := serve(router, path, http.Header{"X-Api-Key": {secret}}); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: status = %d, want %d", path, w.Code, http.StatusServiceUnavailable)
+		}
+	}
+}
+
+func TestOptionalAPIKey(t *testing.T) {
+	apiKeyService := newTestAPIKeyService(repository.NewMemoryAPIKeyRepository())
+	router := newTestRouter(apiKeyService)
+	// Any scope will do on public routes
+	_, secret, err := apiKeyService.Create(context.Background(), "acme", "writer", []string{auth.ScopeClicksWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantStatus int
+		wantTenant string
+	}{
+		{"no key", http.Header{}, http.StatusOK, ""},
+		{"valid key", http.Header{"Authorization": {"Bearer " + secret}}, http.StatusOK, "acme"},
+		{"invalid key", http.Header{"X-Api-Key": {"not-a-key"}}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, "/public", tt.header)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code == http.StatusOK && w.Body.String() != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", w.Body, tt.wantTenant)
+			}
+		})
+	}
+}
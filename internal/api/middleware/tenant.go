@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"ad-tracking-system/internal/domain/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantRateLimit rejects requests of tenants over their requests per minute.
+// It must run after RequireAuth; unauthenticated requests are let through.
+func TenantRateLimit(tenantService *services.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenantID := TenantID(c)
+		if tenantID == "" {
+			c.Next()
+			return
+		}
+		if err := tenantService.AllowRequest(c.Request.Context(), tenantID); errors.Is(err, services.ErrRateLimited) {
+			c.Header("Retry-After", "60")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
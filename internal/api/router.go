@@ -2,27 +2,76 @@ package api
 
 import (
 	"ad-tracking-system/internal/api/handlers"
+	"ad-tracking-system/internal/api/middleware"
+	"ad-tracking-system/internal/auth"
 	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/health"
+	"log/slog"
+	"net/http/pprof"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-// NewRouter initializes the API routes and middleware
-func NewRouter(adService *services.AdService, clickService *services.ClickService) *gin.Engine {
-	router := gin.Default()
+// NewRouter initializes the public API routes and middleware. Every request
+// is logged to logger with its request ID.
+func NewRouter(adService *services.AdService, clickService *services.ClickService, apiKeyService *services.APIKeyService, tenantService *services.TenantService, clickSigner *auth.ClickSigner, oidcVerifier *auth.OIDCVerifier, logger *slog.Logger) *gin.Engine {
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.Logger(logger), middleware.Recovery(logger), middleware.Tracing(), middleware.Metrics())
+
+	// Public tracking route, authorised by the click token served with each ad.
+	// Callers with an API key count against their tenant's request rate.
+	router.POST("/ads/click", middleware.OptionalAPIKey(apiKeyService, logger), middleware.TenantRateLimit(tenantService), func(c *gin.Context) {
+		handlers.RecordClick(c, clickService, clickSigner)
+	})
+
+	// API routes, scoped to the tenant of the API key or bearer token. A nil
+	// oidcVerifier only accepts API keys.
+	ads := router.Group("/ads", middleware.RequireAuth(apiKeyService, oidcVerifier, auth.ScopeAdsRead, logger), middleware.TenantRateLimit(tenantService))
+	ads.GET("", func(c *gin.Context) {
+		handlers.GetAds(c, adService, clickSigner)
+	})
+
+	analytics := router.Group("/ads/analytics", middleware.RequireAuth(apiKeyService, oidcVerifier, auth.ScopeAnalyticsRead, logger), middleware.TenantRateLimit(tenantService))
+	analytics.GET("", handlers.GetAnalytics(clickService))
+
+	return router
+}
+
+// NewInternalRouter initializes the routes served on the metrics port only:
+// metrics, probes, profiling and the admin API. The port must not be exposed
+// through the public ingress; pprof in particular is unauthenticated.
+func NewInternalRouter(reconciliationService *services.ReconciliationService, apiKeyService *services.APIKeyService, tenantService *services.TenantService, auditService *services.AuditService, oidcVerifier *auth.OIDCVerifier, healthChecker *health.Checker, logger *slog.Logger) *gin.Engine {
+	// Only admin requests are logged: probes and scrapes would drown everything
+	// else out
+	router := gin.New()
+	router.Use(middleware.Recovery(logger))
 
 	// Prometheus metrics endpoint
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
-	// API routes
-	router.GET("/ads", func(c *gin.Context) {
-		handlers.GetAds(c, adService)
-	})
-	router.POST("/ads/click", func(c *gin.Context) {
-		handlers.RecordClick(c, clickService)
-	})
-	router.GET("/ads/analytics", handlers.GetAnalytics(clickService))
+	// Kubernetes probes
+	router.GET("/healthz", handlers.Healthz)
+	router.GET("/readyz", handlers.Readyz(healthChecker))
+
+	// Profiling
+	debug := router.Group("/debug/pprof")
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	debug.GET("/:profile", gin.WrapF(pprof.Index)) // heap, goroutine, allocs, block, mutex, threadcreate
+
+	// Admin routes
+	admin := router.Group("/admin", middleware.RequestID(), middleware.Logger(logger), middleware.Tracing(), middleware.RequireAuth(apiKeyService, oidcVerifier, auth.ScopeAdmin, logger), middleware.TenantRateLimit(tenantService))
+	admin.POST("/reconcile", handlers.ReconcileCounters(reconciliationService))
+	admin.GET("/api-keys", handlers.ListAPIKeys(apiKeyService))
+	admin.POST("/api-keys", handlers.CreateAPIKey(apiKeyService))
+	admin.POST("/api-keys/:id/rotate", handlers.RotateAPIKey(apiKeyService))
+	admin.DELETE("/api-keys/:id", handlers.RevokeAPIKey(apiKeyService))
+	admin.GET("/audit", handlers.ListAuditEvents(auditService))
 
 	return router
 }
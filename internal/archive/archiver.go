@@ -0,0 +1,219 @@
+package archive
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/repository"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// FormatNDJSONGzip is the format of archive objects: one JSON click per line, gzip-compressed
+const FormatNDJSONGzip = "ndjson+gzip"
+
+// Record is a single archived click
+type Record struct {
+	ID           int64     `json:"id"`
+	TenantID     string    `json:"tenant_id"`
+	AdID         string    `json:"ad_id"`
+	Timestamp    time.Time `json:"timestamp"`
+	IP           string    `json:"ip"`
+	PlaybackTime int       `json:"playback_time"`
+}
+
+// Manifest describes an archive object and is stored next to it
+type Manifest struct {
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Partition string    `json:"partition,omitempty"` // Set when only one partition was archived
+	Object    string    `json:"object"`
+	Format    string    `json:"format"`
+	RowCount  int64     `json:"row_count"`
+	Bytes     int64     `json:"bytes"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Archiver exports click ranges to a Store and removes them once the copy is verified
+type Archiver struct {
+	clicks repository.ClickArchiveStore
+	store  Store
+	logger *slog.Logger
+}
+
+// NewArchiver creates a new Archiver
+func NewArchiver(clicks repository.ClickArchiveStore, store Store, logger *slog.Logger) *Archiver {
+	return &Archiver{clicks: clicks, store: store, logger: logger}
+}
+
+// ObjectKey returns the key of the archive object for the range [from, to)
+func ObjectKey(from, to time.Time) string {
+	const layout = "20060102T150405Z"
+	from, to = from.UTC(), to.UTC()
+	return fmt.Sprintf("clicks/%04d/%02d/clicks_%s_%s.ndjson.gz",
+		from.Year(), from.Month(), from.Format(layout), to.Format(layout))
+}
+
+// ManifestKey returns the key of the manifest for an archive object
+func ManifestKey(objectKey string) string {
+	return objectKey + ".manifest.json"
+}
+
+// Archive exports clicks in [from, to), uploads the object and its manifest and verifies the upload
+func (a *Archiver) Archive(ctx context.Context, from, to time.Time) (*Manifest, error) {
+	return a.archive(ctx, "", from, to)
+}
+
+// ArchivePartition archives like Archive, but only the clicks stored in
+// partition, which covers [from, to). Clicks of the range held elsewhere, such
+// as in the default partition, are left out.
+func (a *Archiver) ArchivePartition(ctx context.Context, partition string, from, to time.Time) (*Manifest, error) {
+	return a.archive(ctx, partition, from, to)
+}
+
+func (a *Archiver) archive(ctx context.Context, partition string, from, to time.Time) (*Manifest, error) {
+	expected, err := a.clicks.CountRange(ctx, partition, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "clicks-archive-*.ndjson.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(tmp, hash))
+	enc := json.NewEncoder(gz)
+
+	var rows int64
+	err = a.clicks.StreamRange(ctx, partition, from, to, func(id int64, click models.ClickEvent) error {
+		rows++
+		return enc.Encode(Record{
+			ID:           id,
+			TenantID:     click.TenantID,
+			AdID:         click.AdID,
+			Timestamp:    click.Timestamp,
+			IP:           click.IP,
+			PlaybackTime: click.PlaybackTime,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	if rows != expected {
+		return nil, fmt.Errorf("exported %d clicks but range contains %d; is the range still receiving writes?", rows, expected)
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		From:      from.UTC(),
+		To:        to.UTC(),
+		Partition: partition,
+		Object:    ObjectKey(from, to),
+		Format:    FormatNDJSONGzip,
+		RowCount:  rows,
+		Bytes:     size,
+		SHA256:    hex.EncodeToString(hash.Sum(nil)),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := a.store.Put(ctx, manifest.Object, tmp, size); err != nil {
+		return nil, fmt.Errorf("upload archive: %w", err)
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := a.store.Put(ctx, ManifestKey(manifest.Object), bytes.NewReader(manifestJSON), int64(len(manifestJSON))); err != nil {
+		return nil, fmt.Errorf("upload manifest: %w", err)
+	}
+
+	if err := a.Verify(ctx, manifest); err != nil {
+		return nil, err
+	}
+
+	a.logger.InfoContext(ctx, "Archived clicks", "clicks", rows, "from", manifest.From, "to", manifest.To, "partition", partition, "object", manifest.Object)
+	return manifest, nil
+}
+
+// Verify downloads an archive object and checks its checksum and row count against the manifest
+func (a *Archiver) Verify(ctx context.Context, manifest *Manifest) error {
+	obj, err := a.store.Get(ctx, manifest.Object)
+	if err != nil {
+		return fmt.Errorf("download archive: %w", err)
+	}
+	defer obj.Close()
+
+	hash := sha256.New()
+	gz, err := gzip.NewReader(io.TeeReader(obj, hash))
+	if err != nil {
+		return fmt.Errorf("verify archive: %w", err)
+	}
+	defer gz.Close()
+
+	var rows int64
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("verify archive: line %d: %w", rows+1, err)
+		}
+		rows++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("verify archive: %w", err)
+	}
+	// Drain anything after the gzip stream so the checksum covers the whole object
+	if _, err := io.Copy(io.Discard, obj); err != nil {
+		return fmt.Errorf("verify archive: %w", err)
+	}
+
+	if rows != manifest.RowCount {
+		return fmt.Errorf("verify archive: manifest says %d rows, object has %d", manifest.RowCount, rows)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != manifest.SHA256 {
+		return fmt.Errorf("verify archive: checksum mismatch: manifest %s, object %s", manifest.SHA256, sum)
+	}
+	return nil
+}
+
+// ArchiveAndDelete archives clicks in [from, to) and deletes them from the
+// database once verified. Should the range hold clicks written since, nothing
+// is deleted: they are not in the archive.
+func (a *Archiver) ArchiveAndDelete(ctx context.Context, from, to time.Time) (*Manifest, error) {
+	manifest, err := a.Archive(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := a.clicks.DeleteRange(ctx, from, to, manifest.RowCount)
+	if err != nil {
+		return nil, fmt.Errorf("delete archived clicks: %w", err)
+	}
+	a.logger.InfoContext(ctx, "Deleted archived clicks", "clicks", deleted, "from", manifest.From, "to", manifest.To)
+	return manifest, nil
+}
@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	archiveFrom = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	archiveTo   = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// newTestArchiver archives from clicks holding two clicks in January and one
+// in February, to the store made for a temporary dir
+func newTestArchiver(t *testing.T, store func(dir string) Store) (*Archiver, *repository.MemoryClickRepository, string) {
+	t.Helper()
+	clicks := repository.NewMemoryClickRepository(repository.NewMemoryAdRepository())
+	for _, ts := range []time.Time{archiveFrom, archiveTo.Add(-time.Second), archiveTo} {
+		saveClick(t, clicks, ts)
+	}
+	dir := t.TempDir()
+	return NewArchiver(clicks, store(dir), logging.Discard()), clicks, dir
+}
+
+func localStore(dir string) Store { return NewLocalStore(dir) }
+
+func saveClick(t *testing.T, clicks *repository.MemoryClickRepository, ts time.Time) {
+	t.Helper()
+	click := models.ClickEvent{TenantID: "acme", AdID: "1", Timestamp: ts, IP: "203.0.113.7", PlaybackTime: 12}
+	if err := clicks.Save(context.Background(), click); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	ctx := context.Background()
+	archiver, clicks, dir := newTestArchiver(t, localStore)
+
+	manifest, err := archiver.Archive(ctx, archiveFrom, archiveTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.RowCount != 2 || manifest.Object != ObjectKey(archiveFrom, archiveTo) || manifest.Format != FormatNDJSONGzip {
+		t.Errorf("manifest = %+v, want 2 rows in %s", manifest, ObjectKey(archiveFrom, archiveTo))
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(ManifestKey(manifest.Object)))); err != nil {
+		t.Errorf("manifest not stored: %v", err)
+	}
+	if err := archiver.Verify(ctx, manifest); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+	// Archive alone keeps the clicks
+	if n := len(clicks.Clicks()); n != 3 {
+		t.Errorf("%d clicks left, want 3", n)
+	}
+}
+
+func TestVerifyDetectsMismatches(t *testing.T) {
+	ctx := context.Background()
+	archiver, _, dir := newTestArchiver(t, localStore)
+	manifest, err := archiver.Archive(ctx, archiveFrom, archiveTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrongCount := *manifest
+	wrongCount.RowCount = 3
+	if err := archiver.Verify(ctx, &wrongCount); err == nil || !strings.Contains(err.Error(), "manifest says 3 rows") {
+		t.Errorf("Verify() with a wrong row count = %v", err)
+	}
+
+	wrongSum := *manifest
+	wrongSum.SHA256 = strings.Repeat("0", 64)
+	if err := archiver.Verify(ctx, &wrongSum); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Verify() with a wrong checksum = %v", err)
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(manifest.Object))
+	if err := os.Truncate(path, manifest.Bytes/2); err != nil {
+		t.Fatal(err)
+	}
+	if err := archiver.Verify(ctx, manifest); err == nil {
+		t.Error("Verify() of a truncated object = nil, want an error")
+	}
+}
+
+func TestArchiveAndDelete(t *testing.T) {
+	archiver, clicks, _ := newTestArchiver(t, localStore)
+
+	manifest, err := archiver.ArchiveAndDelete(context.Background(), archiveFrom, archiveTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.RowCount != 2 {
+		t.Errorf("archived %d clicks, want 2", manifest.RowCount)
+	}
+	if left := clicks.Clicks(); len(left) != 1 || !left[0].Timestamp.Equal(archiveTo) {
+		t.Errorf("clicks left = %+v, want only February's", left)
+	}
+}
+
+// lateWriteStore saves a click into the archived range once the manifest is
+// uploaded, like a write committing while the range is archived
+type lateWriteStore struct {
+	Store
+	save func()
+}
+
+func (s *lateWriteStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if strings.HasSuffix(key, ".manifest.json") {
+		s.save()
+	}
+	return s.Store.Put(ctx, key, r, size)
+}
+
+func TestArchiveAndDeleteKeepsUnarchivedClicks(t *testing.T) {
+	var clicks *repository.MemoryClickRepository
+	archiver, clicks, _ := newTestArchiver(t, func(dir string) Store {
+		return &lateWriteStore{Store: NewLocalStore(dir), save: func() {
+			saveClick(t, clicks, archiveFrom.Add(time.Hour))
+		}}
+	})
+
+	_, err := archiver.ArchiveAndDelete(context.Background(), archiveFrom, archiveTo)
+	if !errors.Is(err, repository.ErrRangeChanged) {
+		t.Fatalf("ArchiveAndDelete() = %v, want ErrRangeChanged", err)
+	}
+	if n := len(clicks.Clicks()); n != 4 {
+		t.Errorf("%d clicks left, want all 4: the late one is not in the archive", n)
+	}
+}
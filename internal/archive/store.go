@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"ad-tracking-system/internal/config"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Store is a destination for archive objects
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// LocalStore keeps archive objects in a directory on the local filesystem
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates a new LocalStore rooted at dir
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+// Put writes the object to dir/key, creating parent directories as needed
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a partial object is never visible
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Get opens the object stored at dir/key
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, filepath.FromSlash(key)))
+}
+
+// S3Store keeps archive objects in an S3-compatible bucket (AWS S3, MinIO, ...)
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3Store creates a new S3Store for the given endpoint and bucket
+func NewS3Store(endpoint, bucket, accessKey, secretKey string, useSSL bool) (*S3Store, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &S3Store{client: client, bucket: bucket}, nil
+}
+
+// Put uploads the object to the bucket under key
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{})
+	return err
+}
+
+// Get downloads the object stored under key
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+// NewStore creates the Store selected by ARCHIVE_STORE ("local" or "s3")
+func NewStore(cfg *config.Config) (Store, error) {
+	switch cfg.ArchiveStore {
+	case "local":
+		return NewLocalStore(cfg.ArchiveDir), nil
+	case "s3":
+		if cfg.ArchiveS3Endpoint == "" {
+			return nil, fmt.Errorf("ARCHIVE_S3_ENDPOINT is required for the s3 archive store")
+		}
+		return NewS3Store(cfg.ArchiveS3Endpoint, cfg.ArchiveS3Bucket, cfg.ArchiveS3AccessKey, string(cfg.ArchiveS3SecretKey), cfg.ArchiveS3UseSSL)
+	default:
+		return nil, fmt.Errorf("unknown archive store %q", cfg.ArchiveStore)
+	}
+}
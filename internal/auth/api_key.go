@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// API key scopes
+const (
+	ScopeAdsRead       = "ads:read"
+	ScopeClicksWrite   = "clicks:write"
+	ScopeAnalyticsRead = "analytics:read"
+	ScopeAdmin         = "admin" // Admin routes, including managing API keys
+)
+
+// Scopes lists every scope a key can be given
+var Scopes = []string{ScopeAdsRead, ScopeClicksWrite, ScopeAnalyticsRead, ScopeAdmin}
+
+// ValidScope reports whether scope is one of Scopes
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	keyPrefix    = "atk_"
+	keyBytes     = 32
+	prefixLength = len(keyPrefix) + 8
+)
+
+// GenerateKey returns a new random API key and its display prefix
+func GenerateKey() (key, prefix string, err error) {
+	b := make([]byte, keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:prefixLength], nil
+}
+
+// HashKey returns the hash an API key is stored and looked up by. Keys are
+// random, so a fast unsalted hash is enough.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// LooksLikeKey reports whether s has the format of a key from GenerateKey
+func LooksLikeKey(s string) bool {
+	return strings.HasPrefix(s, keyPrefix) && len(s) > prefixLength
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by ClickSigner.Verify
+var (
+	ErrInvalidClickToken = errors.New("invalid click token")
+	ErrExpiredClickToken = errors.New("expired click token")
+)
+
+// ClickSigner issues and checks the tokens that let anonymous clients record
+// clicks. A token is served with every ad and is only valid for that ad of that
+// tenant until it expires, so clicks can't be forged for arbitrary ads. The
+// token carries its tenant, which is how public clicks are attributed.
+type ClickSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewClickSigner creates a ClickSigner issuing tokens valid for ttl
+func NewClickSigner(secret []byte, ttl time.Duration) *ClickSigner {
+	return &ClickSigner{secret: secret, ttl: ttl}
+}
+
+// Sign returns a token for clicks on the tenant's ad adID, issued at now
+func (s *ClickSigner) Sign(tenantID, adID string, now time.Time) string {
+	tenant := base64.RawURLEncoding.EncodeToString([]byte(tenantID))
+	expires := strconv.FormatInt(now.Add(s.ttl).Unix(), 10)
+	return tenant + "." + expires + "." + base64.RawURLEncoding.EncodeToString(s.mac(tenantID, adID, expires))
+}
+
+// Verify checks that token was issued for adID and has not expired at now, and
+// returns the tenant it was issued for
+func (s *ClickSigner) Verify(adID, token string, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", ErrInvalidClickToken
+	}
+	tenantID, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || len(tenantID) == 0 {
+		return "", ErrInvalidClickToken
+	}
+	expires := parts[1]
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(mac, s.mac(string(tenantID), adID, expires)) {
+		return "", ErrInvalidClickToken
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return "", ErrInvalidClickToken
+	}
+	if !now.Before(time.Unix(unix, 0)) {
+		return "", ErrExpiredClickToken
+	}
+	return string(tenantID), nil
+}
+
+func (s *ClickSigner) mac(tenantID, adID, expires string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(tenantID))
+	h.Write([]byte{0})
+	h.Write([]byte(adID))
+	h.Write([]byte{0})
+	h.Write([]byte(expires))
+	return h.Sum(nil)
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClickTokenRoundTrip(t *testing.T) {
+	signer := NewClickSigner([]byte("secret"), time.Hour)
+	now := time.Now()
+
+	token := signer.Sign("acme", "1", now)
+	tenantID, err := signer.Verify("1", token, now.Add(59*time.Minute))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if tenantID != "acme" {
+		t.Errorf("Verify() tenant = %q, want %q", tenantID, "acme")
+	}
+}
+
+func TestClickTokenRejected(t *testing.T) {
+	signer := NewClickSigner([]byte("secret"), time.Hour)
+	now := time.Now()
+	token := signer.Sign("acme", "1", now)
+	parts := strings.Split(token, ".")
+	otherTenant := signer.Sign("other", "1", now)
+	otherParts := strings.Split(otherTenant, ".")
+
+	tests := []struct {
+		name    string
+		signer  *ClickSigner
+		adID    string
+		token   string
+		at      time.Time
+		wantErr error
+	}{
+		{"other ad", signer, "2", token, now, ErrInvalidClickToken},
+		{"other secret", NewClickSigner([]byte("other"), time.Hour), "1", token, now, ErrInvalidClickToken},
+		{"expired", signer, "1", token, now.Add(time.Hour + time.Second), ErrExpiredClickToken},
+		{"extended expiry", signer, "1", parts[0] + ".9999999999." + parts[2], now, ErrInvalidClickToken},
+		{"other tenant", signer, "1", otherParts[0] + "." + parts[1] + "." + parts[2], now, ErrInvalidClickToken},
+		{"empty", signer, "1", "", now, ErrInvalidClickToken},
+		{"garbage", signer, "1", "not.a-token!", now, ErrInvalidClickToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.signer.Verify(tt.adID, tt.token, tt.at); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, prefix, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !LooksLikeKey(key) || key[:len(prefix)] != prefix {
+		t.Errorf("key %q with prefix %q is malformed", key, prefix)
+	}
+	if key == other || HashKey(key) == HashKey(other) {
+		t.Error("two generated keys are equal")
+	}
+}
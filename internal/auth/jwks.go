@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksMinRefresh limits how often an unknown key ID can trigger a reload, so
+// tokens with made-up key IDs can't hammer the identity provider
+const jwksMinRefresh = time.Minute
+
+// jwksRetryBackoff is how long to wait before retrying a failed load. It
+// doubles with every consecutive failure, up to jwksMinRefresh.
+const jwksRetryBackoff = time.Second
+
+// ErrUnknownKey is returned for key IDs that are not in the key set, even after a reload
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// JWKS fetches and caches the signing keys of an identity provider. The keys
+// are reloaded every refresh interval, and early when a token names a key ID
+// that is not cached yet, so rotating keys at the provider needs no restart.
+//
+// Loads run in the background, one at a time, and requests keep using the
+// cached keys meanwhile; only a request that needs a key not cached yet waits
+// for one. After a failed load the next attempt backs off, so an identity
+// provider outage costs one fetch per backoff rather than one per request.
+type JWKS struct {
+	source  string // http(s) URL, or a file path for offline use
+	refresh time.Duration
+	client  *http.Client
+	logger  *slog.Logger
+
+	mu          sync.Mutex
+	keys        map[string]jwk
+	loadedAt    time.Time // Of the last successful load
+	attemptedAt time.Time // Of the last load, successful or not
+	failures    int       // Consecutive failed loads
+	lastErr     error     // Of the last failed load
+	loading     *jwksLoad // In flight, nil when none is
+}
+
+// jwksLoad is one load of the key set, shared by everyone waiting for it
+type jwksLoad struct {
+	done chan struct{}
+	err  error
+}
+
+// jwk is a public key with the algorithm it is restricted to, if any
+type jwk struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// NewJWKS creates a JWKS loading keys from source, which is an http(s) URL, a
+// file:// URL or a file path
+func NewJWKS(source string, refresh time.Duration, logger *slog.Logger) *JWKS {
+	return &JWKS{
+		source:  source,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		logger:  logger,
+	}
+}
+
+// Load fetches the key set now. It is called on startup so that a wrong
+// source is noticed before the first token arrives.
+func (j *JWKS) Load(ctx context.Context) error {
+	j.mu.Lock()
+	load := j.startLoad(ctx)
+	j.mu.Unlock()
+	return load.wait(ctx)
+}
+
+// key returns the key with the given ID
+func (j *JWKS) key(ctx context.Context, kid string) (jwk, error) {
+	j.mu.Lock()
+	now := time.Now()
+	load := j.loading
+	if (j.keys == nil || now.Sub(j.loadedAt) >= j.refresh) && j.retryDue(now) {
+		load = j.startLoad(ctx)
+	}
+	keys, lastErr := j.keys, j.lastErr
+	j.mu.Unlock()
+
+	// Without keys there is nothing to serve meanwhile, so wait for the load
+	if keys == nil {
+		if load == nil {
+			return jwk{}, fmt.Errorf("JWKS unavailable, retrying later: %w", lastErr)
+		}
+		if err := load.wait(ctx); err != nil {
+			return jwk{}, err
+		}
+		keys = j.cached()
+	}
+
+	key, ok := keys[kid]
+	if !ok {
+		j.mu.Lock()
+		load = j.loading
+		if load == nil && now.Sub(j.attemptedAt) >= jwksMinRefresh {
+			load = j.startLoad(ctx)
+		}
+		j.mu.Unlock()
+		if load != nil && load.wait(ctx) == nil {
+			key, ok = j.cached()[kid]
+		}
+	}
+	if !ok {
+		return jwk{}, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+func (j *JWKS) cached() map[string]jwk {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.keys
+}
+
+// retryDue reports whether the backoff after failed loads has passed. It must
+// be called with j.mu held.
+func (j *JWKS) retryDue(now time.Time) bool {
+	if j.loading != nil {
+		return false
+	}
+	if j.failures == 0 {
+		return true
+	}
+	backoff := jwksRetryBackoff
+	for i := 1; i < j.failures && backoff < jwksMinRefresh; i++ {
+		backoff *= 2
+	}
+	if backoff > jwksMinRefresh {
+		backoff = jwksMinRefresh
+	}
+	return now.Sub(j.attemptedAt) >= backoff
+}
+
+// startLoad starts loading the key set in the background, unless a load is in
+// flight already, and returns the load. It must be called with j.mu held.
+// The load outlives the request that started it, so it drops ctx's
+// cancellation and relies on the client timeout instead.
+func (j *JWKS) startLoad(ctx context.Context) *jwksLoad {
+	if j.loading != nil {
+		return j.loading
+	}
+	load := &jwksLoad{done: make(chan struct{})}
+	j.loading = load
+	j.attemptedAt = time.Now()
+
+	go func() {
+		keys, err := j.load(context.WithoutCancel(ctx))
+
+		j.mu.Lock()
+		if err != nil {
+			j.failures++
+			j.lastErr = err
+			j.logger.WarnContext(ctx, "Failed to load JWKS", "source", j.source, "cached_keys", len(j.keys), "failures", j.failures, "error", err)
+		} else {
+			j.keys = keys
+			j.loadedAt = time.Now()
+			j.failures = 0
+			j.lastErr = nil
+		}
+		j.loading = nil
+		j.mu.Unlock()
+
+		load.err = err
+		close(load.done)
+	}()
+	return load
+}
+
+// wait waits for the load to finish or ctx to be done
+func (l *jwksLoad) wait(ctx context.Context) error {
+	select {
+	case <-l.done:
+		return l.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *JWKS) load(ctx context.Context) (map[string]jwk, error) {
+	data, err := j.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse JWKS from %s: %w", j.source, err)
+	}
+	return keys, nil
+}
+
+func (j *JWKS) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(j.source, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS from %s: %s", j.source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS parses the RSA and EC signing keys of a JSON Web Key Set (RFC 7517).
+// Keys of other types or for encryption are skipped.
+func parseJWKS(data []byte) (map[string]jwk, error) {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]jwk, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = parseRSAKey(k.N, k.E)
+		case "EC":
+			key, err = parseECKey(k.Crv, k.X, k.Y)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = jwk{key: key, alg: k.Alg}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	return keys, nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(eBytes)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(exponent.Int64())}
+	if key.N.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must be at least 2048 bits")
+	}
+	return key, nil
+}
+
+func parseECKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, fmt.Errorf("invalid x: %w", err)
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, fmt.Errorf("invalid y: %w", err)
+	}
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xBytes), Y: new(big.Int).SetBytes(yBytes)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("point is not on the curve")
+	}
+	return key, nil
+}
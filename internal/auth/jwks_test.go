@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"ad-tracking-system/internal/logging"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeIdP serves a JWKS, or fails while down. Requests block while hung.
+type fakeIdP struct {
+	mu       sync.Mutex
+	keys     []testKey
+	down     bool
+	hang     chan struct{}
+	requests atomic.Int32
+}
+
+func (p *fakeIdP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.requests.Add(1)
+	p.mu.Lock()
+	keys, down, hang := p.keys, p.down, p.hang
+	p.mu.Unlock()
+
+	if hang != nil {
+		<-hang
+	}
+	if down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	set := map[string][]map[string]string{"keys": {}}
+	for _, key := range keys {
+		set["keys"] = append(set["keys"], key.jwk())
+	}
+	json.NewEncoder(w).Encode(set)
+}
+
+func (p *fakeIdP) set(keys []testKey, down bool, hang chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys, p.down, p.hang = keys, down, hang
+}
+
+// waitForLoad waits until no load of j is in flight
+func waitForLoad(t *testing.T, j *JWKS) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		j.mu.Lock()
+		loading := j.loading
+		j.mu.Unlock()
+		if loading == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("JWKS load still in flight")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestJWKSRefreshServesCachedKeysAndBacksOff(t *testing.T) {
+	ctx := context.Background()
+	oldKey, newKey := newRSAKey(t, "old"), newRSAKey(t, "new")
+	idp := &fakeIdP{keys: []testKey{oldKey}}
+	srv := httptest.NewServer(idp)
+	defer srv.Close()
+
+	jwks := NewJWKS(srv.URL, time.Hour, logging.Discard())
+	if err := jwks.Load(ctx); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// The provider hangs once the keys are due for a refresh; requests keep
+	// getting the cached key rather than waiting for it
+	hang := make(chan struct{})
+	idp.set(nil, true, hang)
+	jwks.mu.Lock()
+	jwks.loadedAt = jwks.loadedAt.Add(-time.Hour)
+	jwks.mu.Unlock()
+	for i := 0; i < 10; i++ {
+		if _, err := jwks.key(ctx, "old"); err != nil {
+			t.Fatalf("key() during a refresh error = %v", err)
+		}
+	}
+	close(hang)
+	waitForLoad(t, jwks)
+	if got := idp.requests.Load(); got != 2 {
+		t.Fatalf("requests = %d, want 2: one load plus one shared refresh", got)
+	}
+
+	// After the failure, neither stale keys nor unknown key IDs reach the
+	// provider until the backoff has passed
+	for i := 0; i < 10; i++ {
+		if _, err := jwks.key(ctx, "old"); err != nil {
+			t.Fatalf("key() after a failed refresh error = %v", err)
+		}
+		if _, err := jwks.key(ctx, "new"); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("key() of an unknown key error = %v, want %v", err, ErrUnknownKey)
+		}
+	}
+	if got := idp.requests.Load(); got != 2 {
+		t.Fatalf("requests during the backoff = %d, want 2", got)
+	}
+
+	// Once the provider is back and the backoff has passed, an unknown key ID
+	// waits for the reload
+	idp.set([]testKey{oldKey, newKey}, false, nil)
+	jwks.mu.Lock()
+	jwks.attemptedAt = jwks.attemptedAt.Add(-jwksMinRefresh)
+	jwks.mu.Unlock()
+	if _, err := jwks.key(ctx, "new"); err != nil {
+		t.Fatalf("key() after the provider is back error = %v", err)
+	}
+	if jwks.failures != 0 || jwks.lastErr != nil {
+		t.Errorf("failures = %d, lastErr = %v after a successful load", jwks.failures, jwks.lastErr)
+	}
+}
+
+func TestJWKSWithoutKeysFailsFastDuringBackoff(t *testing.T) {
+	ctx := context.Background()
+	idp := &fakeIdP{down: true}
+	srv := httptest.NewServer(idp)
+	defer srv.Close()
+
+	jwks := NewJWKS(srv.URL, time.Hour, logging.Discard())
+	if err := jwks.Load(ctx); err == nil {
+		t.Fatal("Load() from a failing provider succeeded")
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := jwks.key(ctx, "k1"); err == nil {
+			t.Fatal("key() without keys succeeded")
+		}
+	}
+	if got := idp.requests.Load(); got != 1 {
+		t.Fatalf("requests = %d, want 1 until the backoff has passed", got)
+	}
+
+	idp.set([]testKey{newRSAKey(t, "k1")}, false, nil)
+	jwks.mu.Lock()
+	jwks.attemptedAt = jwks.attemptedAt.Add(-jwksRetryBackoff)
+	jwks.mu.Unlock()
+	if _, err := jwks.key(ctx, "k1"); err != nil {
+		t.Fatalf("key() after the backoff error = %v", err)
+	}
+}
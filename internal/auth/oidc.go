@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Dashboard roles, from least to most privileged
+const (
+	RoleViewer = "viewer" // Read ads and analytics
+	RoleEditor = "editor" // Viewer, plus recording clicks
+	RoleAdmin  = "admin"  // Everything, including the admin routes
+)
+
+// roleScopes lists the API key scopes each role is granted
+var roleScopes = map[string][]string{
+	RoleViewer: {ScopeAdsRead, ScopeAnalyticsRead},
+	RoleEditor: {ScopeAdsRead, ScopeAnalyticsRead, ScopeClicksWrite},
+	RoleAdmin:  Scopes,
+}
+
+// tokenLeeway allows for clock skew between us and the identity provider
+const tokenLeeway = time.Minute
+
+// Errors returned by OIDCVerifier.Verify
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("expired token")
+)
+
+// OIDCConfig configures how ID and access tokens are checked and mapped
+type OIDCConfig struct {
+	Issuer      string            // Required value of the iss claim
+	Audience    string            // Value the aud claim must contain, if set
+	RolesClaim  string            // Claim holding the roles, dot-separated for nested claims
+	RoleMap     map[string]string // Maps claim values such as group names to roles
+	TenantClaim string            // Claim holding the tenant ID
+}
+
+// Identity is the dashboard user a verified token was issued to
+type Identity struct {
+	Subject  string   `json:"sub"`
+	Email    string   `json:"email,omitempty"`
+	TenantID string   `json:"tenant_id,omitempty"`
+	Roles    []string `json:"roles"`
+}
+
+// HasScope reports whether one of the identity's roles grants scope
+func (i *Identity) HasScope(scope string) bool {
+	for _, role := range i.Roles {
+		for _, s := range roleScopes[role] {
+			if s == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OIDCVerifier verifies bearer tokens issued by an OpenID Connect provider
+type OIDCVerifier struct {
+	keys *JWKS
+	cfg  OIDCConfig
+}
+
+// NewOIDCVerifier creates an OIDCVerifier checking signatures against keys
+func NewOIDCVerifier(keys *JWKS, cfg OIDCConfig) *OIDCVerifier {
+	return &OIDCVerifier{keys: keys, cfg: cfg}
+}
+
+// Verify checks the signature, issuer, audience and lifetime of a compact JWS
+// and returns who it was issued to. Roles the token names but that are not
+// known are dropped.
+func (v *OIDCVerifier) Verify(ctx context.Context, token string, now time.Time) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	key, err := v.keys.key(ctx, header.Kid)
+	if errors.Is(err, ErrUnknownKey) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return nil, fmt.Errorf("%w: key %q is for %s, not %s", ErrInvalidToken, header.Kid, key.alg, header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if err := verifySignature(header.Alg, key.key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.checkClaims(claims, now); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{Roles: []string{}}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	if v.cfg.TenantClaim != "" {
+		identity.TenantID, _ = lookupClaim(claims, v.cfg.TenantClaim).(string)
+	}
+	for _, value := range claimStrings(lookupClaim(claims, v.cfg.RolesClaim)) {
+		if mapped, ok := v.cfg.RoleMap[value]; ok {
+			value = mapped
+		}
+		if _, ok := roleScopes[value]; ok {
+			identity.Roles = append(identity.Roles, value)
+		}
+	}
+	if identity.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return identity, nil
+}
+
+func (v *OIDCVerifier) checkClaims(claims map[string]interface{}, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return fmt.Errorf("%w: issuer %q", ErrInvalidToken, iss)
+	}
+	if v.cfg.Audience != "" {
+		found := false
+		for _, aud := range claimStrings(claims["aud"]) {
+			if aud == v.cfg.Audience {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: audience", ErrInvalidToken)
+		}
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("%w: no expiry", ErrInvalidToken)
+	}
+	if !now.Add(-tokenLeeway).Before(time.Unix(int64(exp), 0)) {
+		return ErrExpiredToken
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(tokenLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	return nil
+}
+
+// ParseRoleMap parses "value=role,value=role" pairs mapping claim values to roles
+func ParseRoleMap(s string) (map[string]string, error) {
+	roles := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		value, role, ok := strings.Cut(pair, "=")
+		value, role = strings.TrimSpace(value), strings.TrimSpace(role)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid role mapping %q, want value=role", pair)
+		}
+		if _, ok := roleScopes[role]; !ok {
+			return nil, fmt.Errorf("unknown role %q, want %s, %s or %s", role, RoleViewer, RoleEditor, RoleAdmin)
+		}
+		roles[value] = role
+	}
+	return roles, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		// Never "none", and never HMAC, which would let a public key sign tokens
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return fmt.Errorf("%s token signed with an RSA key", alg)
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, sig)
+	case *ecdsa.PublicKey:
+		if alg[0] != 'E' {
+			return fmt.Errorf("%s token signed with an EC key", alg)
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// lookupClaim returns the claim at a dot-separated path, e.g. realm_access.roles
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	if path == "" {
+		return nil
+	}
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// claimStrings returns a claim that is a string array, or a single string of
+// space-separated values
+func claimStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"ad-tracking-system/internal/logging"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIssuer = "https://idp.example.com"
+
+// testKey is a signing key of the fake identity provider
+type testKey struct {
+	kid string
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, rsa: key}
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{kid: kid, ec: key}
+}
+
+func (k testKey) jwk() map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	if k.rsa != nil {
+		return map[string]string{"kid": k.kid, "kty": "RSA", "use": "sig", "alg": "RS256",
+			"n": b64(k.rsa.N.Bytes()), "e": b64(big.NewInt(int64(k.rsa.E)).Bytes())}
+	}
+	return map[string]string{"kid": k.kid, "kty": "EC", "crv": "P-256",
+		"x": b64(k.ec.X.FillBytes(make([]byte, 32))), "y": b64(k.ec.Y.FillBytes(make([]byte, 32)))}
+}
+
+func (k testKey) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	alg := "RS256"
+	if k.ec != nil {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": k.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	if k.rsa != nil {
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	} else {
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// writeJWKS publishes keys in a JWKS file and returns its path
+func writeJWKS(t *testing.T, path string, keys ...testKey) string {
+	t.Helper()
+	set := map[string]interface{}{"keys": []map[string]string{}}
+	for _, key := range keys {
+		set["keys"] = append(set["keys"].([]map[string]string), key.jwk())
+	}
+	data, _ := json.Marshal(set)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func validClaims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":       testIssuer,
+		"aud":       []string{"dashboard", "other"},
+		"sub":       "user-1",
+		"email":     "jo@example.com",
+		"exp":       now.Add(time.Hour).Unix(),
+		"tenant_id": "acme",
+		"groups":    []string{"ad-ops", "everyone"},
+	}
+}
+
+func newTestVerifier(jwksPath string) *OIDCVerifier {
+	return NewOIDCVerifier(NewJWKS(jwksPath, time.Hour, logging.Discard()), OIDCConfig{
+		Issuer:      testIssuer,
+		Audience:    "dashboard",
+		RolesClaim:  "groups",
+		RoleMap:     map[string]string{"ad-ops": RoleEditor},
+		TenantClaim: "tenant_id",
+	})
+}
+
+func TestOIDCVerify(t *testing.T) {
+	now := time.Now()
+	for _, key := range []testKey{newRSAKey(t, "rsa"), newECKey(t, "ec")} {
+		t.Run(key.kid, func(t *testing.T) {
+			verifier := newTestVerifier(writeJWKS(t, filepath.Join(t.TempDir(), "jwks.json"), key))
+
+			identity, err := verifier.Verify(context.Background(), key.sign(t, validClaims(now)), now)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if identity.Subject != "user-1" || identity.TenantID != "acme" || len(identity.Roles) != 1 || identity.Roles[0] != RoleEditor {
+				t.Fatalf("Verify() = %+v", identity)
+			}
+			if !identity.HasScope(ScopeClicksWrite) || identity.HasScope(ScopeAdmin) {
+				t.Errorf("editor scopes are wrong")
+			}
+		})
+	}
+}
+
+func TestOIDCVerifyRejected(t *testing.T) {
+	now := time.Now()
+	key := newRSAKey(t, "k1")
+	verifier := newTestVerifier(writeJWKS(t, filepath.Join(t.TempDir(), "jwks.json"), key))
+
+	with := func(name string, value interface{}) string {
+		claims := validClaims(now)
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return key.sign(t, claims)
+	}
+	valid := key.sign(t, validClaims(now))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"other issuer", with("iss", "https://evil.example.com"), ErrInvalidToken},
+		{"other audience", with("aud", "other"), ErrInvalidToken},
+		{"expired", with("exp", now.Add(-2*time.Minute).Unix()), ErrExpiredToken},
+		{"no expiry", with("exp", nil), ErrInvalidToken},
+		{"not valid yet", with("nbf", now.Add(time.Hour).Unix()), ErrInvalidToken},
+		{"no subject", with("sub", nil), ErrInvalidToken},
+		{"unknown key", newRSAKey(t, "k2").sign(t, validClaims(now)), ErrInvalidToken},
+		{"forged signature", newRSAKey(t, "k1").sign(t, validClaims(now)), ErrInvalidToken},
+		{"unsigned", valid[:strings.LastIndex(valid, ".")+1], ErrInvalidToken},
+		{"malformed", "not-a-token", ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := verifier.Verify(context.Background(), tt.token, now); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOIDCVerifyPicksUpRotatedKeys(t *testing.T) {
+	now := time.Now()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	oldKey, newKey := newRSAKey(t, "old"), newRSAKey(t, "new")
+	verifier := newTestVerifier(writeJWKS(t, path, oldKey))
+	if _, err := verifier.Verify(context.Background(), oldKey.sign(t, validClaims(now)), now); err != nil {
+		t.Fatalf("Verify() with the old key error = %v", err)
+	}
+
+	// The provider publishes a new key; an unknown key ID reloads the set, but
+	// at most once a minute
+	writeJWKS(t, path, oldKey, newKey)
+	if _, err := verifier.Verify(context.Background(), newKey.sign(t, validClaims(now)), now); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify() right after the first load error = %v, want %v", err, ErrInvalidToken)
+	}
+	verifier.keys.attemptedAt = verifier.keys.attemptedAt.Add(-jwksMinRefresh)
+	if _, err := verifier.Verify(context.Background(), newKey.sign(t, validClaims(now)), now); err != nil {
+		t.Fatalf("Verify() with the new key error = %v", err)
+	}
+}
+
+func TestParseRoleMap(t *testing.T) {
+	roles, err := ParseRoleMap("ad-ops=editor, sre = admin,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles["ad-ops"] != RoleEditor || roles["sre"] != RoleAdmin || len(roles) != 2 {
+		t.Errorf("ParseRoleMap() = %v", roles)
+	}
+	if _, err := ParseRoleMap("ad-ops=owner"); err == nil {
+		t.Error("ParseRoleMap() accepted an unknown role")
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayersFileEnvAndSecretFiles(t *testing.T) {
+	for _, tc := range []struct{ name, content string }{
+		{"config.yaml", "http_port: 9090\nkafka_brokers: [kafka-1:9092, kafka-2:9092]\nrollup_interval: 1m\nlog_level: warn\nclick_signing_secret_file: " + writeFile(t, "secret", "s3cret\n") + "\n"},
+		{"config.toml", "http_port = 9090\nkafka_brokers = [\"kafka-1:9092\", \"kafka-2:9092\"]\nrollup_interval = \"1m\"\nlog_level = \"warn\"\nclick_signing_secret_file = \"" + writeFile(t, "secret", "s3cret\n") + "\"\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", writeFile(t, tc.name, tc.content))
+			t.Setenv("LOG_LEVEL", "debug") // The environment overrides the file
+			t.Setenv("DATABASE_URL_FILE", writeFile(t, "dsn", "postgres://ads:pw@db:5432/ads\n"))
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.HTTPPort != 9090 || strings.Join(cfg.KafkaBrokers, ",") != "kafka-1:9092,kafka-2:9092" || cfg.RollupInterval != time.Minute {
+				t.Errorf("file settings not applied: port %d, brokers %v, rollup interval %s", cfg.HTTPPort, cfg.KafkaBrokers, cfg.RollupInterval)
+			}
+			if cfg.LogLevel != "debug" {
+				t.Errorf("LogLevel = %q, want the environment's debug", cfg.LogLevel)
+			}
+			if cfg.ClickSigningSecret != "s3cret" || cfg.DatabaseURL != "postgres://ads:pw@db:5432/ads" {
+				t.Errorf("secrets not read from files: %q, %q", string(cfg.ClickSigningSecret), cfg.DatabaseURL)
+			}
+			if cfg.MetricsPort != defaultMetricsPort {
+				t.Errorf("MetricsPort = %d, want the default", cfg.MetricsPort)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryError(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, "config.yaml", "http_port: 0\nrolup_interval: 1m\n"))
+	t.Setenv("KAFKA_BATCH_SIZE", "many")
+	t.Setenv("EVENT_BROKER", "carrier-pigeon")
+	t.Setenv("DATABASE_URL", "mysql://localhost/ads")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Load() accepted an invalid configuration")
+	}
+	for _, want := range []string{
+		`KAFKA_BATCH_SIZE: invalid integer "many"`,
+		"rolup_interval: unknown setting",
+		"HTTP_PORT: must be a port",
+		"EVENT_BROKER: must be one of",
+		"DATABASE_URL: must be a postgres:// URL",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %q", err, want)
+		}
+	}
+}
+
+func TestMergeOnlyAppliesReloadableFields(t *testing.T) {
+	current := &Config{LogLevel: "info", ClickIPLimit: 30, HTTPPort: 8080}
+	next := &Config{LogLevel: "debug", ClickIPLimit: 30, HTTPPort: 9090}
+
+	updated, changed, ignored := merge(current, next)
+	if updated.LogLevel != "debug" || updated.HTTPPort != 8080 {
+		t.Errorf("merge() = log level %q, port %d, want debug and the current port", updated.LogLevel, updated.HTTPPort)
+	}
+	if strings.Join(changed, ",") != "LogLevel" || strings.Join(ignored, ",") != "HTTPPort" {
+		t.Errorf("merge() changed %v and ignored %v", changed, ignored)
+	}
+	if current.LogLevel != "info" {
+		t.Error("merge() modified the current configuration")
+	}
+}
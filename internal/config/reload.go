@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+)
+
+// Watch reloads the configuration on SIGHUP until ctx is done. When the new
+// configuration is valid, apply is called with current updated by the changed
+// fields tagged reload:"true"; changes to other fields only take effect on
+// restart and are logged. An invalid configuration is logged and ignored.
+func Watch(ctx context.Context, current *Config, logger *slog.Logger, apply func(*Config)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+
+		next, err := Load()
+		if err != nil {
+			logger.Error("Failed to reload configuration, keeping the current one", "error", err)
+			continue
+		}
+		updated, changed, ignored := merge(current, next)
+		if len(ignored) > 0 {
+			logger.Warn("Configuration changes need a restart to take effect", "settings", ignored)
+		}
+		if len(changed) == 0 {
+			logger.Info("Reloaded configuration, nothing to apply")
+			continue
+		}
+		apply(updated)
+		current = updated
+		logger.Info("Reloaded configuration", "changed", changed)
+	}
+}
+
+// merge returns a copy of current with the reloadable fields of next, and the
+// names of the changed reloadable and other fields
+func merge(current, next *Config) (*Config, []string, []string) {
+	updated := *current
+	var changed, ignored []string
+
+	u, n := reflect.ValueOf(&updated).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < u.NumField(); i++ {
+		field := u.Type().Field(i)
+		if reflect.DeepEqual(u.Field(i).Interface(), n.Field(i).Interface()) {
+			continue
+		}
+		if field.Tag.Get("reload") != "true" {
+			ignored = append(ignored, field.Name)
+			continue
+		}
+		u.Field(i).Set(n.Field(i))
+		changed = append(changed, field.Name)
+	}
+	return &updated, changed, ignored
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// loader reads settings from environment variables and, below them, a config
+// file. Parse errors are collected rather than falling back to defaults, so
+// that Load can report every invalid setting at once.
+type loader struct {
+	file     map[string]string // Settings of the config file by lower-case key
+	fileName string
+	used     map[string]bool // Keys looked up, to find unknown keys in the file
+	errs     []error
+}
+
+// newLoader reads the config file at path, a YAML (.yaml, .yml) or TOML
+// (.toml) document of settings named after their environment variables in
+// lower case. An empty path reads only environment variables.
+func newLoader(path string) (*loader, error) {
+	l := &loader{file: make(map[string]string), fileName: path, used: make(map[string]bool)}
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.NewDecoder(bytes.NewReader(data)).Decode(&doc)
+	default:
+		return nil, fmt.Errorf("config file %s: unknown format, want .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+
+	for key, value := range doc {
+		s, err := fileValue(value)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Errorf("%s: %s in %s", key, err, path))
+			continue
+		}
+		l.file[strings.ToLower(key)] = s
+	}
+	return l, nil
+}
+
+// fileValue turns a value of the config file into the string an environment
+// variable would hold. Lists become comma-separated.
+func fileValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return "", fmt.Errorf("nested settings are not supported")
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// lookup returns the setting key from, in order, the environment variable key,
+// the file named by the environment variable key_FILE, the config file's
+// key, or the file named by the config file's key_file. The _FILE variants
+// read secrets mounted as files, such as Kubernetes secrets.
+func (l *loader) lookup(key string) (string, bool) {
+	name := strings.ToLower(key)
+	l.used[name] = true
+	l.used[name+"_file"] = true
+
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	if path, ok := os.LookupEnv(key + "_FILE"); ok {
+		return l.readSecret(key, path)
+	}
+	if value, ok := l.file[name]; ok {
+		return value, true
+	}
+	if path, ok := l.file[name+"_file"]; ok {
+		return l.readSecret(key, path)
+	}
+	return "", false
+}
+
+// readSecret reads the value of key from the file at path, without the
+// trailing newline most tools write
+func (l *loader) readSecret(key, path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", key, err))
+		return "", false
+	}
+	return strings.TrimRight(string(data), "\r\n"), true
+}
+
+// unknownKeys reports settings of the config file that no lookup asked for,
+// which are most likely misspelt
+func (l *loader) unknownKeys() {
+	var unknown []string
+	for key := range l.file {
+		if !l.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		l.errs = append(l.errs, fmt.Errorf("%s: unknown setting in %s", key, l.fileName))
+	}
+}
+
+func (l *loader) get(key, defaultValue string) string {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	return value
+}
+
+func (l *loader) getSecret(key string) Secret {
+	return Secret(l.get(key, ""))
+}
+
+func (l *loader) getInt(key string, defaultValue int) int {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	intValue, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: invalid integer %q", key, value))
+		return defaultValue
+	}
+	return intValue
+}
+
+func (l *loader) getBool(key string, defaultValue bool) bool {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: invalid boolean %q", key, value))
+		return defaultValue
+	}
+	return boolValue
+}
+
+func (l *loader) getFloat(key string, defaultValue float64) float64 {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	floatValue, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: invalid number %q", key, value))
+		return defaultValue
+	}
+	return floatValue
+}
+
+func (l *loader) getSlice(key string, defaultValue []string, separator string) []string {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	return strings.Split(value, separator)
+}
+
+func (l *loader) getDuration(key string, defaultValue time.Duration) time.Duration {
+	value, ok := l.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: invalid duration %q", key, value))
+		return defaultValue
+	}
+	return duration
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"ad-tracking-system/internal/auth"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// validate returns an error for every setting out of its range, so that a bad
+// deployment fails on start-up rather than on first use
+func (c *Config) validate() []error {
+	var v validator
+
+	v.port("HTTP_PORT", c.HTTPPort)
+	v.port("METRICS_PORT", c.MetricsPort)
+	if c.HTTPPort == c.MetricsPort {
+		v.fail("METRICS_PORT", "must differ from HTTP_PORT, both are %d", c.HTTPPort)
+	}
+	if !strings.HasPrefix(c.DatabaseURL, "postgres://") {
+		v.fail("DATABASE_URL", "must be a postgres:// URL")
+	}
+	for _, broker := range c.KafkaBrokers {
+		if strings.TrimSpace(broker) == "" {
+			v.fail("KAFKA_BROKERS", "must be a comma-separated list of host:port, got an empty entry")
+			break
+		}
+	}
+
+	// Zero disables these timeouts
+	v.nonNegative("READ_TIMEOUT", c.ReadTimeout)
+	v.nonNegative("WRITE_TIMEOUT", c.WriteTimeout)
+	v.nonNegative("DB_TIMEOUT", c.DatabaseTimeout)
+	v.nonNegative("REDIS_TIMEOUT", c.RedisTimeout)
+	v.nonNegative("PUBLISH_TIMEOUT", c.PublishTimeout)
+	v.nonNegative("KAFKA_LINGER", c.KafkaLinger)
+	v.nonNegative("API_KEY_ROTATION_GRACE", c.APIKeyRotationGrace)
+	v.nonNegative("SHUTDOWN_DRAIN_DELAY", c.ShutdownDrainDelay)
+
+	// Intervals drive tickers and windows, which need a positive period
+	v.positive("KAFKA_SPOOL_DRAIN_INTERVAL", c.KafkaSpoolDrainEvery)
+	v.positive("PARTITION_MAINTENANCE_INTERVAL", c.PartitionMaintenanceInterval)
+	v.positive("ROLLUP_INTERVAL", c.RollupInterval)
+	v.positive("ROLLUP_LOOKBACK", c.RollupLookback)
+	v.positive("RECONCILE_INTERVAL", c.ReconcileInterval)
+	v.positive("OUTBOX_POLL_INTERVAL", c.OutboxPollInterval)
+	v.positive("OUTBOX_RETENTION", c.OutboxRetention)
+	v.positive("AGGREGATE_WINDOW", c.AggregateWindow)
+	v.positive("AGGREGATE_FLUSH_INTERVAL", c.AggregateFlushInterval)
+	v.positive("WEBHOOK_TIMEOUT", c.WebhookTimeout)
+	v.positive("CLICK_TOKEN_TTL", c.ClickTokenTTL)
+	v.positive("OIDC_JWKS_REFRESH", c.OIDCJWKSRefresh)
+	v.positive("HEALTH_CHECK_TIMEOUT", c.HealthCheckTimeout)
+
+	v.atLeast("KAFKA_BATCH_SIZE", c.KafkaBatchSize, 0)
+	v.atLeast("KAFKA_SPOOL_MAX_BYTES", c.KafkaSpoolMaxBytes, 1)
+	v.atLeast("KAFKA_SPOOL_SEGMENT_BYTES", c.KafkaSpoolSegmentBytes, 1)
+	v.atLeast("PARTITION_PREMAKE", c.PartitionPremake, 0)
+	v.atLeast("CLICK_RETENTION_DAYS", c.ClickRetentionDays, 0)
+	v.atLeast("RECONCILE_DRIFT_THRESHOLD", c.ReconcileDriftThreshold, 0)
+	v.atLeast("OUTBOX_BATCH_SIZE", c.OutboxBatchSize, 1)
+	v.atLeast("AGGREGATE_MAX_BATCH", c.AggregateMaxBatch, 1)
+	v.atLeast("REDIS_STREAM_MAX_LEN", c.RedisStreamMaxLen, 0)
+	v.atLeast("CLICK_IP_LIMIT", c.ClickIPLimit, 1)
+	v.atLeast("CIRCUIT_BREAKER_FAILURE_THRESHOLD", c.CircuitBreakerFailureThreshold, 0)
+
+	v.oneOf("KAFKA_PARTITIONER", c.KafkaPartitioner, "hash", "murmur2", "roundrobin", "random")
+	v.oneOf("KAFKA_PRODUCER_MODE", c.KafkaProducerMode, "sync", "async")
+	v.oneOf("KAFKA_COMPRESSION", c.KafkaCompression, "none", "gzip", "snappy", "lz4", "zstd")
+	v.oneOf("PARTITION_INTERVAL", c.PartitionInterval, "day", "month")
+	v.oneOf("PARTITION_RETENTION_MODE", c.PartitionRetentionMode, "drop", "detach", "archive")
+	v.oneOf("ARCHIVE_STORE", c.ArchiveStore, "local", "s3")
+	v.oneOf("EVENT_BROKER", c.EventBroker, "kafka", "redis", "nats", "memory", "webhook")
+	v.oneOf("TRACING_EXPORTER", c.TracingExporter, "none", "otlp", "stdout")
+	v.oneOf("LOG_FORMAT", c.LogFormat, "json", "text")
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		v.fail("LOG_LEVEL", "must be debug, info, warn or error, got %q", c.LogLevel)
+	}
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		v.fail("TRACING_SAMPLE_RATIO", "must be between 0 and 1, got %g", c.TracingSampleRatio)
+	}
+	if c.EventBroker == "webhook" && c.WebhookURL == "" {
+		v.fail("WEBHOOK_URL", "is required for the webhook event broker")
+	}
+	if _, err := auth.ParseRoleMap(c.OIDCRoleMap); err != nil {
+		v.fail("OIDC_ROLE_MAP", "%s", err)
+	}
+	if c.ArchiveStore == "s3" && c.ArchiveS3Endpoint == "" {
+		v.fail("ARCHIVE_S3_ENDPOINT", "is required for the s3 archive store")
+	}
+
+	return v.errs
+}
+
+// validator collects the errors of validate
+type validator struct {
+	errs []error
+}
+
+func (v *validator) fail(key, format string, args ...interface{}) {
+	v.errs = append(v.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) port(key string, port int) {
+	if port < 1 || port > 65535 {
+		v.fail(key, "must be a port between 1 and 65535, got %d", port)
+	}
+}
+
+func (v *validator) nonNegative(key string, d time.Duration) {
+	if d < 0 {
+		v.fail(key, "must not be negative, got %s", d)
+	}
+}
+
+func (v *validator) positive(key string, d time.Duration) {
+	if d <= 0 {
+		v.fail(key, "must be positive, got %s", d)
+	}
+}
+
+func (v *validator) atLeast(key string, n, min int) {
+	if n < min {
+		v.fail(key, "must be at least %d, got %d", min, n)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
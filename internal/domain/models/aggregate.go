@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// ClickWindowCount is the number of clicks an ad received in a time window
+type ClickWindowCount struct {
+	TenantID    string    `json:"tenant_id"`
+	AdID        string    `json:"ad_id"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	Clicks      int64     `json:"clicks"`
+}
+
+// ClickAggregateBatch holds the per-ad window counts of one contiguous range of
+// offsets of one partition of the click topic. Every source offset is counted in
+// exactly one batch, so sinks can apply batches idempotently by remembering the
+// last source offset they applied for each partition.
+type ClickAggregateBatch struct {
+	SourceTopic     string             `json:"source_topic"`
+	SourcePartition int32              `json:"source_partition"`
+	FirstOffset     int64              `json:"first_offset"`
+	LastOffset      int64              `json:"last_offset"`
+	Counts          []ClickWindowCount `json:"counts"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEvent records one change: who made it, to what, and the fields it changed
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	TenantID   string          `json:"tenant_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Actor      string          `json:"actor"` // api_key:<id>, user:<subject>, cli:<user> or job:<name>
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	Before     json.RawMessage `json:"before"` // Changed fields before the change, null for creations
+	After      json.RawMessage `json:"after"`  // Changed fields after the change
+	RequestID  string          `json:"request_id,omitempty"`
+	SourceIP   string          `json:"source_ip,omitempty"`
+}
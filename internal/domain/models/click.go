@@ -4,8 +4,15 @@ import "time"
 
 // ClickEvent represents a user click on an ad
 type ClickEvent struct {
+	TenantID     string    `json:"tenant_id"`
 	AdID         string    `json:"ad_id"`
 	Timestamp    time.Time `json:"timestamp"`
 	IP           string    `json:"ip"`
 	PlaybackTime int       `json:"playback_time"`
 }
+
+// Key returns the message key click events are published with. Keying by
+// tenant and ad puts all clicks of an ad on one partition, in order.
+func (c ClickEvent) Key() string {
+	return c.TenantID + "/" + c.AdID
+}
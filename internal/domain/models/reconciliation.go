@@ -0,0 +1,20 @@
+package models
+
+// CounterDrift is the difference between an ad's cached click counter and Postgres
+type CounterDrift struct {
+	AdID     string `json:"ad_id"`
+	Expected int64  `json:"expected"`
+	Cached   int64  `json:"cached"`
+	Drift    int64  `json:"drift"` // Cached minus expected
+}
+
+// ReconciliationReport summarises a comparison of the Redis click counters with Postgres
+type ReconciliationReport struct {
+	TenantID    string         `json:"tenant_id"`
+	DryRun      bool           `json:"dry_run"`
+	AdsChecked  int            `json:"ads_checked"`
+	AdsUncached int            `json:"ads_uncached"`
+	TotalDrift  int64          `json:"total_drift"` // Sum of absolute drifts
+	Drifts      []CounterDrift `json:"drifts"`      // Only ads whose cached counter is wrong
+	Rewritten   int            `json:"rewritten"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// DefaultTenantID is the tenant of data created before tenants were introduced
+const DefaultTenantID = "default"
+
+// Tenant is a publisher using the system. All its data is kept apart from
+// other tenants' and its usage is limited by its quotas.
+type Tenant struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	RequestsPerMinute int       `json:"requests_per_minute"` // 0 for unlimited
+	ClicksPerDay      int64     `json:"clicks_per_day"`      // 0 for unlimited
+	CreatedAt         time.Time `json:"created_at"`
+}
@@ -4,30 +4,37 @@ import (
 	"ad-tracking-system/internal/domain/models"
 	"ad-tracking-system/internal/repository"
 	"ad-tracking-system/internal/utils/circuitbreaker"
-	"log"
+	"context"
+	"log/slog"
 
 	"github.com/sony/gobreaker"
 )
 
 type AdService struct {
-	adRepo *repository.AdRepository
-	cb     *gobreaker.CircuitBreaker
+	adRepo   repository.AdStore
+	timeouts Timeouts
+	logger   *slog.Logger
+	cb       *gobreaker.CircuitBreaker
 }
 
-func NewAdService(adRepo *repository.AdRepository) *AdService {
+func NewAdService(adRepo repository.AdStore, timeouts Timeouts, logger *slog.Logger) *AdService {
 	return &AdService{
-		adRepo: adRepo,
-		cb:     circuitbreaker.NewCircuitBreaker("ad-service"), // Initialize circuit breaker
+		adRepo:   adRepo,
+		timeouts: timeouts,
+		logger:   logger,
+		cb:       circuitbreaker.NewCircuitBreaker("ad-service", logger), // Initialize circuit breaker
 	}
 }
 
-func (s *AdService) GetAllAds() ([]models.Ad, error) {
+func (s *AdService) GetAllAds(ctx context.Context, tenantID string) ([]models.Ad, error) {
 	// Wrap database operation with circuit breaker
-	result, err := s.cb.Execute(func() (interface{}, error) {
-		return s.adRepo.FetchAll()
+	result, err := circuitbreaker.Execute(ctx, s.cb, func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+		defer cancel()
+		return s.adRepo.FetchAll(ctx, tenantID)
 	})
 	if err != nil {
-		log.Printf("Failed to fetch ads (circuit breaker): %v", err)
+		s.logger.ErrorContext(ctx, "Failed to fetch ads", "tenant_id", tenantID, "error", err)
 		return nil, err
 	}
 
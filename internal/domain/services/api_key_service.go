@@ -0,0 +1,179 @@
+package services
+
+import (
+	"ad-tracking-system/internal/auth"
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// lastUsedResolution is how stale a key's last-used time may get before it is
+// written again, so that busy keys don't cost a write on every request
+const lastUsedResolution = time.Minute
+
+var (
+	// ErrInvalidAPIKey is returned for keys that are unknown, revoked or expired
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrInvalidScope is returned when creating a key with an unknown scope
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// APIKeyService issues, rotates, revokes and authenticates API keys
+type APIKeyService struct {
+	repo          repository.APIKeyStore
+	rotationGrace time.Duration
+	audit         *AuditService
+	timeouts      Timeouts
+	logger        *slog.Logger
+}
+
+// NewAPIKeyService creates a new APIKeyService. Rotated keys keep working for
+// rotationGrace so clients can switch over without downtime. Every change is
+// recorded in audit.
+func NewAPIKeyService(repo repository.APIKeyStore, rotationGrace time.Duration, audit *AuditService, timeouts Timeouts, logger *slog.Logger) *APIKeyService {
+	return &APIKeyService{repo: repo, rotationGrace: rotationGrace, audit: audit, timeouts: timeouts, logger: logger}
+}
+
+// Create issues a key of a tenant with the given scopes. The returned secret
+// is the key itself; it is not stored and cannot be recovered.
+func (s *APIKeyService) Create(ctx context.Context, tenantID, name string, scopes []string) (*models.APIKey, string, error) {
+	if tenantID == "" {
+		return nil, "", fmt.Errorf("tenant ID is required")
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("name is required")
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return nil, "", fmt.Errorf("%w %q", ErrInvalidScope, scope)
+		}
+	}
+
+	secret, prefix, err := auth.GenerateKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &models.APIKey{TenantID: tenantID, Name: name, Prefix: prefix, Scopes: scopes}
+
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, key, auth.HashKey(secret)); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, tenantID, "api_key.create", "api_key", strconv.FormatInt(key.ID, 10), nil, key)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	s.logger.InfoContext(ctx, "Created API key", "tenant_id", tenantID, "api_key_id", key.ID, "name", key.Name, "scopes", key.Scopes)
+	return key, secret, nil
+}
+
+// List returns all keys of a tenant, including revoked ones
+func (s *APIKeyService) List(ctx context.Context, tenantID string) ([]models.APIKey, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	return s.repo.List(ctx, tenantID)
+}
+
+// Rotate issues a replacement for the tenant's key id with the same name and
+// scopes. The old key expires after the rotation grace period.
+func (s *APIKeyService) Rotate(ctx context.Context, tenantID string, id int64) (*models.APIKey, string, error) {
+	secret, prefix, err := auth.GenerateKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &models.APIKey{Prefix: prefix}
+
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	err = s.audit.Transaction(ctx, func(ctx context.Context) error {
+		before, err := s.repo.GetForUpdate(ctx, tenantID, id)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Rotate(ctx, tenantID, id, key, auth.HashKey(secret), s.rotationGrace); err != nil {
+			return err
+		}
+		if err := s.auditChange(ctx, tenantID, "api_key.rotate", before); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, tenantID, "api_key.create", "api_key", strconv.FormatInt(key.ID, 10), nil, key)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	s.logger.InfoContext(ctx, "Rotated API key", "tenant_id", tenantID, "api_key_id", id, "name", key.Name, "new_api_key_id", key.ID, "grace", s.rotationGrace.String())
+	return key, secret, nil
+}
+
+// Revoke revokes the tenant's key id immediately
+func (s *APIKeyService) Revoke(ctx context.Context, tenantID string, id int64) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	err := s.audit.Transaction(ctx, func(ctx context.Context) error {
+		before, err := s.repo.GetForUpdate(ctx, tenantID, id)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Revoke(ctx, tenantID, id); err != nil {
+			return err
+		}
+		return s.auditChange(ctx, tenantID, "api_key.revoke", before)
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.InfoContext(ctx, "Revoked API key", "tenant_id", tenantID, "api_key_id", id)
+	return nil
+}
+
+// auditChange records a change to an existing key, reading the key again for
+// its state after the change. Keys are never deleted, so failing to read it
+// fails the change rather than recording a deletion.
+func (s *APIKeyService) auditChange(ctx context.Context, tenantID, action string, before *models.APIKey) error {
+	after, err := s.repo.Get(ctx, tenantID, before.ID)
+	if err != nil {
+		return fmt.Errorf("read API key for the audit log: %w", err)
+	}
+	return s.audit.Record(ctx, tenantID, action, "api_key", strconv.FormatInt(before.ID, 10), before, after)
+}
+
+// Authenticate returns the active key matching secret and records its use. It
+// returns ErrInvalidAPIKey for unknown, revoked and expired keys.
+func (s *APIKeyService) Authenticate(ctx context.Context, secret string) (*models.APIKey, error) {
+	if !auth.LooksLikeKey(secret) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+
+	key, err := s.repo.GetByHash(ctx, auth.HashKey(secret))
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !key.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		if err := s.repo.TouchLastUsed(ctx, key.ID); err != nil {
+			s.logger.WarnContext(ctx, "Failed to record use of API key", "api_key_id", key.ID, "error", err)
+		}
+	}
+	return key, nil
+}
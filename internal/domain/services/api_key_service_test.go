@@ -0,0 +1,156 @@
+package services
+
+import (
+	"ad-tracking-system/internal/auth"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestAPIKeyService(rotationGrace time.Duration) (*APIKeyService, *repository.MemoryAPIKeyRepository) {
+	repo := repository.NewMemoryAPIKeyRepository()
+	audit := NewAuditService(repository.NewMemoryAuditRepository(), repository.MemoryTransactor{}, Timeouts{}, logging.Discard())
+	return NewAPIKeyService(repo, rotationGrace, audit, Timeouts{}, logging.Discard()), repo
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	service, repo := newTestAPIKeyService(0)
+	key, secret, err := service.Create(ctx, testTenant, "dashboard", []string{auth.ScopeAdsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := service.Authenticate(ctx, secret)
+	if err != nil || got.ID != key.ID || got.TenantID != testTenant {
+		t.Fatalf("Authenticate() = %+v, %v, want key %d", got, err, key.ID)
+	}
+	stored, _ := repo.Get(ctx, testTenant, key.ID)
+	if stored.LastUsedAt == nil {
+		t.Error("Authenticate() did not record the use of the key")
+	}
+
+	unknown, _, err := auth.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, secret := range map[string]string{"malformed": "not-a-key", "unknown": unknown, "empty": ""} {
+		if _, err := service.Authenticate(ctx, secret); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("Authenticate(%s) error = %v, want %v", name, err, ErrInvalidAPIKey)
+		}
+	}
+}
+
+func TestAPIKeyRotate(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newTestAPIKeyService(time.Hour)
+	old, oldSecret, err := service.Create(ctx, testTenant, "dashboard", []string{auth.ScopeAdsRead, auth.ScopeAnalyticsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, secret, err := service.Rotate(ctx, testTenant, old.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Name != old.Name || len(key.Scopes) != 2 || key.RotatedFrom == nil || *key.RotatedFrom != old.ID {
+		t.Errorf("Rotate() = %+v, want the name and scopes of key %d", key, old.ID)
+	}
+	// Both keys work during the grace period
+	for _, s := range []string{oldSecret, secret} {
+		if _, err := service.Authenticate(ctx, s); err != nil {
+			t.Errorf("Authenticate() during the grace period error = %v", err)
+		}
+	}
+
+	if _, _, err := service.Rotate(ctx, "other", key.ID); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+		t.Errorf("Rotate() of another tenant's key error = %v, want %v", err, repository.ErrAPIKeyNotFound)
+	}
+}
+
+func TestAPIKeyRotateRejectsInactiveKeys(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newTestAPIKeyService(0)
+
+	// Without a grace period the rotated key expires at once
+	expired, expiredSecret, err := service.Create(ctx, testTenant, "expired", []string{auth.ScopeAdsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := service.Rotate(ctx, testTenant, expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Authenticate(ctx, expiredSecret); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate() of an expired key error = %v, want %v", err, ErrInvalidAPIKey)
+	}
+	if _, _, err := service.Rotate(ctx, testTenant, expired.ID); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+		t.Errorf("Rotate() of an expired key error = %v, want %v", err, repository.ErrAPIKeyNotFound)
+	}
+
+	revoked, _, err := service.Create(ctx, testTenant, "revoked", []string{auth.ScopeAdsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Revoke(ctx, testTenant, revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := service.Rotate(ctx, testTenant, revoked.ID); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+		t.Errorf("Rotate() of a revoked key error = %v, want %v", err, repository.ErrAPIKeyNotFound)
+	}
+}
+
+func TestAPIKeyRevoke(t *testing.T) {
+	ctx := context.Background()
+	service, repo := newTestAPIKeyService(time.Hour)
+	key, secret, err := service.Create(ctx, testTenant, "dashboard", []string{auth.ScopeAdsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.Revoke(ctx, "other", key.ID); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+		t.Errorf("Revoke() of another tenant's key error = %v, want %v", err, repository.ErrAPIKeyNotFound)
+	}
+	if _, err := service.Authenticate(ctx, secret); err != nil {
+		t.Fatalf("Authenticate() after a rejected revocation error = %v", err)
+	}
+
+	if err := service.Revoke(ctx, testTenant, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Authenticate(ctx, secret); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate() of a revoked key error = %v, want %v", err, ErrInvalidAPIKey)
+	}
+
+	// Revoking again keeps the original revocation time
+	first, _ := repo.Get(ctx, testTenant, key.ID)
+	if err := service.Revoke(ctx, testTenant, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := repo.Get(ctx, testTenant, key.ID)
+	if !second.RevokedAt.Equal(*first.RevokedAt) {
+		t.Errorf("revoked at %s, then %s", first.RevokedAt, second.RevokedAt)
+	}
+}
+
+func TestAPIKeyCreateValidates(t *testing.T) {
+	service, _ := newTestAPIKeyService(0)
+	tests := []struct {
+		name   string
+		tenant string
+		key    string
+		scopes []string
+	}{
+		{"no tenant", "", "dashboard", []string{auth.ScopeAdsRead}},
+		{"no name", testTenant, "", []string{auth.ScopeAdsRead}},
+		{"no scopes", testTenant, "dashboard", nil},
+		{"unknown scope", testTenant, "dashboard", []string{"ads:delete"}},
+	}
+	for _, tt := range tests {
+		if key, _, err := service.Create(context.Background(), tt.tenant, tt.key, tt.scopes); err == nil {
+			t.Errorf("%s: Create() = %+v, want an error", tt.name, key)
+		}
+	}
+}
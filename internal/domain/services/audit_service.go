@@ -0,0 +1,180 @@
+package services
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/repository"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/user"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// Actor is who a change is made by, and from where. It travels in the context
+// of the request or command making the change.
+type Actor struct {
+	ID        string // api_key:<id>, user:<subject>, cli:<user> or job:<name>
+	RequestID string
+	SourceIP  string
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a context whose changes are audited as made by actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFrom returns the actor of ctx, or "unknown" if there is none
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorContextKey{}).(Actor); ok {
+		return actor
+	}
+	return Actor{ID: "unknown"}
+}
+
+// CommandActor is the actor of changes made by an admin command, named after
+// the user running it
+func CommandActor() Actor {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return Actor{ID: "cli:" + name}
+}
+
+// AuditService records changes in the append-only audit log and queries it.
+// A nil AuditService records nothing.
+type AuditService struct {
+	repo     repository.AuditStore
+	tx       repository.TxRunner
+	timeouts Timeouts
+	logger   *slog.Logger
+}
+
+// NewAuditService creates a new AuditService. Changes and their audit events
+// are written together in transactions of tx, which must be on the database
+// of repo.
+func NewAuditService(repo repository.AuditStore, tx repository.TxRunner, timeouts Timeouts, logger *slog.Logger) *AuditService {
+	return &AuditService{repo: repo, tx: tx, timeouts: timeouts, logger: logger}
+}
+
+// Transaction runs fn, which makes a change and records it, in a transaction:
+// the change and its audit event are written together or not at all. fn must
+// read the state before the change with a lock, and use the context it is
+// passed for every call. A nil AuditService runs fn without a transaction.
+func (s *AuditService) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s == nil {
+		return fn(ctx)
+	}
+	return s.tx.InTx(ctx, fn)
+}
+
+// Record logs a change to an entity made by the actor of ctx. before and after
+// are the entity's state around the change, nil for creations and deletions;
+// only the fields that differ are stored. It is called in a Transaction with
+// the change, and an error fails the change.
+func (s *AuditService) Record(ctx context.Context, tenantID, action, entityType, entityID string, before, after interface{}) error {
+	if s == nil {
+		return nil
+	}
+	actor := ActorFrom(ctx)
+	event := &models.AuditEvent{
+		TenantID:   tenantID,
+		Actor:      actor.ID,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		RequestID:  actor.RequestID,
+		SourceIP:   actor.SourceIP,
+	}
+	var err error
+	if event.Before, event.After, err = diff(before, after); err != nil {
+		return fmt.Errorf("diff audit event: %w", err)
+	}
+	if err := s.repo.Append(ctx, event); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to record audit event", "action", action, "entity_type", entityType, "entity_id", entityID, "actor", actor.ID, "error", err)
+		return fmt.Errorf("record audit event: %w", err)
+	}
+	return nil
+}
+
+// List returns a tenant's audit events matching filter, newest first
+func (s *AuditService) List(ctx context.Context, filter repository.AuditFilter) ([]models.AuditEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	return s.repo.List(ctx, filter)
+}
+
+// diff returns the JSON fields of before and after that differ. If either is
+// nil, or they are not JSON objects, both are returned whole.
+func diff(before, after interface{}) (json.RawMessage, json.RawMessage, error) {
+	beforeJSON, err := marshalState(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterJSON, err := marshalState(after)
+	if err != nil {
+		return nil, nil, err
+	}
+	if beforeJSON == nil || afterJSON == nil {
+		return beforeJSON, afterJSON, nil
+	}
+
+	var beforeFields, afterFields map[string]json.RawMessage
+	if json.Unmarshal(beforeJSON, &beforeFields) != nil || json.Unmarshal(afterJSON, &afterFields) != nil {
+		return beforeJSON, afterJSON, nil
+	}
+	changedBefore := make(map[string]json.RawMessage)
+	changedAfter := make(map[string]json.RawMessage)
+	for name, value := range beforeFields {
+		if other, ok := afterFields[name]; !ok || !bytes.Equal(value, other) {
+			changedBefore[name] = value
+			changedAfter[name] = orNull(other)
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changedBefore[name] = orNull(nil)
+			changedAfter[name] = value
+		}
+	}
+
+	if beforeJSON, err = json.Marshal(changedBefore); err != nil {
+		return nil, nil, err
+	}
+	if afterJSON, err = json.Marshal(changedAfter); err != nil {
+		return nil, nil, err
+	}
+	return beforeJSON, afterJSON, nil
+}
+
+func marshalState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+	return data, nil
+}
+
+func orNull(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"ad-tracking-system/internal/auth"
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuditRecordStoresActorAndChangedFields(t *testing.T) {
+	repo := repository.NewMemoryAuditRepository()
+	audit := NewAuditService(repo, repository.MemoryTransactor{}, Timeouts{}, logging.Discard())
+	ctx := WithActor(context.Background(), Actor{ID: "api_key:7", RequestID: "req-1", SourceIP: "203.0.113.7"})
+
+	revokedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	before := &models.APIKey{ID: 3, TenantID: testTenant, Name: "dashboard", Scopes: []string{"ads:read"}}
+	after := *before
+	after.RevokedAt = &revokedAt
+	if err := audit.Record(ctx, testTenant, "api_key.revoke", "api_key", "3", before, &after); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := audit.List(context.Background(), repository.AuditFilter{TenantID: testTenant})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("%d events, want 1", len(events))
+	}
+	event := events[0]
+	if event.Actor != "api_key:7" || event.RequestID != "req-1" || event.SourceIP != "203.0.113.7" || event.Action != "api_key.revoke" {
+		t.Errorf("event = %+v", event)
+	}
+	if string(event.Before) != `{"revoked_at":null}` || string(event.After) != `{"revoked_at":"2024-01-02T03:04:05Z"}` {
+		t.Errorf("before = %s, after = %s, want only revoked_at", event.Before, event.After)
+	}
+}
+
+func TestAuditRecordCreation(t *testing.T) {
+	repo := repository.NewMemoryAuditRepository()
+	audit := NewAuditService(repo, repository.MemoryTransactor{}, Timeouts{}, logging.Discard())
+
+	audit.Record(context.Background(), testTenant, "tenant.create", "tenant", testTenant, nil, &models.Tenant{ID: testTenant, Name: "Acme"})
+
+	events, _ := audit.List(context.Background(), repository.AuditFilter{TenantID: testTenant})
+	if len(events) != 1 || events[0].Before != nil || events[0].Actor != "unknown" {
+		t.Fatalf("events = %+v, want one creation by an unknown actor", events)
+	}
+}
+
+func TestAuditListFilters(t *testing.T) {
+	repo := repository.NewMemoryAuditRepository()
+	audit := NewAuditService(repo, repository.MemoryTransactor{}, Timeouts{}, logging.Discard())
+	alice := WithActor(context.Background(), Actor{ID: "user:alice"})
+	bob := WithActor(context.Background(), Actor{ID: "user:bob"})
+
+	audit.Record(alice, testTenant, "api_key.create", "api_key", "1", nil, map[string]int{"id": 1})
+	audit.Record(bob, testTenant, "api_key.create", "api_key", "2", nil, map[string]int{"id": 2})
+	audit.Record(bob, testTenant, "counters.reconcile", "tenant", testTenant, nil, map[string]int{"rewritten": 10})
+	audit.Record(alice, "other", "api_key.create", "api_key", "3", nil, map[string]int{"id": 3})
+
+	tests := []struct {
+		name   string
+		filter repository.AuditFilter
+		want   []string // Entity IDs, newest first
+	}{
+		{"tenant", repository.AuditFilter{TenantID: testTenant}, []string{testTenant, "2", "1"}},
+		{"entity type", repository.AuditFilter{TenantID: testTenant, EntityType: "api_key"}, []string{"2", "1"}},
+		{"entity", repository.AuditFilter{TenantID: testTenant, EntityType: "api_key", EntityID: "1"}, []string{"1"}},
+		{"actor", repository.AuditFilter{TenantID: testTenant, Actor: "user:bob"}, []string{testTenant, "2"}},
+		{"limit", repository.AuditFilter{TenantID: testTenant, Limit: 1}, []string{testTenant}},
+		{"time range", repository.AuditFilter{TenantID: testTenant, To: time.Now().Add(-time.Hour)}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := audit.List(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, event := range events {
+				got = append(got, event.EntityID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("entities = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("entities = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNilAuditServiceRecordsNothing(t *testing.T) {
+	var audit *AuditService
+	err := audit.Transaction(context.Background(), func(ctx context.Context) error {
+		return audit.Record(ctx, testTenant, "tenant.create", "tenant", testTenant, nil, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failingAuditStore fails every Append
+type failingAuditStore struct {
+	repository.AuditStore
+}
+
+func (failingAuditStore) Append(ctx context.Context, event *models.AuditEvent) error {
+	return errors.New("audit log unavailable")
+}
+
+// unreadableAPIKeyStore fails to read keys back with Get after they were locked
+type unreadableAPIKeyStore struct {
+	repository.APIKeyStore
+}
+
+func (unreadableAPIKeyStore) Get(ctx context.Context, tenantID string, id int64) (*models.APIKey, error) {
+	return nil, errors.New("connection reset")
+}
+
+func TestAuditedChangeFailsWithoutAuditEvent(t *testing.T) {
+	ctx := context.Background()
+	keys := repository.NewMemoryAPIKeyRepository()
+	audit := NewAuditService(failingAuditStore{repository.NewMemoryAuditRepository()}, repository.MemoryTransactor{}, Timeouts{}, logging.Discard())
+	service := NewAPIKeyService(keys, time.Hour, audit, Timeouts{}, logging.Discard())
+
+	if _, _, err := service.Create(ctx, testTenant, "dashboard", []string{auth.ScopeAdsRead}); err == nil {
+		t.Error("Create() succeeded without recording an audit event")
+	}
+	key := &models.APIKey{TenantID: testTenant, Name: "dashboard", Scopes: []string{auth.ScopeAdsRead}}
+	if err := keys.Create(ctx, key, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Revoke(ctx, testTenant, key.ID); err == nil {
+		t.Error("Revoke() succeeded without recording an audit event")
+	}
+	if _, _, err := service.Rotate(ctx, testTenant, key.ID); err == nil {
+		t.Error("Rotate() succeeded without recording an audit event")
+	}
+}
+
+func TestAuditedChangeFailsWhenStateAfterIsUnreadable(t *testing.T) {
+	ctx := context.Background()
+	keys := repository.NewMemoryAPIKeyRepository()
+	auditRepo := repository.NewMemoryAuditRepository()
+	audit := NewAuditService(auditRepo, repository.MemoryTransactor{}, Timeouts{}, logging.Discard())
+	service := NewAPIKeyService(unreadableAPIKeyStore{keys}, time.Hour, audit, Timeouts{}, logging.Discard())
+
+	key := &models.APIKey{TenantID: testTenant, Name: "dashboard", Scopes: []string{auth.ScopeAdsRead}}
+	if err := keys.Create(ctx, key, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Revoke(ctx, testTenant, key.ID); err == nil {
+		t.Fatal("Revoke() succeeded without reading the key back")
+	}
+	// A key that cannot be read back must not be recorded as deleted
+	events, _ := auditRepo.List(ctx, repository.AuditFilter{TenantID: testTenant, Limit: 10})
+	if len(events) != 0 {
+		t.Errorf("events = %+v, want none", events)
+	}
+}
+
+func TestAuditedRevokeRecordsChange(t *testing.T) {
+	ctx := WithActor(context.Background(), Actor{ID: "user:alice"})
+	keys := repository.NewMemoryAPIKeyRepository()
+	auditRepo := repository.NewMemoryAuditRepository()
+	audit := NewAuditService(auditRepo, repository.MemoryTransactor{}, Timeouts{}, logging.Discard())
+	service := NewAPIKeyService(keys, time.Hour, audit, Timeouts{}, logging.Discard())
+
+	key, _, err := service.Create(ctx, testTenant, "dashboard", []string{auth.ScopeAdsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Revoke(ctx, testTenant, key.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	events, _ := auditRepo.List(ctx, repository.AuditFilter{TenantID: testTenant, Limit: 10})
+	if len(events) != 2 || events[0].Action != "api_key.revoke" || events[1].Action != "api_key.create" {
+		t.Fatalf("events = %+v, want a creation and a revocation", events)
+	}
+	if string(events[0].Before) != `{"revoked_at":null}` || events[0].Actor != "user:alice" {
+		t.Errorf("revocation = %+v, want only revoked_at changed by user:alice", events[0])
+	}
+}
@@ -4,115 +4,229 @@ import (
 	"ad-tracking-system/internal/domain/models"
 	"ad-tracking-system/internal/repository"
 	"ad-tracking-system/internal/utils/circuitbreaker"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync/atomic"
+	"time"
 
 	"github.com/sony/gobreaker"
 )
 
+var (
+	// ErrInvalidClick is returned for clicks with missing or invalid fields, or on unknown ads
+	ErrInvalidClick = errors.New("invalid click")
+	// ErrSuspectedFraud is returned when one IP clicks more than is plausible
+	ErrSuspectedFraud = errors.New("rate limit exceeded for IP")
+)
+
+// defaultIPClickLimit is the number of clicks per IP and hour allowed until
+// SetIPClickLimit is called
+const defaultIPClickLimit = 30
+
+// ClickQuota decides whether a tenant may record another click. It is
+// implemented by TenantService.
+type ClickQuota interface {
+	AllowClick(ctx context.Context, tenantID string, now time.Time) error
+	// RefundClick takes back a click allowed at now that was not recorded
+	RefundClick(ctx context.Context, tenantID string, now time.Time)
+}
+
 type ClickService struct {
-	clickRepo     *repository.ClickRepository
-	analyticsRepo *repository.AnalyticsRepository
+	clickRepo     repository.ClickStore
+	analyticsRepo repository.AnalyticsStore
+	rollupRepo    repository.RollupStore
+	quota         ClickQuota
+	timeouts      Timeouts
+	logger        *slog.Logger
 	cb            *gobreaker.CircuitBreaker
+	ipClickLimit  atomic.Int64
 }
 
-func NewClickService(clickRepo *repository.ClickRepository, analyticsRepo *repository.AnalyticsRepository) *ClickService {
-	return &ClickService{
+// NewClickService creates a new ClickService. A nil quota allows unlimited clicks.
+func NewClickService(clickRepo repository.ClickStore, analyticsRepo repository.AnalyticsStore, rollupRepo repository.RollupStore, quota ClickQuota, timeouts Timeouts, logger *slog.Logger) *ClickService {
+	s := &ClickService{
 		clickRepo:     clickRepo,
 		analyticsRepo: analyticsRepo,
-		cb:            circuitbreaker.NewCircuitBreaker("click-service"), // Initialize circuit breaker
+		rollupRepo:    rollupRepo,
+		quota:         quota,
+		timeouts:      timeouts,
+		logger:        logger,
+		cb:            circuitbreaker.NewCircuitBreaker("click-service", logger), // Initialize circuit breaker
 	}
+	s.ipClickLimit.Store(defaultIPClickLimit)
+	return s
+}
+
+// SetIPClickLimit sets the number of clicks per IP and hour above which clicks
+// are refused as suspected fraud. It is safe to call while clicks are recorded.
+func (s *ClickService) SetIPClickLimit(limit int) {
+	s.ipClickLimit.Store(int64(limit))
 }
 
-// AdExists checks if an ad with the given ID exists
-func (s *ClickService) AdExists(adID string) (bool, error) {
-	return s.clickRepo.AdExists(adID)
+// AdExists checks if the tenant has an ad with the given ID
+func (s *ClickService) AdExists(ctx context.Context, tenantID, adID string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	return s.clickRepo.AdExists(ctx, tenantID, adID)
 }
 
-func (s *ClickService) RecordClick(click models.ClickEvent) error {
+func (s *ClickService) RecordClick(ctx context.Context, click models.ClickEvent) error {
 	// Validate required fields
+	if click.TenantID == "" {
+		return fmt.Errorf("%w: tenant ID is required", ErrInvalidClick)
+	}
 	if click.AdID == "" {
-		return fmt.Errorf("ad ID is required")
+		return fmt.Errorf("%w: ad ID is required", ErrInvalidClick)
 	}
 	if click.Timestamp.IsZero() {
-		return fmt.Errorf("invalid timestamp")
+		return fmt.Errorf("%w: invalid timestamp", ErrInvalidClick)
 	}
 	if click.IP == "" {
-		return fmt.Errorf("IP address is required")
+		return fmt.Errorf("%w: IP address is required", ErrInvalidClick)
 	}
 
 	// Validate IP address
 	if !s.clickRepo.IsValidIP(click.IP) {
-		return fmt.Errorf("invalid IP address")
+		return fmt.Errorf("%w: invalid IP address", ErrInvalidClick)
 	}
 
 	// Validate playback time
 	if !s.clickRepo.IsPlaybackTimeValid(click.PlaybackTime) {
-		return fmt.Errorf("invalid playback time: must be between 0 and 3600 seconds")
+		return fmt.Errorf("%w: invalid playback time: must be between 0 and 3600 seconds", ErrInvalidClick)
 	}
 
 	// Check if the adID exists before proceeding
-	adExists, err := s.clickRepo.AdExists(click.AdID)
+	adExists, err := s.AdExists(ctx, click.TenantID, click.AdID)
 	if err != nil {
-		log.Printf("Failed to check if ad exists: %v", err)
+		s.logger.ErrorContext(ctx, "Failed to check if ad exists", "ad_id", click.AdID, "error", err)
 		return err
 	}
 	if !adExists {
-		log.Printf("Ad with ID %s not found", click.AdID)
-		return fmt.Errorf("ad with ID %s not found", click.AdID)
+		s.logger.InfoContext(ctx, "Click on unknown ad", "tenant_id", click.TenantID, "ad_id", click.AdID)
+		return fmt.Errorf("%w: ad with ID %s not found", ErrInvalidClick, click.AdID)
 	}
 
-	
-	
 	// Rate Limiting: Check if the IP has exceeded the allowed number of clicks
-	clickCount, err := s.clickRepo.GetClickCountByIP(click.IP)
+	dbCtx, cancel := withTimeout(ctx, s.timeouts.Database)
+	clickCount, err := s.clickRepo.GetClickCountByIP(dbCtx, click.TenantID, click.IP)
+	cancel()
 	if err != nil {
-		log.Printf("Failed to check click count for IP: %v", err)
+		s.logger.ErrorContext(ctx, "Failed to check click count of IP", "ip", click.IP, "error", err)
 		return err
 	}
-	if clickCount > 30 { // Example: Allow a maximum of 30 clicks per hour per IP
-		log.Printf("Rate limit exceeded for IP %s", click.IP)
-		return fmt.Errorf("rate limit exceeded")
+	if int64(clickCount) > s.ipClickLimit.Load() {
+		s.logger.WarnContext(ctx, "Click rate limit exceeded for IP", "tenant_id", click.TenantID, "ip", click.IP, "clicks", clickCount)
+		return ErrSuspectedFraud
+	}
+
+	// Count the click against the tenant's daily quota. Counting first keeps
+	// concurrent clicks from overshooting it; a click that is not saved is
+	// refunded below.
+	chargedAt := time.Now()
+	if s.quota != nil {
+		if err := s.quota.AllowClick(ctx, click.TenantID, chargedAt); err != nil {
+			s.logger.InfoContext(ctx, "Click refused by tenant quota", "tenant_id", click.TenantID, "error", err)
+			return err
+		}
 	}
 
-	
 	// Wrap database operation with circuit breaker
-	_, err = s.cb.Execute(func() (interface{}, error) {
-		if err := s.clickRepo.Save(click); err != nil {
+	_, err = circuitbreaker.Execute(ctx, s.cb, func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+		defer cancel()
+		if err := s.clickRepo.Save(ctx, click); err != nil {
 			return nil, err
 		}
 		return nil, nil
 	})
 	if err != nil {
-		log.Printf("Failed to record click (circuit breaker): %v", err)
+		s.logger.ErrorContext(ctx, "Failed to record click", "ad_id", click.AdID, "error", err)
+		if s.quota != nil {
+			s.quota.RefundClick(ctx, click.TenantID, chargedAt)
+		}
 		return err
 	}
 
-	// Wrap Redis operation with circuit breaker
-	_, err = s.cb.Execute(func() (interface{}, error) {
-		if err := s.analyticsRepo.IncrementClickCount(click.AdID); err != nil {
+	// Wrap Redis operation with circuit breaker. The click is stored by now, so
+	// the counter is updated even if the client has gone away.
+	_, err = circuitbreaker.Execute(ctx, s.cb, func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := withTimeout(context.WithoutCancel(ctx), s.timeouts.Cache)
+		defer cancel()
+		if err := s.analyticsRepo.IncrementClickCount(ctx, click.TenantID, click.AdID); err != nil {
 			return nil, err
 		}
 		return nil, nil
 	})
 	if err != nil {
-		log.Printf("Failed to update analytics (circuit breaker): %v", err)
+		s.logger.ErrorContext(ctx, "Failed to update click count", "ad_id", click.AdID, "error", err)
 		return err
 	}
 
-	log.Printf("Click recorded successfully for ad %s from IP %s", click.AdID, click.IP)
+	s.logger.DebugContext(ctx, "Recorded click", "tenant_id", click.TenantID, "ad_id", click.AdID, "ip", click.IP)
 	return nil
 }
 
-func (s *ClickService) GetClickCount(adID string) (int64, error) {
+// GetClickCount returns the total click count for a tenant's ad. Redis is only
+// a hot cache; on a miss or a Redis error the count is read from the Postgres
+// rollups.
+func (s *ClickService) GetClickCount(ctx context.Context, tenantID, adID string) (int64, error) {
 	// Wrap Redis operation with circuit breaker
-	result, err := s.cb.Execute(func() (interface{}, error) {
-		return s.analyticsRepo.GetClickCount(adID)
+	result, err := circuitbreaker.Execute(ctx, s.cb, func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := withTimeout(ctx, s.timeouts.Cache)
+		defer cancel()
+		count, cached, err := s.analyticsRepo.GetClickCount(ctx, tenantID, adID)
+		if err != nil || !cached {
+			return nil, err
+		}
+		return count, nil
 	})
 	if err != nil {
-		log.Printf("Failed to get click count (circuit breaker): %v", err)
+		s.logger.WarnContext(ctx, "Failed to get cached click count, falling back to Postgres", "ad_id", adID, "error", err)
+	}
+	if count, ok := result.(int64); ok {
+		return count, nil
+	}
+
+	// Wrap database operation with circuit breaker
+	result, err = circuitbreaker.Execute(ctx, s.cb, func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+		defer cancel()
+		return s.rollupRepo.GetTotalClickCount(ctx, tenantID, adID)
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to get click count", "ad_id", adID, "error", err)
 		return 0, err
 	}
+	count := result.(int64)
+
+	cacheCtx, cancel := withTimeout(ctx, s.timeouts.Cache)
+	defer cancel()
+	if err := s.analyticsRepo.CacheClickCount(cacheCtx, tenantID, adID, count); err != nil {
+		s.logger.WarnContext(ctx, "Failed to cache click count", "ad_id", adID, "error", err)
+	}
+	return count, nil
+}
+
+// GetClickSeries returns the hourly or daily click counts of a tenant's ad in [from, to)
+func (s *ClickService) GetClickSeries(ctx context.Context, tenantID, adID, granularity string, from, to time.Time) ([]repository.RollupBucket, error) {
+	result, err := circuitbreaker.Execute(ctx, s.cb, func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+		defer cancel()
+		switch granularity {
+		case "hour":
+			return s.rollupRepo.GetHourlyClicks(ctx, tenantID, adID, from, to)
+		case "day":
+			return s.rollupRepo.GetDailyClicks(ctx, tenantID, adID, from, to)
+		default:
+			return nil, fmt.Errorf("unknown granularity %q", granularity)
+		}
+	})
+	if err != nil {
+		s.logger.ErrorContext(ctx, "Failed to get click series", "ad_id", adID, "granularity", granularity, "error", err)
+		return nil, err
+	}
 
-	return result.(int64), nil
+	return result.([]repository.RollupBucket), nil
 }
@@ -0,0 +1,395 @@
+package services
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// failingSaveStore fails every Save with err and counts the attempts
+type failingSaveStore struct {
+	*repository.MemoryClickRepository
+	err   error
+	saves int
+}
+
+func (s *failingSaveStore) Save(ctx context.Context, click models.ClickEvent) error {
+	s.saves++
+	return s.err
+}
+
+// slowSaveStore blocks every Save until its context is done
+type slowSaveStore struct {
+	*repository.MemoryClickRepository
+}
+
+func (s *slowSaveStore) Save(ctx context.Context, click models.ClickEvent) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type clickServiceFixture struct {
+	service   *ClickService
+	clicks    *repository.MemoryClickRepository
+	analytics *repository.MemoryAnalyticsRepository
+}
+
+func newClickServiceFixture(t *testing.T) *clickServiceFixture {
+	t.Helper()
+	ads := repository.NewMemoryAdRepository()
+	if err := ads.Seed(context.Background(), testTenant); err != nil {
+		t.Fatalf("seed ads: %v", err)
+	}
+	clicks := repository.NewMemoryClickRepository(ads)
+	analytics := repository.NewMemoryAnalyticsRepository()
+	return &clickServiceFixture{
+		service:   NewClickService(clicks, analytics, clicks, nil, Timeouts{}, logging.Discard()),
+		clicks:    clicks,
+		analytics: analytics,
+	}
+}
+
+// testTenant is the tenant the fixture's ads are seeded for
+const testTenant = "acme"
+
+func validClick() models.ClickEvent {
+	return models.ClickEvent{
+		TenantID:     testTenant,
+		AdID:         "1",
+		Timestamp:    time.Now(),
+		IP:           "203.0.113.7",
+		PlaybackTime: 42,
+	}
+}
+
+func TestRecordClickStoresClickAndIncrementsCachedCount(t *testing.T) {
+	f := newClickServiceFixture(t)
+	if err := f.analytics.CacheClickCount(context.Background(), testTenant, "1", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	click := validClick()
+	if err := f.service.RecordClick(context.Background(), click); err != nil {
+		t.Fatalf("RecordClick() error = %v", err)
+	}
+
+	stored := f.clicks.Clicks()
+	if len(stored) != 1 || stored[0] != click {
+		t.Fatalf("stored clicks = %+v, want [%+v]", stored, click)
+	}
+	count, cached, _ := f.analytics.GetClickCount(context.Background(), testTenant, "1")
+	if !cached || count != 6 {
+		t.Errorf("cached count = %d (cached %v), want 6", count, cached)
+	}
+}
+
+func TestRecordClickDoesNotCacheUncachedCount(t *testing.T) {
+	f := newClickServiceFixture(t)
+
+	if err := f.service.RecordClick(context.Background(), validClick()); err != nil {
+		t.Fatalf("RecordClick() error = %v", err)
+	}
+
+	// A missing counter is loaded from Postgres on read, never restarted from zero
+	if _, cached, _ := f.analytics.GetClickCount(context.Background(), testTenant, "1"); cached {
+		t.Error("click count was cached by RecordClick")
+	}
+}
+
+func TestRecordClickValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*models.ClickEvent)
+		wantErr string
+	}{
+		{"missing tenant ID", func(c *models.ClickEvent) { c.TenantID = "" }, "tenant ID is required"},
+		{"missing ad ID", func(c *models.ClickEvent) { c.AdID = "" }, "ad ID is required"},
+		{"missing timestamp", func(c *models.ClickEvent) { c.Timestamp = time.Time{} }, "invalid timestamp"},
+		{"missing IP", func(c *models.ClickEvent) { c.IP = "" }, "IP address is required"},
+		{"invalid IP", func(c *models.ClickEvent) { c.IP = "not-an-ip" }, "invalid IP address"},
+		{"negative playback time", func(c *models.ClickEvent) { c.PlaybackTime = -1 }, "invalid playback time"},
+		{"playback time over an hour", func(c *models.ClickEvent) { c.PlaybackTime = 3601 }, "invalid playback time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newClickServiceFixture(t)
+			click := validClick()
+			tt.modify(&click)
+
+			err := f.service.RecordClick(context.Background(), click)
+			if !errors.Is(err, ErrInvalidClick) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("RecordClick() error = %v, want %q", err, tt.wantErr)
+			}
+			if n := len(f.clicks.Clicks()); n != 0 {
+				t.Errorf("%d clicks stored, want 0", n)
+			}
+		})
+	}
+}
+
+func TestRecordClickAcceptsBoundaryValues(t *testing.T) {
+	for _, click := range []models.ClickEvent{
+		{TenantID: testTenant, AdID: "1", Timestamp: time.Now(), IP: "2001:db8::1", PlaybackTime: 0},
+		{TenantID: testTenant, AdID: "1", Timestamp: time.Now(), IP: "198.51.100.1", PlaybackTime: 3600},
+	} {
+		f := newClickServiceFixture(t)
+		if err := f.service.RecordClick(context.Background(), click); err != nil {
+			t.Errorf("RecordClick(%+v) error = %v", click, err)
+		}
+	}
+}
+
+func TestRecordClickMissingAd(t *testing.T) {
+	f := newClickServiceFixture(t)
+	click := validClick()
+	click.AdID = "does-not-exist"
+
+	err := f.service.RecordClick(context.Background(), click)
+	if !errors.Is(err, ErrInvalidClick) || !strings.Contains(err.Error(), "ad with ID does-not-exist not found") {
+		t.Fatalf("RecordClick() error = %v, want ad not found", err)
+	}
+	if n := len(f.clicks.Clicks()); n != 0 {
+		t.Errorf("%d clicks stored, want 0", n)
+	}
+}
+
+func TestRecordClickAdLookupError(t *testing.T) {
+	f := newClickServiceFixture(t)
+	dbErr := errors.New("connection refused")
+	f.clicks.SetError(dbErr)
+
+	if err := f.service.RecordClick(context.Background(), validClick()); !errors.Is(err, dbErr) {
+		t.Fatalf("RecordClick() error = %v, want %v", err, dbErr)
+	}
+}
+
+func TestRecordClickRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		recent      int
+		old         int
+		wantLimited bool
+	}{
+		{"under the limit", 29, 0, false},
+		{"at the limit", 30, 0, false},
+		{"over the limit", 31, 0, true},
+		{"clicks older than an hour are not counted", 10, 50, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newClickServiceFixture(t)
+			click := validClick()
+			for i := 0; i < tt.recent; i++ {
+				prior := click
+				prior.Timestamp = time.Now().Add(-time.Duration(i+1) * time.Minute)
+				f.clicks.Save(context.Background(), prior)
+			}
+			for i := 0; i < tt.old; i++ {
+				prior := click
+				prior.Timestamp = time.Now().Add(-2 * time.Hour)
+				f.clicks.Save(context.Background(), prior)
+			}
+
+			err := f.service.RecordClick(context.Background(), click)
+			limited := errors.Is(err, ErrSuspectedFraud)
+			if limited != tt.wantLimited {
+				t.Fatalf("RecordClick() error = %v, want rate limited %v", err, tt.wantLimited)
+			}
+			if err != nil && !limited {
+				t.Fatalf("RecordClick() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRecordClickRateLimitIsPerIP(t *testing.T) {
+	f := newClickServiceFixture(t)
+	for i := 0; i < 40; i++ {
+		f.clicks.Save(context.Background(), validClick())
+	}
+
+	click := validClick()
+	click.IP = "198.51.100.99"
+	if err := f.service.RecordClick(context.Background(), click); err != nil {
+		t.Fatalf("RecordClick() from another IP error = %v", err)
+	}
+}
+
+func TestRecordClickIsolatesTenants(t *testing.T) {
+	f := newClickServiceFixture(t)
+	for i := 0; i < 40; i++ {
+		f.clicks.Save(context.Background(), validClick())
+	}
+
+	// Another tenant has no ad 1
+	other := validClick()
+	other.TenantID = "other"
+	err := f.service.RecordClick(context.Background(), other)
+	if err == nil || !strings.Contains(err.Error(), "ad with ID 1 not found") {
+		t.Fatalf("RecordClick() for another tenant error = %v, want ad not found", err)
+	}
+
+	// Once it has, clicks from an IP that is over the limit for testTenant are
+	// counted apart
+	ads := repository.NewMemoryAdRepository()
+	ads.Seed(context.Background(), "other")
+	clicks := repository.NewMemoryClickRepository(ads)
+	for i := 0; i < 40; i++ {
+		clicks.Save(context.Background(), validClick())
+	}
+	service := NewClickService(clicks, repository.NewMemoryAnalyticsRepository(), clicks, nil, Timeouts{}, logging.Discard())
+	if err := service.RecordClick(context.Background(), other); err != nil {
+		t.Fatalf("RecordClick() for another tenant error = %v", err)
+	}
+	if count, _ := clicks.GetTotalClickCount(context.Background(), testTenant, "1"); count != 40 {
+		t.Errorf("click count of %s = %d, want 40", testTenant, count)
+	}
+}
+
+func TestRecordClickQuota(t *testing.T) {
+	ads := repository.NewMemoryAdRepository()
+	ads.Seed(context.Background(), testTenant)
+	clicks := repository.NewMemoryClickRepository(ads)
+	tenants := NewTenantService(
+		repository.NewMemoryTenantRepository(models.Tenant{ID: testTenant, Name: "Acme", ClicksPerDay: 3}),
+		repository.NewMemoryQuotaRepository(),
+		nil,
+		Timeouts{},
+		logging.Discard(),
+	)
+	service := NewClickService(clicks, repository.NewMemoryAnalyticsRepository(), clicks, tenants, Timeouts{}, logging.Discard())
+
+	for i := 1; i <= 3; i++ {
+		if err := service.RecordClick(context.Background(), validClick()); err != nil {
+			t.Fatalf("click %d: RecordClick() error = %v", i, err)
+		}
+	}
+	if err := service.RecordClick(context.Background(), validClick()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("RecordClick() over quota error = %v, want %v", err, ErrQuotaExceeded)
+	}
+	if n := len(clicks.Clicks()); n != 3 {
+		t.Errorf("%d clicks stored, want 3", n)
+	}
+}
+
+func TestRecordClickRefundsQuotaOnFailedSave(t *testing.T) {
+	ads := repository.NewMemoryAdRepository()
+	ads.Seed(context.Background(), testTenant)
+	store := &failingSaveStore{MemoryClickRepository: repository.NewMemoryClickRepository(ads), err: errors.New("database is down")}
+	tenants := NewTenantService(
+		repository.NewMemoryTenantRepository(models.Tenant{ID: testTenant, Name: "Acme", ClicksPerDay: 2}),
+		repository.NewMemoryQuotaRepository(),
+		nil,
+		Timeouts{},
+		logging.Discard(),
+	)
+	service := NewClickService(store, repository.NewMemoryAnalyticsRepository(), store, tenants, Timeouts{}, logging.Discard())
+
+	// Fewer failures than trip the breaker
+	for i := 1; i <= 3; i++ {
+		if err := service.RecordClick(context.Background(), validClick()); !errors.Is(err, store.err) {
+			t.Fatalf("attempt %d: RecordClick() error = %v, want %v", i, err, store.err)
+		}
+	}
+
+	// The failed clicks used none of the quota
+	store.err = nil
+	for i := 1; i <= 2; i++ {
+		if err := service.RecordClick(context.Background(), validClick()); err != nil {
+			t.Fatalf("click %d after the failures: RecordClick() error = %v", i, err)
+		}
+	}
+	if err := service.RecordClick(context.Background(), validClick()); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("RecordClick() over quota error = %v, want %v", err, ErrQuotaExceeded)
+	}
+}
+
+func TestRecordClickBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	ads := repository.NewMemoryAdRepository()
+	ads.Seed(context.Background(), testTenant)
+	saveErr := errors.New("database is down")
+	store := &failingSaveStore{MemoryClickRepository: repository.NewMemoryClickRepository(ads), err: saveErr}
+	service := NewClickService(store, repository.NewMemoryAnalyticsRepository(), store, nil, Timeouts{}, logging.Discard())
+
+	// The breaker trips after more than 5 consecutive failures
+	for i := 1; i <= 6; i++ {
+		if err := service.RecordClick(context.Background(), validClick()); !errors.Is(err, saveErr) {
+			t.Fatalf("attempt %d: RecordClick() error = %v, want %v", i, err, saveErr)
+		}
+	}
+
+	err := service.RecordClick(context.Background(), validClick())
+	if !errors.Is(err, gobreaker.ErrOpenState) {
+		t.Fatalf("RecordClick() with open breaker error = %v, want %v", err, gobreaker.ErrOpenState)
+	}
+	if store.saves != 6 {
+		t.Errorf("Save called %d times, want 6: an open breaker must not reach the database", store.saves)
+	}
+}
+
+func TestRecordClickBreakerStaysClosedOnValidationErrors(t *testing.T) {
+	f := newClickServiceFixture(t)
+	invalid := validClick()
+	invalid.IP = "not-an-ip"
+	for i := 0; i < 10; i++ {
+		f.service.RecordClick(context.Background(), invalid)
+	}
+
+	if err := f.service.RecordClick(context.Background(), validClick()); err != nil {
+		t.Fatalf("RecordClick() after validation errors error = %v", err)
+	}
+}
+
+func TestRecordClickAnalyticsFailure(t *testing.T) {
+	f := newClickServiceFixture(t)
+	redisErr := errors.New("redis is down")
+	f.analytics.SetError(redisErr)
+
+	if err := f.service.RecordClick(context.Background(), validClick()); !errors.Is(err, redisErr) {
+		t.Fatalf("RecordClick() error = %v, want %v", err, redisErr)
+	}
+	// The click is already stored (and in the outbox) when the cache update fails
+	if n := len(f.clicks.Clicks()); n != 1 {
+		t.Errorf("%d clicks stored, want 1", n)
+	}
+}
+
+func TestRecordClickCancelledContext(t *testing.T) {
+	f := newClickServiceFixture(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Cancelled requests must not trip the breaker for everyone else
+	for i := 0; i < 10; i++ {
+		if err := f.service.RecordClick(ctx, validClick()); !errors.Is(err, context.Canceled) {
+			t.Fatalf("RecordClick() error = %v, want %v", err, context.Canceled)
+		}
+	}
+	if n := len(f.clicks.Clicks()); n != 0 {
+		t.Errorf("%d clicks stored, want 0", n)
+	}
+
+	if err := f.service.RecordClick(context.Background(), validClick()); err != nil {
+		t.Fatalf("RecordClick() after cancelled requests error = %v", err)
+	}
+}
+
+func TestRecordClickDatabaseTimeout(t *testing.T) {
+	ads := repository.NewMemoryAdRepository()
+	ads.Seed(context.Background(), testTenant)
+	store := &slowSaveStore{MemoryClickRepository: repository.NewMemoryClickRepository(ads)}
+	service := NewClickService(store, repository.NewMemoryAnalyticsRepository(), store, nil, Timeouts{Database: 10 * time.Millisecond}, logging.Discard())
+
+	if err := service.RecordClick(context.Background(), validClick()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("RecordClick() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"log/slog"
+	"sort"
+)
+
+// ReconciliationService compares the Redis click counters with Postgres and repairs them
+type ReconciliationService struct {
+	rollupRepo    repository.RollupStore
+	analyticsRepo repository.AnalyticsStore
+	audit         *AuditService
+	timeouts      Timeouts
+	logger        *slog.Logger
+}
+
+// NewReconciliationService creates a new ReconciliationService. Rewrites of
+// the counters are recorded in audit.
+func NewReconciliationService(rollupRepo repository.RollupStore, analyticsRepo repository.AnalyticsStore, audit *AuditService, timeouts Timeouts, logger *slog.Logger) *ReconciliationService {
+	return &ReconciliationService{
+		rollupRepo:    rollupRepo,
+		analyticsRepo: analyticsRepo,
+		audit:         audit,
+		timeouts:      timeouts,
+		logger:        logger,
+	}
+}
+
+// Reconcile recomputes the click count of every ad of a tenant from Postgres
+// and reports the counters that drifted. Unless dryRun is set, the tenant's
+// counters are then rewritten from the recomputed counts in one Redis
+// transaction.
+func (s *ReconciliationService) Reconcile(ctx context.Context, tenantID string, dryRun bool) (*models.ReconciliationReport, error) {
+	dbCtx, cancel := withTimeout(ctx, s.timeouts.Database)
+	expected, err := s.rollupRepo.GetTotalClickCounts(dbCtx, tenantID)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	adIDs := make([]string, 0, len(expected))
+	for adID := range expected {
+		adIDs = append(adIDs, adID)
+	}
+	sort.Strings(adIDs)
+
+	cacheCtx, cancel := withTimeout(ctx, s.timeouts.Cache)
+	cached, err := s.analyticsRepo.GetClickCounts(cacheCtx, tenantID, adIDs)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ReconciliationReport{
+		TenantID:   tenantID,
+		DryRun:     dryRun,
+		AdsChecked: len(adIDs),
+		Drifts:     []models.CounterDrift{},
+	}
+	for _, adID := range adIDs {
+		count, ok := cached[adID]
+		if !ok {
+			report.AdsUncached++
+			continue
+		}
+		drift := count - expected[adID]
+		if drift == 0 {
+			continue
+		}
+		report.Drifts = append(report.Drifts, models.CounterDrift{
+			AdID:     adID,
+			Expected: expected[adID],
+			Cached:   count,
+			Drift:    drift,
+		})
+		if drift < 0 {
+			drift = -drift
+		}
+		report.TotalDrift += drift
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	// Redis is not part of the transaction, so the audit event is written
+	// first: it is rolled back if the rewrite fails, and the request fails if
+	// the commit does
+	report.Rewritten = len(expected)
+	dbCtx, cancel = withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	err = s.audit.Transaction(dbCtx, func(dbCtx context.Context) error {
+		if err := s.audit.Record(dbCtx, tenantID, "counters.reconcile", "tenant", tenantID, nil, report); err != nil {
+			return err
+		}
+		cacheCtx, cancel := withTimeout(ctx, s.timeouts.Cache)
+		defer cancel()
+		return s.analyticsRepo.SetClickCounts(cacheCtx, tenantID, expected)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "Rewrote click counters", "tenant_id", tenantID, "rewritten", report.Rewritten, "drifted", len(report.Drifts), "total_drift", report.TotalDrift)
+
+	return report, nil
+}
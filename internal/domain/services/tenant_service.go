@@ -0,0 +1,182 @@
+package services
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// tenantCacheTTL is how long quotas are cached, so that rate limiting does
+// not cost a Postgres query on every request
+const tenantCacheTTL = time.Minute
+
+var (
+	// ErrRateLimited is returned when a tenant exceeds its requests per minute
+	ErrRateLimited = errors.New("tenant rate limit exceeded")
+	// ErrQuotaExceeded is returned when a tenant exceeds its clicks per day
+	ErrQuotaExceeded = errors.New("tenant click quota exceeded")
+	// ErrInvalidTenant is returned when creating a tenant with invalid fields
+	ErrInvalidTenant = errors.New("invalid tenant")
+)
+
+// tenantIDPattern keeps tenant IDs safe to embed in Redis keys and click tokens
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,35}$`)
+
+type cachedTenant struct {
+	tenant  *models.Tenant
+	expires time.Time
+}
+
+// TenantService manages tenants and enforces their quotas. Quota checks fail
+// open: if Postgres or Redis cannot be reached, the request is let through.
+type TenantService struct {
+	tenants  repository.TenantStore
+	quotas   repository.QuotaStore
+	audit    *AuditService
+	timeouts Timeouts
+	logger   *slog.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedTenant
+}
+
+// NewTenantService creates a new TenantService. New tenants are recorded in audit.
+func NewTenantService(tenants repository.TenantStore, quotas repository.QuotaStore, audit *AuditService, timeouts Timeouts, logger *slog.Logger) *TenantService {
+	return &TenantService{
+		tenants:  tenants,
+		quotas:   quotas,
+		audit:    audit,
+		timeouts: timeouts,
+		logger:   logger,
+		cache:    make(map[string]cachedTenant),
+	}
+}
+
+// Create stores a new tenant
+func (s *TenantService) Create(ctx context.Context, tenant *models.Tenant) error {
+	if !tenantIDPattern.MatchString(tenant.ID) {
+		return fmt.Errorf("%w: ID must be 1-36 lowercase letters, digits, '-' or '_'", ErrInvalidTenant)
+	}
+	if tenant.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTenant)
+	}
+	if tenant.RequestsPerMinute < 0 || tenant.ClicksPerDay < 0 {
+		return fmt.Errorf("%w: quotas must not be negative", ErrInvalidTenant)
+	}
+
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	err := s.audit.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.tenants.Create(ctx, tenant); err != nil {
+			return err
+		}
+		return s.audit.Record(ctx, tenant.ID, "tenant.create", "tenant", tenant.ID, nil, tenant)
+	})
+	if err != nil {
+		return err
+	}
+	s.logger.InfoContext(ctx, "Created tenant", "tenant_id", tenant.ID, "name", tenant.Name)
+	return nil
+}
+
+// Get returns a tenant, possibly from a cache up to a minute old
+func (s *TenantService) Get(ctx context.Context, id string) (*models.Tenant, error) {
+	now := time.Now()
+	s.mu.Lock()
+	cached, ok := s.cache[id]
+	s.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.tenant, nil
+	}
+
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	tenant, err := s.tenants.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[id] = cachedTenant{tenant: tenant, expires: now.Add(tenantCacheTTL)}
+	s.mu.Unlock()
+	return tenant, nil
+}
+
+// List returns all tenants
+func (s *TenantService) List(ctx context.Context) ([]models.Tenant, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Database)
+	defer cancel()
+	return s.tenants.List(ctx)
+}
+
+// AllowRequest counts an API request of a tenant and returns ErrRateLimited
+// once the tenant is over its requests per minute
+func (s *TenantService) AllowRequest(ctx context.Context, tenantID string) error {
+	tenant, err := s.Get(ctx, tenantID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to get tenant, not rate limiting", "tenant_id", tenantID, "error", err)
+		return nil
+	}
+	if tenant.RequestsPerMinute <= 0 {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, s.timeouts.Cache)
+	defer cancel()
+	count, err := s.quotas.IncrementRequests(ctx, tenantID, time.Now())
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to count request of tenant, not rate limiting", "tenant_id", tenantID, "error", err)
+		return nil
+	}
+	if count > int64(tenant.RequestsPerMinute) {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// AllowClick counts a click of a tenant at now and returns ErrQuotaExceeded
+// once the tenant is over its clicks per day
+func (s *TenantService) AllowClick(ctx context.Context, tenantID string, now time.Time) error {
+	tenant, err := s.Get(ctx, tenantID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to get tenant, not enforcing click quota", "tenant_id", tenantID, "error", err)
+		return nil
+	}
+	if tenant.ClicksPerDay <= 0 {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, s.timeouts.Cache)
+	defer cancel()
+	count, err := s.quotas.IncrementClicks(ctx, tenantID, now)
+	if err != nil {
+		s.logger.WarnContext(ctx, "Failed to count click of tenant, not enforcing click quota", "tenant_id", tenantID, "error", err)
+		return nil
+	}
+	if count > tenant.ClicksPerDay {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// RefundClick takes back a click allowed by AllowClick at now that could not
+// be recorded. It runs even if ctx is cancelled, since that is often why the
+// click failed.
+func (s *TenantService) RefundClick(ctx context.Context, tenantID string, now time.Time) {
+	tenant, err := s.Get(ctx, tenantID)
+	if err != nil || tenant.ClicksPerDay <= 0 {
+		return
+	}
+
+	ctx, cancel := withTimeout(context.WithoutCancel(ctx), s.timeouts.Cache)
+	defer cancel()
+	if err := s.quotas.DecrementClicks(ctx, tenantID, now); err != nil {
+		s.logger.WarnContext(ctx, "Failed to refund click of tenant", "tenant_id", tenantID, "error", err)
+	}
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bounds each repository call made by a service. A zero timeout adds
+// no deadline beyond the caller's context.
+type Timeouts struct {
+	Database time.Duration // Postgres queries
+	Cache    time.Duration // Redis commands
+}
+
+// withTimeout derives a context for one repository call
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,252 @@
+package aggregator
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/events/schema"
+	"ad-tracking-system/internal/messaging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Config controls the click aggregator
+type Config struct {
+	Brokers        []string
+	GroupID        string
+	ClickTopic     string
+	AggregateTopic string
+	Window         time.Duration // Size of the tumbling windows clicks are counted in
+	FlushInterval  time.Duration // How often counts are published and offsets committed
+	MaxBatch       int           // Clicks after which counts are flushed early
+}
+
+// Aggregator counts clicks per ad and window and publishes the counts to the
+// aggregate topic. The counts and the consumed offsets are committed in the
+// same Kafka transaction, so every click is counted exactly once even across
+// crashes and rebalances.
+type Aggregator struct {
+	cfg    Config
+	serde  *schema.ClickEventSerde
+	group  sarama.ConsumerGroup
+	sarama *sarama.Config
+	logger *slog.Logger
+}
+
+// New creates a new Aggregator
+func New(cfg Config, serde *schema.ClickEventSerde, logger *slog.Logger) (*Aggregator, error) {
+	config := sarama.NewConfig()
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.Offsets.AutoCommit.Enable = false // Offsets are committed in the transaction
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Successes = true
+	config.Net.MaxOpenRequests = 1
+
+	group, err := sarama.NewConsumerGroup(cfg.Brokers, cfg.GroupID, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Aggregator{cfg: cfg, serde: serde, group: group, sarama: config, logger: logger}, nil
+}
+
+// Run aggregates until ctx is cancelled
+func (a *Aggregator) Run(ctx context.Context) error {
+	for {
+		if err := a.group.Consume(ctx, []string{a.cfg.ClickTopic}, a); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return nil
+			}
+			a.logger.WarnContext(ctx, "Click aggregator session ended", "error", err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Close shuts down the consumer group
+func (a *Aggregator) Close() error {
+	return a.group.Close()
+}
+
+// Setup is called at the start of a consumer group session
+func (a *Aggregator) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+// Cleanup is called at the end of a consumer group session
+func (a *Aggregator) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim aggregates one partition of the click topic. Each partition gets
+// its own transactional producer whose ID is derived from the partition, so a
+// zombie instance still processing it after a rebalance is fenced off.
+func (a *Aggregator) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	config := *a.sarama
+	config.Producer.Transaction.ID = fmt.Sprintf("%s-%s-%d", a.cfg.GroupID, claim.Topic(), claim.Partition())
+	producer, err := sarama.NewSyncProducer(a.cfg.Brokers, &config)
+	if err != nil {
+		return err
+	}
+	defer producer.Close()
+
+	w := &window{
+		size:   a.cfg.Window,
+		topic:  claim.Topic(),
+		part:   claim.Partition(),
+		counts: make(map[windowKey]int64),
+	}
+
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return a.flush(session, producer, w)
+			}
+			ctx, span := messaging.StartKafkaConsumerSpan(session.Context(), msg)
+			a.add(ctx, w, msg)
+			span.End()
+			messaging.RecordConsumerLag(a.cfg.GroupID, claim, msg)
+			if w.clicks >= a.cfg.MaxBatch {
+				if err := a.flush(session, producer, w); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := a.flush(session, producer, w); err != nil {
+				return err
+			}
+		case <-session.Context().Done():
+			// Unflushed counts are dropped; their offsets were not committed either
+			return nil
+		}
+	}
+}
+
+func (a *Aggregator) add(ctx context.Context, w *window, msg *sarama.ConsumerMessage) {
+	if w.empty() {
+		w.first = msg.Offset
+	}
+	w.last = msg.Offset
+	w.messages++
+
+	envelope := messaging.NewKafkaEnvelope(msg)
+	if envelope.EventType != "" && envelope.EventType != schema.ClickEventType {
+		return
+	}
+	click, err := a.serde.Decode(envelope.Value)
+	if err != nil {
+		a.logger.WarnContext(ctx, "Skipping undecodable click", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		return
+	}
+
+	ts := click.Timestamp
+	if ts.IsZero() {
+		ts = msg.Timestamp
+	}
+	start := ts.UTC().Truncate(w.size)
+	w.counts[windowKey{tenantID: click.TenantID, adID: click.AdID, start: start.Unix()}]++
+	w.clicks++
+}
+
+// flush publishes the counts and commits the offsets of w in one transaction
+func (a *Aggregator) flush(session sarama.ConsumerGroupSession, producer sarama.SyncProducer, w *window) error {
+	if w.empty() {
+		return nil
+	}
+
+	batch := w.batch()
+	value, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+
+	if err := producer.BeginTxn(); err != nil {
+		return err
+	}
+	_, _, err = producer.SendMessage(messaging.NewProducerMessage(a.cfg.AggregateTopic, messaging.Message{
+		Key:   strconv.Itoa(int(w.part)),
+		Value: value,
+		Headers: map[string]string{
+			messaging.HeaderEventType: "click-aggregate",
+		},
+	}))
+	if err == nil {
+		err = producer.AddOffsetsToTxn(map[string][]*sarama.PartitionOffsetMetadata{
+			w.topic: {{Partition: w.part, Offset: w.last + 1}},
+		}, a.cfg.GroupID)
+	}
+	if err == nil {
+		err = producer.CommitTxn()
+	}
+	if err != nil {
+		if abortErr := producer.AbortTxn(); abortErr != nil {
+			a.logger.ErrorContext(session.Context(), "Failed to abort click aggregate transaction", "error", abortErr)
+		}
+		// Returning ends the claim; it restarts from the last committed offset
+		return fmt.Errorf("commit click aggregates for %s/%d: %w", w.topic, w.part, err)
+	}
+
+	a.logger.InfoContext(session.Context(), "Committed click aggregates", "clicks", w.clicks, "windows", len(batch.Counts),
+		"topic", w.topic, "partition", w.part, "first_offset", batch.FirstOffset, "last_offset", batch.LastOffset)
+	w.reset()
+	return nil
+}
+
+type windowKey struct {
+	tenantID string
+	adID     string
+	start    int64
+}
+
+// window accumulates counts for a range of offsets of one partition
+type window struct {
+	size     time.Duration
+	topic    string
+	part     int32
+	first    int64
+	last     int64
+	messages int
+	clicks   int
+	counts   map[windowKey]int64
+}
+
+func (w *window) empty() bool {
+	return w.messages == 0
+}
+
+func (w *window) batch() models.ClickAggregateBatch {
+	batch := models.ClickAggregateBatch{
+		SourceTopic:     w.topic,
+		SourcePartition: w.part,
+		FirstOffset:     w.first,
+		LastOffset:      w.last,
+		Counts:          make([]models.ClickWindowCount, 0, len(w.counts)),
+	}
+	for key, clicks := range w.counts {
+		start := time.Unix(key.start, 0).UTC()
+		batch.Counts = append(batch.Counts, models.ClickWindowCount{
+			TenantID:    key.tenantID,
+			AdID:        key.adID,
+			WindowStart: start,
+			WindowEnd:   start.Add(w.size),
+			Clicks:      clicks,
+		})
+	}
+	return batch
+}
+
+func (w *window) reset() {
+	w.messages = 0
+	w.clicks = 0
+	w.counts = make(map[windowKey]int64)
+}
@@ -0,0 +1,97 @@
+package aggregator
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/messaging"
+	"ad-tracking-system/internal/tracing"
+	"ad-tracking-system/internal/utils/metrics"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// ApplyFunc applies a batch of window counts idempotently and reports whether
+// it was applied (false when it had been applied before)
+type ApplyFunc func(ctx context.Context, batch models.ClickAggregateBatch) (bool, error)
+
+// Sink reads committed batches from the aggregate topic and applies them to a store
+type Sink struct {
+	name    string
+	topic   string
+	apply   ApplyFunc
+	groupID string
+	group   sarama.ConsumerGroup
+	logger  *slog.Logger
+}
+
+// NewSink creates a sink consuming topic as groupID
+func NewSink(name string, brokers []string, groupID, topic string, apply ApplyFunc, logger *slog.Logger) (*Sink, error) {
+	config := sarama.NewConfig()
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.IsolationLevel = sarama.ReadCommitted // Never see aborted aggregates
+
+	group, err := sarama.NewConsumerGroup(brokers, groupID, config)
+	if err != nil {
+		return nil, err
+	}
+	return &Sink{name: name, topic: topic, apply: apply, groupID: groupID, group: group, logger: logger}, nil
+}
+
+// Run applies batches until ctx is cancelled
+func (s *Sink) Run(ctx context.Context) error {
+	for {
+		if err := s.group.Consume(ctx, []string{s.topic}, s); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return nil
+			}
+			s.logger.WarnContext(ctx, "Sink session ended", "sink", s.name, "error", err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Close shuts down the consumer group
+func (s *Sink) Close() error {
+	return s.group.Close()
+}
+
+// Setup is called at the start of a consumer group session
+func (s *Sink) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+// Cleanup is called at the end of a consumer group session
+func (s *Sink) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim applies every batch before marking it consumed. A batch that is
+// redelivered after a crash is recognised by its source offset and skipped.
+func (s *Sink) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		var batch models.ClickAggregateBatch
+		if err := json.Unmarshal(msg.Value, &batch); err != nil {
+			s.logger.WarnContext(session.Context(), "Skipping undecodable click aggregate", "sink", s.name, "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+			session.MarkMessage(msg, "")
+			continue
+		}
+
+		ctx, span := messaging.StartKafkaConsumerSpan(session.Context(), msg)
+		start := time.Now()
+		applied, err := s.apply(ctx, batch)
+		metrics.KafkaProcessingLatency.WithLabelValues(msg.Topic).Observe(time.Since(start).Seconds())
+		tracing.End(span, err)
+		if err != nil {
+			// Stop without marking so the batch is retried by the next session
+			return err
+		}
+		if !applied {
+			s.logger.InfoContext(ctx, "Skipped already applied click aggregate batch", "sink", s.name, "source_topic", batch.SourceTopic, "source_partition", batch.SourcePartition, "last_offset", batch.LastOffset)
+		}
+		session.MarkMessage(msg, "")
+		messaging.RecordConsumerLag(s.groupID, claim, msg)
+	}
+	return nil
+}
@@ -1,22 +1,38 @@
 package handlers
 
 import (
-	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/events/schema"
+	"ad-tracking-system/internal/messaging"
 	"ad-tracking-system/internal/repository"
-	"encoding/json"
-	"log"
+	"context"
+	"log/slog"
 )
 
-func HandleClickEvent(message []byte, repo *repository.ClickRepository) {
-	var click models.ClickEvent
-	if err := json.Unmarshal(message, &click); err != nil {
-		log.Printf("Failed to unmarshal click event: %v", err)
-		return
+// NewClickHandler returns a messaging.Handler storing click events with HandleClickEvent
+func NewClickHandler(serde *schema.ClickEventSerde, repo *repository.ClickRepository, logger *slog.Logger) messaging.Handler {
+	return func(ctx context.Context, envelope *messaging.Envelope) error {
+		return HandleClickEvent(ctx, envelope, serde, repo, logger)
+	}
+}
+
+// HandleClickEvent stores a consumed click event in the clicks table
+func HandleClickEvent(ctx context.Context, envelope *messaging.Envelope, serde *schema.ClickEventSerde, repo *repository.ClickRepository, logger *slog.Logger) error {
+	// Messages without an event type predate headers and are all clicks
+	if envelope.EventType != "" && envelope.EventType != schema.ClickEventType {
+		logger.DebugContext(ctx, "Skipping event", "event_type", envelope.EventType, "topic", envelope.Topic, "partition", envelope.Partition, "offset", envelope.Offset)
+		return nil
+	}
+
+	click, err := serde.Decode(envelope.Value)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to decode click event", "topic", envelope.Topic, "partition", envelope.Partition, "offset", envelope.Offset, "error", err)
+		return err
 	}
 
 	// Save the click event to the database
-	if err := repo.Save(click); err != nil {
-		log.Printf("Failed to save click event: %v", err)
-		return
+	if err := repo.SaveConsumed(ctx, click); err != nil {
+		logger.ErrorContext(ctx, "Failed to save click event", "error", err)
+		return err
 	}
+	return nil
 }
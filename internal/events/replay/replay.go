@@ -0,0 +1,157 @@
+package replay
+
+import (
+	"ad-tracking-system/internal/messaging"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// partitionIdleTimeout is how long a partition may deliver nothing before its
+// replay ends
+const partitionIdleTimeout = 5 * time.Second
+
+// Report summarises a replay
+type Report struct {
+	Topic      string    `json:"topic"`
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Partitions int       `json:"partitions"`
+	Processed  int64     `json:"processed"`
+	Failed     int64     `json:"failed"`
+}
+
+// Replayer re-reads the messages of a topic published in a time range
+type Replayer struct {
+	client   sarama.Client
+	consumer sarama.Consumer
+	logger   *slog.Logger
+}
+
+// New creates a new Replayer
+func New(brokers []string, logger *slog.Logger) (*Replayer, error) {
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &Replayer{client: client, consumer: consumer, logger: logger}, nil
+}
+
+// Replay passes every message of topic with a timestamp in [from, to) to handler,
+// partition by partition in offset order. Handler errors are counted, not fatal.
+func (r *Replayer) Replay(ctx context.Context, topic string, from, to time.Time, handler messaging.Handler) (Report, error) {
+	report := Report{Topic: topic, From: from, To: to}
+
+	partitions, err := r.client.Partitions(topic)
+	if err != nil {
+		return report, err
+	}
+	report.Partitions = len(partitions)
+
+	for _, partition := range partitions {
+		start, end, err := r.offsetRange(topic, partition, from, to)
+		if err != nil {
+			return report, err
+		}
+		if start >= end {
+			continue
+		}
+		r.logger.InfoContext(ctx, "Replaying partition", "topic", topic, "partition", partition, "first_offset", start, "last_offset", end-1)
+
+		if err := r.replayPartition(ctx, topic, partition, start, end, from, to, handler, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// offsetRange finds the offsets [start, end) of the messages with a timestamp in [from, to)
+func (r *Replayer) offsetRange(topic string, partition int32, from, to time.Time) (int64, int64, error) {
+	newest, err := r.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// GetOffset with a timestamp returns the first offset at or after it, or -1 if there is none
+	start, err := r.client.GetOffset(topic, partition, from.UnixMilli())
+	if err != nil {
+		return 0, 0, err
+	}
+	if start < 0 {
+		return newest, newest, nil
+	}
+	end, err := r.client.GetOffset(topic, partition, to.UnixMilli())
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < 0 {
+		end = newest
+	}
+	return start, end, nil
+}
+
+func (r *Replayer) replayPartition(ctx context.Context, topic string, partition int32, start, end int64, from, to time.Time, handler messaging.Handler, report *Report) error {
+	pc, err := r.consumer.ConsumePartition(topic, partition, start)
+	if err != nil {
+		return fmt.Errorf("consume %s/%d: %w", topic, partition, err)
+	}
+	defer pc.Close()
+
+	// Some offsets below end are never delivered, such as transaction markers
+	// and compacted messages. Should the last ones be among them, the partition
+	// is done once it has been idle for a while: everything before end had
+	// been written when the replay started.
+	idle := time.NewTimer(partitionIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-pc.Errors():
+			return fmt.Errorf("consume %s/%d: %w", topic, partition, err)
+		case <-idle.C:
+			r.logger.InfoContext(ctx, "Partition idle, ending its replay", "topic", topic, "partition", partition, "last_offset", end-1)
+			return nil
+		case msg := <-pc.Messages():
+			if msg.Offset >= end {
+				return nil
+			}
+			// Timestamps are not strictly ordered within a partition
+			if !msg.Timestamp.Before(from) && msg.Timestamp.Before(to) {
+				if err := handler(ctx, messaging.NewKafkaEnvelope(msg)); err != nil {
+					report.Failed++
+					r.logger.ErrorContext(ctx, "Failed to replay message", "topic", topic, "partition", partition, "offset", msg.Offset, "error", err)
+				} else {
+					report.Processed++
+				}
+			}
+			if msg.Offset+1 >= end {
+				return nil
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(partitionIdleTimeout)
+		}
+	}
+}
+
+// Close releases the Kafka connections
+func (r *Replayer) Close() error {
+	if err := r.consumer.Close(); err != nil {
+		return err
+	}
+	return r.client.Close()
+}
@@ -0,0 +1,249 @@
+package schema
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/messaging"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ClickEventProto is the Protobuf schema of click events
+//
+//go:embed click_event.proto
+var ClickEventProto string
+
+// ClickEventType is the event-type header value of click events
+const ClickEventType = "click"
+
+// ClickEventSchemaVersion is the major version of click_event.proto, matching its package name
+const ClickEventSchemaVersion = "1"
+
+// magicByte starts every payload in the schema registry wire format
+const magicByte = 0x00
+
+// Field numbers from click_event.proto
+const (
+	fieldAdID         protowire.Number = 1
+	fieldTimestamp    protowire.Number = 2
+	fieldIP           protowire.Number = 3
+	fieldPlaybackTime protowire.Number = 4
+	fieldTenantID     protowire.Number = 5
+
+	// google.protobuf.Timestamp
+	fieldSeconds protowire.Number = 1
+	fieldNanos   protowire.Number = 2
+)
+
+// ClickEventSerde encodes click events in the Confluent schema registry wire
+// format: a zero magic byte, the big-endian schema ID, the Protobuf message
+// indexes and the Protobuf payload. It decodes that format and the schemaless
+// JSON published before schemas were introduced.
+type ClickEventSerde struct {
+	registry Registry
+	schemaID int
+}
+
+// NewClickEventSerde registers the click event schema under subject and returns a serde using it
+func NewClickEventSerde(registry Registry, subject string) (*ClickEventSerde, error) {
+	id, err := registry.Register(subject, TypeProtobuf, ClickEventProto)
+	if err != nil {
+		return nil, fmt.Errorf("register click event schema: %w", err)
+	}
+	return &ClickEventSerde{registry: registry, schemaID: id}, nil
+}
+
+// SchemaID returns the ID of the schema used to encode click events
+func (s *ClickEventSerde) SchemaID() int {
+	return s.schemaID
+}
+
+// Message encodes a click event into the message published for it, keyed by
+// tenant and ad ID so all clicks of an ad land on one partition, in order
+func (s *ClickEventSerde) Message(click models.ClickEvent) (messaging.Message, error) {
+	value, err := s.Encode(click)
+	if err != nil {
+		return messaging.Message{}, err
+	}
+	return messaging.Message{
+		Key:   click.Key(),
+		Value: value,
+		Headers: map[string]string{
+			messaging.HeaderEventType:     ClickEventType,
+			messaging.HeaderSchemaID:      strconv.Itoa(s.schemaID),
+			messaging.HeaderSchemaVersion: ClickEventSchemaVersion,
+		},
+	}, nil
+}
+
+// Encode encodes a click event for publishing
+func (s *ClickEventSerde) Encode(click models.ClickEvent) ([]byte, error) {
+	b := make([]byte, 0, 64)
+	b = append(b, magicByte)
+	b = binary.BigEndian.AppendUint32(b, uint32(s.schemaID))
+	b = append(b, 0) // Message indexes [0]: the first message in the schema
+
+	if click.AdID != "" {
+		b = protowire.AppendTag(b, fieldAdID, protowire.BytesType)
+		b = protowire.AppendString(b, click.AdID)
+	}
+	if !click.Timestamp.IsZero() {
+		var ts []byte
+		if secs := click.Timestamp.Unix(); secs != 0 {
+			ts = protowire.AppendTag(ts, fieldSeconds, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(secs))
+		}
+		if nanos := click.Timestamp.Nanosecond(); nanos != 0 {
+			ts = protowire.AppendTag(ts, fieldNanos, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(nanos))
+		}
+		b = protowire.AppendTag(b, fieldTimestamp, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+	if click.IP != "" {
+		b = protowire.AppendTag(b, fieldIP, protowire.BytesType)
+		b = protowire.AppendString(b, click.IP)
+	}
+	if click.PlaybackTime != 0 {
+		b = protowire.AppendTag(b, fieldPlaybackTime, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(int64(click.PlaybackTime)))
+	}
+	if click.TenantID != "" {
+		b = protowire.AppendTag(b, fieldTenantID, protowire.BytesType)
+		b = protowire.AppendString(b, click.TenantID)
+	}
+	return b, nil
+}
+
+// Decode decodes a click event in either the wire format or legacy JSON.
+// Events published before tenants were introduced belong to the default tenant.
+func (s *ClickEventSerde) Decode(data []byte) (models.ClickEvent, error) {
+	click, err := s.decode(data)
+	if err == nil && click.TenantID == "" {
+		click.TenantID = models.DefaultTenantID
+	}
+	return click, err
+}
+
+func (s *ClickEventSerde) decode(data []byte) (models.ClickEvent, error) {
+	var click models.ClickEvent
+	if len(data) == 0 {
+		return click, errors.New("empty click event")
+	}
+
+	// Events published before the schema registry was introduced are plain JSON
+	if data[0] != magicByte {
+		err := json.Unmarshal(data, &click)
+		return click, err
+	}
+
+	if len(data) < 5 {
+		return click, errors.New("click event too short for schema header")
+	}
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+	schema, err := s.registry.GetByID(id)
+	if err != nil {
+		return click, fmt.Errorf("look up schema %d: %w", id, err)
+	}
+	if schema.SchemaType != TypeProtobuf {
+		return click, fmt.Errorf("schema %d has unsupported type %s", id, schema.SchemaType)
+	}
+
+	payload, err := skipMessageIndexes(data[5:])
+	if err != nil {
+		return click, err
+	}
+	return decodeClickEvent(payload)
+}
+
+// skipMessageIndexes skips the zigzag-varint encoded message index array
+func skipMessageIndexes(b []byte) ([]byte, error) {
+	count, n := binary.Varint(b)
+	if n <= 0 || count < 0 {
+		return nil, errors.New("invalid message indexes")
+	}
+	b = b[n:]
+	for i := int64(0); i < count; i++ {
+		if _, n = binary.Varint(b); n <= 0 {
+			return nil, errors.New("invalid message indexes")
+		}
+		b = b[n:]
+	}
+	return b, nil
+}
+
+// decodeClickEvent decodes the Protobuf payload, skipping fields it does not
+// know so that events written with newer schema versions can still be read
+func decodeClickEvent(b []byte) (models.ClickEvent, error) {
+	var click models.ClickEvent
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return click, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == fieldAdID && typ == protowire.BytesType:
+			click.AdID, n = protowire.ConsumeString(b)
+		case num == fieldTimestamp && typ == protowire.BytesType:
+			var ts []byte
+			if ts, n = protowire.ConsumeBytes(b); n >= 0 {
+				var err error
+				if click.Timestamp, err = decodeTimestamp(ts); err != nil {
+					return click, err
+				}
+			}
+		case num == fieldIP && typ == protowire.BytesType:
+			click.IP, n = protowire.ConsumeString(b)
+		case num == fieldPlaybackTime && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			click.PlaybackTime = int(int32(v))
+		case num == fieldTenantID && typ == protowire.BytesType:
+			click.TenantID, n = protowire.ConsumeString(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return click, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return click, nil
+}
+
+func decodeTimestamp(b []byte) (time.Time, error) {
+	var secs, nanos int64
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == fieldSeconds && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			secs = int64(v)
+		case num == fieldNanos && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			nanos = int64(int32(v))
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return time.Time{}, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return time.Unix(secs, nanos).UTC(), nil
+}
@@ -0,0 +1,215 @@
+package schema
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/messaging"
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func newTestSerde(t *testing.T) *ClickEventSerde {
+	t.Helper()
+	registry, err := NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Take up an ID so the click schema's ID is not the zero value
+	if _, err := registry.Register("other-value", TypeProtobuf, "syntax = \"proto3\";"); err != nil {
+		t.Fatal(err)
+	}
+	serde, err := NewClickEventSerde(registry, "ad-clicks-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serde
+}
+
+func TestClickEventRoundTrip(t *testing.T) {
+	serde := newTestSerde(t)
+	tests := []struct {
+		name  string
+		click models.ClickEvent
+	}{
+		{"all fields", models.ClickEvent{TenantID: "acme", AdID: "ad-1", Timestamp: time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC), IP: "203.0.113.7", PlaybackTime: 42}},
+		{"negative playback time", models.ClickEvent{TenantID: "acme", AdID: "ad-1", Timestamp: time.Unix(1714566600, 0).UTC(), PlaybackTime: -5}},
+		{"smallest playback time", models.ClickEvent{TenantID: "acme", PlaybackTime: -1 << 31}},
+		{"before the epoch", models.ClickEvent{TenantID: "acme", Timestamp: time.Date(1969, 12, 31, 23, 59, 59, 500, time.UTC)}},
+		{"at the epoch", models.ClickEvent{TenantID: "acme", Timestamp: time.Unix(0, 0).UTC()}},
+		{"zero values", models.ClickEvent{TenantID: "acme"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := serde.Encode(tt.click)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			got, err := serde.Decode(data)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if got != tt.click {
+				t.Errorf("Decode(Encode()) = %+v, want %+v", got, tt.click)
+			}
+		})
+	}
+}
+
+func TestClickEventWireFormat(t *testing.T) {
+	serde := newTestSerde(t)
+	ts := time.Date(2024, 5, 1, 12, 30, 0, 500, time.UTC)
+	data, err := serde.Encode(models.ClickEvent{TenantID: "acme", AdID: "ad-1", Timestamp: ts, IP: "203.0.113.7", PlaybackTime: -5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Magic byte, big-endian schema ID and the message indexes [0]
+	if data[0] != magicByte {
+		t.Errorf("magic byte = %#x, want %#x", data[0], magicByte)
+	}
+	if id := binary.BigEndian.Uint32(data[1:5]); int(id) != serde.SchemaID() || id == 0 {
+		t.Errorf("schema ID = %d, want %d", id, serde.SchemaID())
+	}
+	if data[5] != 0 {
+		t.Errorf("message indexes = %#x, want 0 for the first message", data[5])
+	}
+
+	// The payload is the Protobuf encoding of click_event.proto
+	fields := make(map[protowire.Number][]byte)
+	for b := data[6:]; len(b) > 0; {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			t.Fatal(protowire.ParseError(n))
+		}
+		fields[num] = b[:n]
+		b = b[n:]
+	}
+	wantTimestamp, err := proto.Marshal(timestamppb.New(ts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := protowire.ConsumeBytes(fields[fieldTimestamp]); !bytes.Equal(got, wantTimestamp) {
+		t.Errorf("timestamp = %x, want google.protobuf.Timestamp %x", got, wantTimestamp)
+	}
+	// int32 fields hold negative values sign-extended to 64 bits
+	if got, _ := protowire.ConsumeVarint(fields[fieldPlaybackTime]); int64(got) != -5 {
+		t.Errorf("playback_time = %d, want -5", int64(got))
+	}
+	if got, _ := protowire.ConsumeString(fields[fieldTenantID]); got != "acme" {
+		t.Errorf("tenant_id = %q, want acme", got)
+	}
+
+	message, err := serde.Message(models.ClickEvent{TenantID: "acme", AdID: "ad-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if message.Key != "acme/ad-1" || message.Headers[messaging.HeaderSchemaID] != strconv.Itoa(serde.SchemaID()) ||
+		message.Headers[messaging.HeaderEventType] != ClickEventType || message.Headers[messaging.HeaderSchemaVersion] != ClickEventSchemaVersion {
+		t.Errorf("Message() = key %q, headers %v", message.Key, message.Headers)
+	}
+}
+
+func TestClickEventDecodeOtherEncodings(t *testing.T) {
+	serde := newTestSerde(t)
+	header := binary.BigEndian.AppendUint32([]byte{magicByte}, uint32(serde.SchemaID()))
+
+	// A newer schema version may add fields, including to nested messages
+	var ts []byte
+	ts = protowire.AppendTag(ts, fieldSeconds, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, 1714566600)
+	ts = protowire.AppendTag(ts, 9, protowire.Fixed32Type)
+	ts = protowire.AppendFixed32(ts, 7)
+	payload := protowire.AppendTag(nil, fieldAdID, protowire.BytesType)
+	payload = protowire.AppendString(payload, "ad-1")
+	payload = protowire.AppendTag(payload, 15, protowire.VarintType)
+	payload = protowire.AppendVarint(payload, 99)
+	payload = protowire.AppendTag(payload, fieldTimestamp, protowire.BytesType)
+	payload = protowire.AppendBytes(payload, ts)
+	payload = protowire.AppendTag(payload, 16, protowire.BytesType)
+	payload = protowire.AppendString(payload, "added later")
+	withUnknown := append(append(append([]byte{}, header...), 0), payload...)
+
+	// Message indexes other than [0]: count 2, then indexes 1 and 0, zigzag encoded
+	otherIndexes := binary.AppendVarint(append([]byte{}, header...), 2)
+	otherIndexes = binary.AppendVarint(otherIndexes, 1)
+	otherIndexes = binary.AppendVarint(otherIndexes, 0)
+	otherIndexes = append(otherIndexes, payload...)
+
+	tests := []struct {
+		name string
+		data []byte
+		want models.ClickEvent
+	}{
+		{"unknown fields", withUnknown, models.ClickEvent{TenantID: models.DefaultTenantID, AdID: "ad-1", Timestamp: time.Unix(1714566600, 0).UTC()}},
+		{"other message indexes", otherIndexes, models.ClickEvent{TenantID: models.DefaultTenantID, AdID: "ad-1", Timestamp: time.Unix(1714566600, 0).UTC()}},
+		{"legacy JSON", []byte(`{"ad_id":"ad-1","timestamp":"2024-05-01T12:30:00Z","ip":"203.0.113.7","playback_time":42}`),
+			models.ClickEvent{TenantID: models.DefaultTenantID, AdID: "ad-1", Timestamp: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), IP: "203.0.113.7", PlaybackTime: 42}},
+		{"legacy JSON with tenant", []byte(`{"tenant_id":"acme","ad_id":"ad-1","playback_time":-3}`),
+			models.ClickEvent{TenantID: "acme", AdID: "ad-1", PlaybackTime: -3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := serde.Decode(tt.data)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("Decode() timestamp = %s, want %s", got.Timestamp, tt.want.Timestamp)
+			}
+			got.Timestamp, tt.want.Timestamp = time.Time{}, time.Time{}
+			if got != tt.want {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClickEventDecodeInvalid(t *testing.T) {
+	serde := newTestSerde(t)
+	valid, err := serde.Encode(models.ClickEvent{TenantID: "acme", AdID: "ad-1", Timestamp: time.Now(), IP: "203.0.113.7", PlaybackTime: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownSchema := append([]byte{magicByte}, binary.BigEndian.AppendUint32(nil, 9999)...)
+	unknownSchema = append(unknownSchema, valid[5:]...)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"magic byte only", valid[:1]},
+		{"truncated schema ID", valid[:4]},
+		{"no message indexes", valid[:5]},
+		{"negative message index count", append(append([]byte{}, valid[:5]...), 1)}, // Zigzag 1 is -1
+		{"missing message index", append(append([]byte{}, valid[:5]...), 2)},        // Count 1 with no index
+		{"truncated field", valid[:len(valid)-1]},
+		{"truncated tag", append(append([]byte{}, valid...), 0x80)},
+		{"unknown schema ID", unknownSchema},
+		{"invalid JSON", []byte(`{"ad_id":`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if click, err := serde.Decode(tt.data); err == nil {
+				t.Errorf("Decode() = %+v, want an error", click)
+			}
+		})
+	}
+
+	// No prefix of a valid event may panic, whether or not it decodes
+	for i := range valid {
+		serde.Decode(valid[:i])
+	}
+}
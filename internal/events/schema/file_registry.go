@@ -0,0 +1,102 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileRegistry is a Registry kept in a local JSON file, for development and
+// deployments without a schema registry service
+type FileRegistry struct {
+	path    string
+	mu      sync.Mutex
+	schemas []Schema
+}
+
+type fileRegistryContents struct {
+	Schemas []Schema `json:"schemas"`
+}
+
+// NewFileRegistry opens the registry stored at path, creating it on first Register
+func NewFileRegistry(path string) (*FileRegistry, error) {
+	r := &FileRegistry{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var contents fileRegistryContents
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, err
+	}
+	r.schemas = contents.Schemas
+	return r, nil
+}
+
+// Register registers definition under subject and persists the registry
+func (r *FileRegistry) Register(subject, schemaType, definition string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nextID, nextVersion := 1, 1
+	for _, s := range r.schemas {
+		if s.Subject == subject && s.SchemaType == schemaType && s.Definition == definition {
+			return s.ID, nil
+		}
+		if s.ID >= nextID {
+			nextID = s.ID + 1
+		}
+		if s.Subject == subject && s.Version >= nextVersion {
+			nextVersion = s.Version + 1
+		}
+	}
+
+	schemas := append(r.schemas, Schema{
+		ID:         nextID,
+		Subject:    subject,
+		Version:    nextVersion,
+		SchemaType: schemaType,
+		Definition: definition,
+	})
+	if err := r.save(schemas); err != nil {
+		return 0, err
+	}
+	r.schemas = schemas
+	return nextID, nil
+}
+
+// GetByID returns the schema with the given ID
+func (r *FileRegistry) GetByID(id int) (Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.schemas {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return Schema{}, ErrSchemaNotFound
+}
+
+func (r *FileRegistry) save(schemas []Schema) error {
+	data, err := json.MarshalIndent(fileRegistryContents{Schemas: schemas}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,109 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// HTTPRegistry is a Registry backed by a Confluent-compatible schema registry service
+type HTTPRegistry struct {
+	baseURL string
+	client  *http.Client
+	mu      sync.Mutex
+	byID    map[int]Schema
+}
+
+// NewHTTPRegistry creates a client for the schema registry at baseURL
+func NewHTTPRegistry(baseURL string) *HTTPRegistry {
+	return &HTTPRegistry{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		byID:    make(map[int]Schema),
+	}
+}
+
+// Register registers definition under subject and returns its ID
+func (r *HTTPRegistry) Register(subject, schemaType, definition string) (int, error) {
+	body, err := json.Marshal(map[string]string{
+		"schema":     definition,
+		"schemaType": schemaType,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := r.do(http.MethodPost, path, body, &result); err != nil {
+		return 0, err
+	}
+	return result.ID, nil
+}
+
+// GetByID returns the schema with the given ID; schemas are immutable so they are cached forever
+func (r *HTTPRegistry) GetByID(id int) (Schema, error) {
+	r.mu.Lock()
+	cached, ok := r.byID[id]
+	r.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	var result struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if err := r.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &result); err != nil {
+		return Schema{}, err
+	}
+	// The registry omits schemaType for Avro, its default
+	if result.SchemaType == "" {
+		result.SchemaType = "AVRO"
+	}
+
+	s := Schema{ID: id, SchemaType: result.SchemaType, Definition: result.Schema}
+	r.mu.Lock()
+	r.byID[id] = s
+	r.mu.Unlock()
+	return s, nil
+}
+
+func (r *HTTPRegistry) do(method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, r.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", registryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", registryContentType)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrSchemaNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		var registryErr struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&registryErr)
+		return fmt.Errorf("schema registry %s %s: %s (%d)", method, path, registryErr.Message, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
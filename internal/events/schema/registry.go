@@ -0,0 +1,37 @@
+package schema
+
+import "errors"
+
+// Schema types understood by the registry
+const (
+	TypeProtobuf = "PROTOBUF"
+)
+
+// ErrSchemaNotFound is returned when a schema ID is unknown to the registry
+var ErrSchemaNotFound = errors.New("schema not found")
+
+// Schema is a schema registered under a subject
+type Schema struct {
+	ID         int    `json:"id"`
+	Subject    string `json:"subject"`
+	Version    int    `json:"version"`
+	SchemaType string `json:"schema_type"`
+	Definition string `json:"schema"`
+}
+
+// Registry stores schemas and hands out the IDs embedded in Kafka payloads
+type Registry interface {
+	// Register registers definition under subject and returns its ID. Registering
+	// a definition that is already registered returns the existing ID.
+	Register(subject, schemaType, definition string) (int, error)
+	// GetByID returns the schema with the given ID
+	GetByID(id int) (Schema, error)
+}
+
+// NewRegistry returns the HTTP registry client when url is set and the file registry at path otherwise
+func NewRegistry(url, path string) (Registry, error) {
+	if url != "" {
+		return NewHTTPRegistry(url), nil
+	}
+	return NewFileRegistry(path)
+}
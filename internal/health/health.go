@@ -0,0 +1,136 @@
+package health
+
+import (
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Readiness statuses
+const (
+	StatusReady        = "ready"
+	StatusNotReady     = "not_ready"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Dependency statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check returns an error if a dependency cannot be reached
+type Check func(ctx context.Context) error
+
+// DependencyStatus is the outcome of one dependency's check
+type DependencyStatus struct {
+	Status        string  `json:"status"`
+	LatencyMS     float64 `json:"latency_ms"`
+	Error         string  `json:"error,omitempty"`
+	Informational bool    `json:"informational,omitempty"` // Does not affect readiness
+}
+
+// Report is the readiness of the service
+type Report struct {
+	Status          string                      `json:"status"`
+	Dependencies    map[string]DependencyStatus `json:"dependencies"`
+	CircuitBreakers map[string]string           `json:"circuit_breakers"`
+}
+
+// Ready reports whether the service should receive traffic
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+type namedCheck struct {
+	name          string
+	check         Check
+	informational bool
+}
+
+// Checker checks the service's dependencies. The service is ready while every
+// dependency is up and it is not shutting down. Open circuit breakers are
+// reported but do not make the service not ready: every replica shares the
+// same dependencies, so taking this one out of rotation would not help.
+type Checker struct {
+	timeout      time.Duration
+	checks       []namedCheck
+	shuttingDown atomic.Bool
+}
+
+// NewChecker creates a Checker giving each check up to timeout
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add adds a dependency check. It is not safe to call once checks have started.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// AddInformational adds a dependency check that is reported but does not make
+// the service not ready, for dependencies whose outages the service absorbs,
+// such as an event broker behind the outbox. It is not safe to call once
+// checks have started.
+func (c *Checker) AddInformational(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name: name, check: check, informational: true})
+}
+
+// ShutDown makes the service report not ready from now on, so that load
+// balancers stop sending it requests before the server stops
+func (c *Checker) ShutDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Check runs every dependency check concurrently
+func (c *Checker) Check(ctx context.Context) Report {
+	report := Report{
+		Status:          StatusReady,
+		Dependencies:    make(map[string]DependencyStatus, len(c.checks)),
+		CircuitBreakers: circuitbreaker.States(),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nc := range c.checks {
+		wg.Add(1)
+		go func(nc namedCheck) {
+			defer wg.Done()
+			status := c.run(ctx, nc.check)
+			status.Informational = nc.informational
+			mu.Lock()
+			report.Dependencies[nc.name] = status
+			mu.Unlock()
+		}(nc)
+	}
+	wg.Wait()
+
+	for _, status := range report.Dependencies {
+		if status.Status != StatusUp && !status.Informational {
+			report.Status = StatusNotReady
+		}
+	}
+	if c.shuttingDown.Load() {
+		report.Status = StatusShuttingDown
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	status := DependencyStatus{
+		Status:    StatusUp,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+	return status
+}
@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	up := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+	hangs := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name          string
+		checks        map[string]Check
+		informational map[string]Check
+		shuttingDown  bool
+		want          string
+		wantDown      string
+	}{
+		{"all up", map[string]Check{"postgres": up, "redis": up}, nil, false, StatusReady, ""},
+		{"one down", map[string]Check{"postgres": up, "redis": down}, nil, false, StatusNotReady, "redis"},
+		{"timed out", map[string]Check{"postgres": up, "redis": hangs}, nil, false, StatusNotReady, "redis"},
+		{"informational down", map[string]Check{"postgres": up}, map[string]Check{"kafka": down}, false, StatusReady, "kafka"},
+		{"informational timed out", map[string]Check{"postgres": up}, map[string]Check{"kafka": hangs}, false, StatusReady, "kafka"},
+		{"shutting down", map[string]Check{"postgres": up}, nil, true, StatusShuttingDown, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(50 * time.Millisecond)
+			for name, check := range tt.checks {
+				checker.Add(name, check)
+			}
+			for name, check := range tt.informational {
+				checker.AddInformational(name, check)
+			}
+			if tt.shuttingDown {
+				checker.ShutDown()
+			}
+
+			report := checker.Check(context.Background())
+			if report.Status != tt.want {
+				t.Fatalf("Status = %s, want %s", report.Status, tt.want)
+			}
+			if report.Ready() != (tt.want == StatusReady) {
+				t.Errorf("Ready() = %v with status %s", report.Ready(), report.Status)
+			}
+			for name, status := range report.Dependencies {
+				if name == tt.wantDown {
+					if status.Status != StatusDown || status.Error == "" {
+						t.Errorf("%s = %+v, want down with an error", name, status)
+					}
+				} else if status.Status != StatusUp {
+					t.Errorf("%s = %+v, want up", name, status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/events/schema"
+	"ad-tracking-system/internal/messaging"
+	"ad-tracking-system/internal/repository"
+	"ad-tracking-system/internal/tracing"
+	"ad-tracking-system/internal/utils/metrics"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// outboxMaxRetryDelay caps the wait between polls while publishing keeps failing
+const outboxMaxRetryDelay = time.Minute
+
+// OutboxRelayConfig controls how the outbox is drained
+type OutboxRelayConfig struct {
+	BatchSize      int           // Messages published per transaction
+	PollInterval   time.Duration // Wait between polls when the outbox is empty, doubled per consecutive failure
+	Retention      time.Duration // How long sent messages are kept before being deleted
+	PublishTimeout time.Duration // Deadline for publishing one message, zero for none
+}
+
+// OutboxRelay publishes pending outbox messages to a topic in order and marks
+// them sent. A message that cannot be encoded is dead-lettered so that it does
+// not hold up the rest. One that fails to publish is retried, with backoff,
+// until the broker takes it: a broker outage must not lose events.
+type OutboxRelay struct {
+	repo      repository.OutboxStore
+	publisher messaging.Publisher
+	topic     string
+	serde     *schema.ClickEventSerde
+	cfg       OutboxRelayConfig
+	logger    *slog.Logger
+}
+
+// NewOutboxRelay creates a new OutboxRelay. Click events are stored in the
+// outbox as JSON and re-encoded with serde when they are published.
+func NewOutboxRelay(repo repository.OutboxStore, publisher messaging.Publisher, topic string, serde *schema.ClickEventSerde, cfg OutboxRelayConfig, logger *slog.Logger) *OutboxRelay {
+	return &OutboxRelay{repo: repo, publisher: publisher, topic: topic, serde: serde, cfg: cfg, logger: logger}
+}
+
+// Run relays messages until ctx is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) {
+	lastCleanup := time.Now()
+	failures := 0
+	for {
+		sent, err := r.RunOnce(ctx)
+		if err != nil {
+			failures++
+			r.logger.ErrorContext(ctx, "Outbox relay failed", "error", err, "failures", failures)
+		} else {
+			failures = 0
+		}
+		r.updateMetrics(ctx)
+
+		if time.Since(lastCleanup) >= time.Hour {
+			if _, err := r.repo.DeleteSent(ctx, time.Now().Add(-r.cfg.Retention)); err == nil {
+				lastCleanup = time.Now()
+			}
+		}
+
+		// Keep draining without waiting while there is a backlog
+		if err == nil && sent == r.cfg.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.retryDelay(failures)):
+		}
+	}
+}
+
+// retryDelay returns the wait before the next poll after the given number of
+// consecutive failures, so that a broker outage is not polled in a tight loop
+func (r *OutboxRelay) retryDelay(failures int) time.Duration {
+	delay := r.cfg.PollInterval
+	for i := 1; i < failures && delay < outboxMaxRetryDelay; i++ {
+		delay = min(2*delay, outboxMaxRetryDelay)
+	}
+	return delay
+}
+
+// RunOnce publishes one batch and returns the number of messages sent
+func (r *OutboxRelay) RunOnce(ctx context.Context) (int, error) {
+	sent, err := r.repo.Relay(ctx, r.cfg.BatchSize, func(m repository.OutboxMessage) error {
+		message, err := r.encode(m)
+		if err != nil {
+			// Retrying cannot fix a message that does not encode
+			return r.deadLetter(ctx, m, err)
+		}
+		// Continue the trace of the request that wrote the message
+		if err := r.publish(tracing.Extract(ctx, m.Headers), message); err != nil {
+			metrics.OutboxPublishFailuresTotal.Inc()
+			return err
+		}
+		return nil
+	})
+	metrics.OutboxPublishedTotal.Add(float64(sent))
+	return sent, err
+}
+
+// deadLetter returns the error that makes the outbox set m aside
+func (r *OutboxRelay) deadLetter(ctx context.Context, m repository.OutboxMessage, err error) error {
+	metrics.OutboxDeadLetteredTotal.Inc()
+	r.logger.ErrorContext(ctx, "Dead-lettering outbox message", "message_id", m.ID, "event_type", m.EventType, "attempts", m.Attempts+1, "error", err)
+	return fmt.Errorf("%w: %w", repository.ErrOutboxDeadLetter, err)
+}
+
+// publish publishes one message within the configured publish deadline
+func (r *OutboxRelay) publish(ctx context.Context, message messaging.Message) error {
+	if r.cfg.PublishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.cfg.PublishTimeout)
+		defer cancel()
+	}
+	return r.publisher.Publish(ctx, r.topic, message)
+}
+
+// encode converts an outbox row into the message to publish, keyed by the
+// outbox key (the ad ID for clicks) so per-ad ordering is preserved
+func (r *OutboxRelay) encode(m repository.OutboxMessage) (messaging.Message, error) {
+	switch m.EventType {
+	case repository.OutboxEventClick:
+		var click models.ClickEvent
+		if err := json.Unmarshal(m.Payload, &click); err != nil {
+			return messaging.Message{}, fmt.Errorf("outbox message %d: %w", m.ID, err)
+		}
+		message, err := r.serde.Message(click)
+		if err != nil {
+			return messaging.Message{}, err
+		}
+		message.Key = m.Key
+		return message, nil
+	default:
+		return messaging.Message{}, fmt.Errorf("outbox message %d has unknown event type %q", m.ID, m.EventType)
+	}
+}
+
+func (r *OutboxRelay) updateMetrics(ctx context.Context) {
+	stats, err := r.repo.Stats(ctx)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to read outbox stats", "error", err)
+		return
+	}
+	metrics.OutboxPendingMessages.Set(float64(stats.Pending))
+	metrics.OutboxDeadLetteredMessages.Set(float64(stats.DeadLettered))
+	if stats.Pending == 0 {
+		metrics.OutboxLagSeconds.Set(0)
+		return
+	}
+	metrics.OutboxLagSeconds.Set(time.Since(stats.Oldest).Seconds())
+}
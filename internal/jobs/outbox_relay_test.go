@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/events/schema"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/messaging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testOutboxTopic = "clicks"
+
+// failingPublisher fails every message whose key is in fail
+type failingPublisher struct {
+	*messaging.MemoryBroker
+	fail map[string]bool
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, topic string, msg messaging.Message) error {
+	if p.fail[msg.Key] {
+		return errors.New("broker rejected the message")
+	}
+	return p.MemoryBroker.Publish(ctx, topic, msg)
+}
+
+func newTestRelay(t *testing.T, failKeys ...string) (*OutboxRelay, *repository.MemoryOutboxRepository, *failingPublisher) {
+	t.Helper()
+	registry, err := schema.NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	serde, err := schema.NewClickEventSerde(registry, testOutboxTopic+"-value")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := repository.NewMemoryOutboxRepository()
+	broker := messaging.NewMemoryBroker(100, logging.Discard())
+	publisher := &failingPublisher{MemoryBroker: broker, fail: make(map[string]bool)}
+	for _, key := range failKeys {
+		publisher.fail[key] = true
+	}
+	relay := NewOutboxRelay(repo, publisher, testOutboxTopic, serde, OutboxRelayConfig{
+		BatchSize:    10,
+		PollInterval: time.Millisecond,
+	}, logging.Discard())
+	return relay, repo, publisher
+}
+
+func addClick(t *testing.T, repo *repository.MemoryOutboxRepository, adID string) int64 {
+	t.Helper()
+	click := models.ClickEvent{TenantID: "acme", AdID: adID, Timestamp: time.Now().UTC(), IP: "203.0.113.7", PlaybackTime: 12}
+	payload, err := json.Marshal(click)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo.Add(repository.OutboxEventClick, click.Key(), payload, nil)
+}
+
+func publishedKeys(broker *failingPublisher) []string {
+	var keys []string
+	for _, envelope := range broker.Messages(testOutboxTopic) {
+		keys = append(keys, envelope.Key)
+	}
+	return keys
+}
+
+func TestOutboxRelayPublishesInOrder(t *testing.T) {
+	ctx := context.Background()
+	relay, repo, broker := newTestRelay(t)
+	for _, adID := range []string{"1", "2", "3"} {
+		addClick(t, repo, adID)
+	}
+
+	sent, err := relay.RunOnce(ctx)
+	if err != nil || sent != 3 {
+		t.Fatalf("RunOnce() = %d, %v, want 3, nil", sent, err)
+	}
+	if got, want := publishedKeys(broker), []string{"acme/1", "acme/2", "acme/3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+	if stats, _ := repo.Stats(ctx); stats.Pending != 0 || stats.DeadLettered != 0 {
+		t.Errorf("Stats() = %+v, want nothing pending or dead-lettered", stats)
+	}
+}
+
+func TestOutboxRelayDeadLettersUnencodableMessages(t *testing.T) {
+	ctx := context.Background()
+	relay, repo, broker := newTestRelay(t)
+	addClick(t, repo, "1")
+	poison := repo.Add(repository.OutboxEventClick, "acme/2", []byte("{not json"), nil)
+	unknown := repo.Add("impression", "acme/3", []byte("{}"), nil)
+	addClick(t, repo, "4")
+
+	// Retrying cannot fix these, so they are set aside on the first attempt
+	// and the messages behind them still go out
+	sent, err := relay.RunOnce(ctx)
+	if err != nil || sent != 2 {
+		t.Fatalf("RunOnce() = %d, %v, want 2, nil", sent, err)
+	}
+	if got, want := publishedKeys(broker), []string{"acme/1", "acme/4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+	dead := repo.DeadLettered()
+	if len(dead) != 2 || dead[0].ID != poison || dead[1].ID != unknown || dead[0].Attempts != 1 {
+		t.Errorf("DeadLettered() = %+v, want messages %d and %d after one attempt", dead, poison, unknown)
+	}
+}
+
+func TestOutboxRelayRetriesPublishFailures(t *testing.T) {
+	ctx := context.Background()
+	relay, repo, broker := newTestRelay(t, "acme/down")
+	addClick(t, repo, "down")
+	addClick(t, repo, "up")
+
+	// However often publishing fails, the message is kept and nothing behind
+	// it is published
+	for attempt := 1; attempt <= 20; attempt++ {
+		if sent, err := relay.RunOnce(ctx); err == nil || sent != 0 {
+			t.Fatalf("attempt %d: RunOnce() = %d, %v, want 0 and an error", attempt, sent, err)
+		}
+	}
+	if keys := publishedKeys(broker); len(keys) != 0 {
+		t.Fatalf("published %v before the failing message", keys)
+	}
+	if dead := repo.DeadLettered(); len(dead) != 0 {
+		t.Fatalf("DeadLettered() = %+v, want none", dead)
+	}
+	if stats, _ := repo.Stats(ctx); stats.Pending != 2 {
+		t.Errorf("Stats() = %+v, want 2 pending", stats)
+	}
+
+	// Once the broker takes it, it goes out first
+	delete(broker.fail, "acme/down")
+	sent, err := relay.RunOnce(ctx)
+	if err != nil || sent != 2 {
+		t.Fatalf("RunOnce() = %d, %v, want 2, nil", sent, err)
+	}
+	if got, want := publishedKeys(broker), []string{"acme/down", "acme/up"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+	if stats, _ := repo.Stats(ctx); stats.Pending != 0 || stats.DeadLettered != 0 {
+		t.Errorf("Stats() = %+v, want nothing pending or dead-lettered", stats)
+	}
+}
+
+func TestOutboxRelayRetryDelay(t *testing.T) {
+	relay := &OutboxRelay{cfg: OutboxRelayConfig{PollInterval: 500 * time.Millisecond}}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 500 * time.Millisecond},
+		{1, 500 * time.Millisecond},
+		{2, time.Second},
+		{4, 4 * time.Second},
+		{8, time.Minute},
+		{100, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := relay.retryDelay(tt.failures); got != tt.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"ad-tracking-system/internal/archive"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Partition intervals supported by the maintenance job
+const (
+	PartitionDaily   = "day"
+	PartitionMonthly = "month"
+)
+
+// Retention modes for expired partitions
+const (
+	RetentionDrop    = "drop"
+	RetentionDetach  = "detach"
+	RetentionArchive = "archive" // Archive to the configured store, verify, then drop
+)
+
+// Partitions are named clicks_pYYYYMM for months and clicks_pYYYYMMDD for days
+const (
+	partitionPrefix = "clicks_p"
+	monthlyLayout   = "200601"
+	dailyLayout     = "20060102"
+)
+
+// PartitionMaintenanceConfig controls how the clicks partitions are managed
+type PartitionMaintenanceConfig struct {
+	Interval      string        // PartitionDaily or PartitionMonthly
+	Premake       int           // Number of future partitions to keep created
+	RetentionDays int           // Partitions entirely older than this are expired; 0 disables retention
+	RetentionMode string        // RetentionDrop, RetentionDetach or RetentionArchive
+	RunEvery      time.Duration // How often the job runs
+}
+
+// PartitionMaintainer pre-creates future clicks partitions and expires old ones
+type PartitionMaintainer struct {
+	repo     repository.PartitionStore
+	archiver *archive.Archiver
+	cfg      PartitionMaintenanceConfig
+	logger   *slog.Logger
+}
+
+// NewPartitionMaintainer creates a new PartitionMaintainer. archiver is only used
+// with RetentionArchive and may be nil otherwise.
+func NewPartitionMaintainer(repo repository.PartitionStore, archiver *archive.Archiver, cfg PartitionMaintenanceConfig, logger *slog.Logger) *PartitionMaintainer {
+	return &PartitionMaintainer{repo: repo, archiver: archiver, cfg: cfg, logger: logger}
+}
+
+// Run performs maintenance immediately and then on every tick until ctx is cancelled
+func (m *PartitionMaintainer) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.RunEvery)
+	defer ticker.Stop()
+
+	for {
+		if err := m.RunOnce(ctx, time.Now()); err != nil {
+			m.logger.ErrorContext(ctx, "Partition maintenance failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce creates the partitions needed from now onwards and expires
+// partitions past retention. Ranges already covered by existing partitions,
+// such as the monthly ones of the migrations when the interval is daily, are
+// not created again. A failure to create or expire one partition does not stop
+// the others; every error is returned. While another replica maintains the
+// partitions, RunOnce does nothing.
+func (m *PartitionMaintainer) RunOnce(ctx context.Context, now time.Time) error {
+	locked, err := m.repo.WithLock(ctx, func() error {
+		return m.maintain(ctx, now)
+	})
+	if err != nil {
+		return err
+	}
+	if !locked {
+		m.logger.DebugContext(ctx, "Partitions are maintained by another replica, skipping")
+	}
+	return nil
+}
+
+func (m *PartitionMaintainer) maintain(ctx context.Context, now time.Time) error {
+	names, err := m.repo.ListPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	var existing []partitionRange
+	for _, name := range names {
+		if p, ok := parsePartitionName(name); ok {
+			existing = append(existing, p)
+		}
+	}
+
+	var errs []error
+	start := m.truncate(now)
+	for i := 0; i <= m.cfg.Premake; i++ {
+		end := m.next(start)
+		created, err := m.create(ctx, existing, start, end)
+		existing = append(existing, created...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		start = end
+	}
+
+	if m.cfg.RetentionDays > 0 {
+		cutoff := now.AddDate(0, 0, -m.cfg.RetentionDays)
+		for _, p := range existing {
+			if p.end.After(cutoff) {
+				continue
+			}
+			if err := m.expire(ctx, p); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// partitionRange is a clicks partition covering [start, end)
+type partitionRange struct {
+	name       string
+	start, end time.Time
+}
+
+// create creates a partition for [start, end) unless existing partitions cover
+// it. A range they only partly cover gets daily partitions for its uncovered
+// days, since Postgres refuses overlapping partitions.
+func (m *PartitionMaintainer) create(ctx context.Context, existing []partitionRange, start, end time.Time) ([]partitionRange, error) {
+	covered := coverage(existing, start, end)
+	if covered == end.Sub(start) {
+		return nil, nil
+	}
+
+	ranges := []partitionRange{{name: m.partitionName(start), start: start, end: end}}
+	if covered > 0 {
+		ranges = nil
+		for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+			if coverage(existing, day, day.AddDate(0, 0, 1)) == 0 {
+				ranges = append(ranges, partitionRange{name: partitionPrefix + day.Format(dailyLayout), start: day, end: day.AddDate(0, 0, 1)})
+			}
+		}
+	}
+
+	var created []partitionRange
+	var errs []error
+	for _, p := range ranges {
+		if err := m.repo.CreatePartition(ctx, p.name, p.start, p.end); err != nil {
+			errs = append(errs, fmt.Errorf("create partition %s: %w", p.name, err))
+			continue
+		}
+		created = append(created, p)
+	}
+	return created, errors.Join(errs...)
+}
+
+// coverage returns how much of [start, end) the partitions cover; partitions
+// never overlap each other
+func coverage(partitions []partitionRange, start, end time.Time) time.Duration {
+	var covered time.Duration
+	for _, p := range partitions {
+		from, to := p.start, p.end
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if from.Before(to) {
+			covered += to.Sub(from)
+		}
+	}
+	return covered
+}
+
+func (m *PartitionMaintainer) expire(ctx context.Context, p partitionRange) error {
+	switch m.cfg.RetentionMode {
+	case RetentionArchive:
+		if m.archiver == nil {
+			return fmt.Errorf("partition retention mode %q requires an archiver", RetentionArchive)
+		}
+		// The partition is only dropped once its archive has been verified.
+		// Only its own clicks are archived, as only they are dropped.
+		if _, err := m.archiver.ArchivePartition(ctx, p.name, p.start, p.end); err != nil {
+			return fmt.Errorf("archive partition %s: %w", p.name, err)
+		}
+		if err := m.repo.DropPartition(ctx, p.name); err != nil {
+			return err
+		}
+		m.logger.InfoContext(ctx, "Archived and dropped expired partition", "partition", p.name)
+	case RetentionDetach:
+		if err := m.repo.DetachPartition(ctx, p.name); err != nil {
+			return err
+		}
+		m.logger.InfoContext(ctx, "Detached expired partition", "partition", p.name)
+	case RetentionDrop:
+		if err := m.repo.DropPartition(ctx, p.name); err != nil {
+			return err
+		}
+		m.logger.InfoContext(ctx, "Dropped expired partition", "partition", p.name)
+	default:
+		return fmt.Errorf("unknown partition retention mode %q", m.cfg.RetentionMode)
+	}
+	return nil
+}
+
+func (m *PartitionMaintainer) truncate(t time.Time) time.Time {
+	t = t.UTC()
+	if m.cfg.Interval == PartitionDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (m *PartitionMaintainer) next(t time.Time) time.Time {
+	if m.cfg.Interval == PartitionDaily {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.AddDate(0, 1, 0)
+}
+
+func (m *PartitionMaintainer) partitionName(start time.Time) string {
+	if m.cfg.Interval == PartitionDaily {
+		return partitionPrefix + start.Format(dailyLayout)
+	}
+	return partitionPrefix + start.Format(monthlyLayout)
+}
+
+// parsePartitionName returns the range of a partition named by either
+// interval, so that retention also expires partitions created before the
+// interval was changed
+func parsePartitionName(name string) (partitionRange, bool) {
+	suffix := strings.TrimPrefix(name, partitionPrefix)
+	if suffix == name {
+		return partitionRange{}, false
+	}
+	switch len(suffix) {
+	case len(dailyLayout):
+		if start, err := time.Parse(dailyLayout, suffix); err == nil {
+			return partitionRange{name: name, start: start, end: start.AddDate(0, 0, 1)}, true
+		}
+	case len(monthlyLayout):
+		if start, err := time.Parse(monthlyLayout, suffix); err == nil {
+			return partitionRange{name: name, start: start, end: start.AddDate(0, 1, 0)}, true
+		}
+	}
+	return partitionRange{}, false
+}
@@ -0,0 +1,183 @@
+package jobs
+
+import (
+	"ad-tracking-system/internal/archive"
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestMaintainer(t *testing.T, interval string, retentionDays int, existing ...string) (*PartitionMaintainer, *repository.MemoryPartitionRepository) {
+	t.Helper()
+	repo := repository.NewMemoryPartitionRepository()
+	for _, name := range existing {
+		p, ok := parsePartitionName(name)
+		if !ok {
+			t.Fatalf("bad partition name %s", name)
+		}
+		if err := repo.CreatePartition(context.Background(), name, p.start, p.end); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := NewPartitionMaintainer(repo, nil, PartitionMaintenanceConfig{
+		Interval:      interval,
+		Premake:       2,
+		RetentionDays: retentionDays,
+		RetentionMode: RetentionDrop,
+	}, logging.Discard())
+	return m, repo
+}
+
+func partitions(t *testing.T, repo *repository.MemoryPartitionRepository) []string {
+	t.Helper()
+	names, err := repo.ListPartitions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+var maintenanceNow = time.Date(2024, 3, 30, 15, 0, 0, 0, time.UTC)
+
+func TestPartitionMaintenanceMonthly(t *testing.T) {
+	m, repo := newTestMaintainer(t, PartitionMonthly, 50, "clicks_p202312", "clicks_p202401", "clicks_p202402")
+	if err := m.RunOnce(context.Background(), maintenanceNow); err != nil {
+		t.Fatal(err)
+	}
+
+	// December and January ended more than 50 days ago
+	want := []string{"clicks_p202402", "clicks_p202403", "clicks_p202404", "clicks_p202405"}
+	if got := partitions(t, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("partitions = %v, want %v", got, want)
+	}
+}
+
+func TestPartitionMaintenanceDaily(t *testing.T) {
+	m, repo := newTestMaintainer(t, PartitionDaily, 2, "clicks_p20240326", "clicks_p20240327", "clicks_p20240328")
+	if err := m.RunOnce(context.Background(), maintenanceNow); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"clicks_p20240328", "clicks_p20240330", "clicks_p20240331", "clicks_p20240401"}
+	if got := partitions(t, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("partitions = %v, want %v", got, want)
+	}
+}
+
+func TestPartitionMaintenanceDailyOverMonthlyPartitions(t *testing.T) {
+	// The migrations create monthly partitions up to three months ahead
+	m, repo := newTestMaintainer(t, PartitionDaily, 45, "clicks_p202401", "clicks_p202402", "clicks_p202403")
+	if err := m.RunOnce(context.Background(), maintenanceNow); err != nil {
+		t.Fatal(err)
+	}
+
+	// Today is covered by March; the days after it get daily partitions, and
+	// January, over 45 days ago, is expired although named by month
+	want := []string{"clicks_p202402", "clicks_p202403", "clicks_p20240401"}
+	if got := partitions(t, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("partitions = %v, want %v", got, want)
+	}
+}
+
+func TestPartitionMaintenanceMonthlyOverDailyPartitions(t *testing.T) {
+	// Switching back from daily partitions fills the rest of the month by day
+	m, repo := newTestMaintainer(t, PartitionMonthly, 0, "clicks_p20240329", "clicks_p20240330")
+	if err := m.RunOnce(context.Background(), maintenanceNow); err != nil {
+		t.Fatal(err)
+	}
+
+	got := partitions(t, repo)
+	if len(got) != 31+2 || got[0] != "clicks_p20240301" || got[30] != "clicks_p20240331" || got[31] != "clicks_p202404" || got[32] != "clicks_p202405" {
+		t.Errorf("partitions = %v, want every day of March, April and May", got)
+	}
+}
+
+// failingCreates is a partition store that cannot create partitions
+type failingCreates struct {
+	*repository.MemoryPartitionRepository
+}
+
+func (failingCreates) CreatePartition(ctx context.Context, name string, from, to time.Time) error {
+	return errors.New("permission denied")
+}
+
+func TestPartitionMaintenanceExpiresDespiteCreateErrors(t *testing.T) {
+	_, repo := newTestMaintainer(t, PartitionMonthly, 50, "clicks_p202312")
+	m := NewPartitionMaintainer(failingCreates{repo}, nil, PartitionMaintenanceConfig{
+		Interval:      PartitionMonthly,
+		RetentionDays: 50,
+		RetentionMode: RetentionDrop,
+	}, logging.Discard())
+
+	if err := m.RunOnce(context.Background(), maintenanceNow); err == nil {
+		t.Error("RunOnce() = nil, want the create error")
+	}
+	if got := partitions(t, repo); len(got) != 0 {
+		t.Errorf("partitions = %v, want December expired", got)
+	}
+}
+
+func TestPartitionMaintenanceSkipsWhileLocked(t *testing.T) {
+	m, repo := newTestMaintainer(t, PartitionMonthly, 50, "clicks_p202312")
+
+	// Another replica is maintaining the partitions
+	locked, err := repo.WithLock(context.Background(), func() error {
+		return m.RunOnce(context.Background(), maintenanceNow)
+	})
+	if err != nil || !locked {
+		t.Fatalf("WithLock() = %t, %v", locked, err)
+	}
+	if got, want := partitions(t, repo), []string{"clicks_p202312"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("partitions = %v, want %v untouched", got, want)
+	}
+}
+
+func TestPartitionMaintenanceArchivesExpiredPartition(t *testing.T) {
+	ctx := context.Background()
+	clicks := repository.NewMemoryClickRepository(repository.NewMemoryAdRepository())
+	for _, ts := range []time.Time{
+		time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 12, 31, 23, 59, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		if err := clicks.Save(ctx, models.ClickEvent{TenantID: "acme", AdID: "1", Timestamp: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	archiver := archive.NewArchiver(clicks, archive.NewLocalStore(dir), logging.Discard())
+
+	_, repo := newTestMaintainer(t, PartitionMonthly, 50, "clicks_p202312", "clicks_p202401", "clicks_p202402")
+	m := NewPartitionMaintainer(repo, archiver, PartitionMaintenanceConfig{
+		Interval:      PartitionMonthly,
+		RetentionDays: 70,
+		RetentionMode: RetentionArchive,
+	}, logging.Discard())
+	if err := m.RunOnce(ctx, maintenanceNow); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := partitions(t, repo); got[0] != "clicks_p202401" {
+		t.Errorf("partitions = %v, want December dropped", got)
+	}
+	object := archive.ObjectKey(time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(archive.ManifestKey(object))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest archive.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Partition != "clicks_p202312" || manifest.RowCount != 2 {
+		t.Errorf("manifest = %+v, want the 2 clicks of partition clicks_p202312", manifest)
+	}
+}
@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/utils/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ReconciliationJob periodically compares every tenant's Redis click counters
+// with Postgres and exports the drift summed over all tenants as metrics
+type ReconciliationJob struct {
+	service    *services.ReconciliationService
+	tenants    *services.TenantService
+	threshold  int64
+	autoRepair bool
+	runEvery   time.Duration
+	logger     *slog.Logger
+}
+
+// NewReconciliationJob creates a new ReconciliationJob. When a tenant's total
+// drift exceeds threshold the alert gauge is raised and, if autoRepair is set,
+// the tenant's counters are rewritten.
+func NewReconciliationJob(service *services.ReconciliationService, tenants *services.TenantService, threshold int64, autoRepair bool, runEvery time.Duration, logger *slog.Logger) *ReconciliationJob {
+	return &ReconciliationJob{
+		service:    service,
+		tenants:    tenants,
+		threshold:  threshold,
+		autoRepair: autoRepair,
+		runEvery:   runEvery,
+		logger:     logger,
+	}
+}
+
+// Run reconciles on every tick until ctx is cancelled
+func (j *ReconciliationJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.runEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := j.RunOnce(ctx); err != nil {
+			j.logger.ErrorContext(ctx, "Click counter reconciliation failed", "error", err)
+		}
+	}
+}
+
+// RunOnce checks the drift of every tenant once, updates the metrics and
+// repairs if configured to. A tenant that fails is logged and skipped, so the
+// metrics cover the others; every error is returned.
+func (j *ReconciliationJob) RunOnce(ctx context.Context) error {
+	tenants, err := j.tenants.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	var totalDrift int64
+	var driftedAds int
+	alert := false
+	for _, tenant := range tenants {
+		report, err := j.reconcile(ctx, tenant.ID)
+		if err != nil {
+			j.logger.ErrorContext(ctx, "Failed to reconcile tenant click counters", "tenant_id", tenant.ID, "error", err)
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant.ID, err))
+			continue
+		}
+		totalDrift += report.TotalDrift
+		driftedAds += len(report.Drifts)
+		if report.TotalDrift > j.threshold {
+			alert = true
+		}
+	}
+
+	metrics.ClickCounterDrift.Set(float64(totalDrift))
+	metrics.ClickCounterDriftedAds.Set(float64(driftedAds))
+	if alert {
+		metrics.ClickCounterDriftAlert.Set(1)
+	} else {
+		metrics.ClickCounterDriftAlert.Set(0)
+	}
+	return errors.Join(errs...)
+}
+
+// reconcile checks the drift of one tenant and repairs it if it exceeds the
+// threshold and auto repair is on. It returns the drift left afterwards.
+func (j *ReconciliationJob) reconcile(ctx context.Context, tenantID string) (*models.ReconciliationReport, error) {
+	report, err := j.service.Reconcile(ctx, tenantID, true)
+	if err != nil {
+		return nil, err
+	}
+	if report.TotalDrift <= j.threshold {
+		return report, nil
+	}
+
+	j.logger.WarnContext(ctx, "Click counter drift exceeds threshold", "tenant_id", tenantID, "total_drift", report.TotalDrift, "threshold", j.threshold, "drifted", len(report.Drifts))
+
+	if !j.autoRepair {
+		return report, nil
+	}
+	ctx = services.WithActor(ctx, services.Actor{ID: "job:counter-reconciliation"})
+	if _, err := j.service.Reconcile(ctx, tenantID, false); err != nil {
+		return nil, err
+	}
+	return &models.ReconciliationReport{TenantID: tenantID, Drifts: []models.CounterDrift{}}, nil
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/domain/services"
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/repository"
+	"ad-tracking-system/internal/utils/metrics"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// brokenTenantRollups fails to read the click counts of the tenant "broken"
+type brokenTenantRollups struct {
+	*repository.MemoryClickRepository
+}
+
+func (r brokenTenantRollups) GetTotalClickCounts(ctx context.Context, tenantID string) (map[string]int64, error) {
+	if tenantID == "broken" {
+		return nil, errors.New("connection refused")
+	}
+	return r.MemoryClickRepository.GetTotalClickCounts(ctx, tenantID)
+}
+
+func TestReconciliationContinuesPastTenantErrors(t *testing.T) {
+	ctx := context.Background()
+	clicks := repository.NewMemoryClickRepository(repository.NewMemoryAdRepository())
+	analytics := repository.NewMemoryAnalyticsRepository()
+	// acme's counter is 3 too high and globex's 4 too low
+	for tenantID, counts := range map[string][2]int64{"acme": {1, 4}, "globex": {5, 1}} {
+		for i := int64(0); i < counts[0]; i++ {
+			if err := clicks.Save(ctx, models.ClickEvent{TenantID: tenantID, AdID: "1", Timestamp: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := analytics.SetClickCounts(ctx, tenantID, map[string]int64{"1": counts[1]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tenants := services.NewTenantService(repository.NewMemoryTenantRepository(
+		models.Tenant{ID: "acme"}, models.Tenant{ID: "broken"}, models.Tenant{ID: "globex"},
+	), repository.NewMemoryQuotaRepository(), nil, services.Timeouts{}, logging.Discard())
+	audit := services.NewAuditService(repository.NewMemoryAuditRepository(), repository.MemoryTransactor{}, services.Timeouts{}, logging.Discard())
+	service := services.NewReconciliationService(brokenTenantRollups{clicks}, analytics, audit, services.Timeouts{}, logging.Discard())
+	job := NewReconciliationJob(service, tenants, 5, false, time.Minute, logging.Discard())
+
+	err := job.RunOnce(ctx)
+	if err == nil || !strings.Contains(err.Error(), "tenant broken") {
+		t.Fatalf("RunOnce() = %v, want the error of tenant broken", err)
+	}
+	// globex, after broken, is still reconciled
+	if drift := testutil.ToFloat64(metrics.ClickCounterDrift); drift != 7 {
+		t.Errorf("click_counter_drift = %g, want 7", drift)
+	}
+	if alert := testutil.ToFloat64(metrics.ClickCounterDriftAlert); alert != 0 {
+		t.Errorf("click_counter_drift_alert = %g, want 0: no tenant drifted more than 5", alert)
+	}
+}
@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"ad-tracking-system/internal/repository"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// RollupJob keeps the Postgres click rollups up to date
+type RollupJob struct {
+	repo     *repository.RollupRepository
+	lookback time.Duration
+	runEvery time.Duration
+	logger   *slog.Logger
+}
+
+// NewRollupJob creates a new RollupJob. Every run recomputes the hours since the
+// watermark plus lookback, so clicks that arrive late are still counted.
+func NewRollupJob(repo *repository.RollupRepository, lookback, runEvery time.Duration, logger *slog.Logger) *RollupJob {
+	return &RollupJob{repo: repo, lookback: lookback, runEvery: runEvery, logger: logger}
+}
+
+// Run rolls up immediately and then on every tick until ctx is cancelled
+func (j *RollupJob) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.runEvery)
+	defer ticker.Stop()
+
+	for {
+		if err := j.RunOnce(ctx, time.Now()); err != nil {
+			j.logger.ErrorContext(ctx, "Click rollup failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce rolls up every complete hour between the watermark (minus lookback) and now
+func (j *RollupJob) RunOnce(ctx context.Context, now time.Time) error {
+	watermark, err := j.repo.GetWatermark(ctx)
+	if err != nil {
+		return err
+	}
+
+	from := watermark.Add(-j.lookback).Truncate(time.Hour)
+	to := now.UTC().Truncate(time.Hour)
+	if !to.After(from) {
+		return nil
+	}
+
+	return j.repo.RollUp(ctx, from, to)
+}
@@ -0,0 +1,152 @@
+package logging
+
+import (
+	"ad-tracking-system/internal/tracing"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// Log formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Redacted replaces secrets and, optionally, IP addresses in log records
+const Redacted = "[redacted]"
+
+// secretKeys are endings of attribute keys whose values are never logged
+var secretKeys = []string{"password", "passwd", "secret", "secretkey", "secret_key", "token", "authorization", "apikey", "api_key", "cookie"}
+
+// urlPassword matches the password of credentials embedded in a URL, such as a
+// postgres:// DSN
+var urlPassword = regexp.MustCompile(`(://[^:/@\s]*):[^@\s]*@`)
+
+// Config configures the logger of a process
+type Config struct {
+	Level     string // debug, info, warn or error
+	Format    string // json or text
+	RedactIPs bool   // Replace IP addresses with [redacted]
+
+	// LevelVar, if set, is set to Level and used as the logger's level, so
+	// that the level can be changed while the process runs
+	LevelVar *slog.LevelVar
+}
+
+// New returns a logger writing to w. Every record carries the request ID and
+// trace and span IDs of its context, and secrets are redacted.
+func New(w io.Writer, cfg Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, want debug, info, warn or error", cfg.Level)
+	}
+	var leveler slog.Leveler = level
+	if cfg.LevelVar != nil {
+		cfg.LevelVar.Set(level)
+		leveler = cfg.LevelVar
+	}
+	opts := &slog.HandlerOptions{
+		Level:       leveler,
+		ReplaceAttr: redactor(cfg.RedactIPs),
+	}
+
+	var handler slog.Handler
+	switch cfg.Format {
+	case FormatJSON, "":
+		handler = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, want %s or %s", cfg.Format, FormatJSON, FormatText)
+	}
+	return slog.New(&requestHandler{Handler: tracing.NewLogHandler(handler)}), nil
+}
+
+// Discard returns a logger that writes nothing, for tests and tools that do
+// not log
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// redactor returns a slog.HandlerOptions.ReplaceAttr hiding secrets: values of
+// secret-looking keys, and passwords embedded in URLs and error messages
+func redactor(redactIPs bool) func(groups []string, a slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if a.Value.Kind() == slog.KindGroup {
+			return a
+		}
+		key := strings.ToLower(a.Key)
+		for _, secret := range secretKeys {
+			if strings.HasSuffix(key, secret) {
+				return slog.String(a.Key, Redacted)
+			}
+		}
+
+		var s string
+		switch a.Value.Kind() {
+		case slog.KindString:
+			s = a.Value.String()
+		case slog.KindAny:
+			err, ok := a.Value.Any().(error)
+			if !ok {
+				return a
+			}
+			s = err.Error()
+		default:
+			return a
+		}
+		if redactIPs {
+			if _, err := netip.ParseAddr(s); err == nil {
+				return slog.String(a.Key, Redacted)
+			}
+			if _, err := netip.ParseAddrPort(s); err == nil {
+				return slog.String(a.Key, Redacted)
+			}
+		}
+		if urlPassword.MatchString(s) {
+			return slog.String(a.Key, urlPassword.ReplaceAllString(s, "$1:"+Redacted+"@"))
+		}
+		return a
+	}
+}
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a context whose log records carry request ID id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestID returns the request ID of ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestHandler adds the request ID of the context, if any, to every record
+type requestHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler
+func (h *requestHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler
+func (h *requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &requestHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (h *requestHandler) WithGroup(name string) slog.Handler {
+	return &requestHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRedactionAndRequestID(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, Config{Level: "info", Format: FormatJSON, RedactIPs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	logger.With("tenant_id", "acme").InfoContext(ctx, "handled",
+		"api_key", "ak_live_123",
+		"Authorization", "Bearer xyz",
+		"ip", "203.0.113.7",
+		"addr", "[2001:db8::1]:443",
+		"error", errors.New(`dial postgres://ads:hunter2@db:5432/ads: refused`),
+		"ads", 3,
+	)
+	logger.DebugContext(ctx, "not logged at info level")
+
+	var record map[string]any
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("want exactly one JSON record, got %q: %v", out.String(), err)
+	}
+	want := map[string]any{
+		"msg":           "handled",
+		"request_id":    "req-1",
+		"tenant_id":     "acme",
+		"api_key":       Redacted,
+		"Authorization": Redacted,
+		"ip":            Redacted,
+		"addr":          Redacted,
+		"error":         "dial postgres://ads:" + Redacted + "@db:5432/ads: refused",
+		"ads":           float64(3),
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, Config{Level: "verbose"}); err == nil {
+		t.Error("want an error for an unknown level")
+	}
+	if _, err := New(&bytes.Buffer{}, Config{Level: "info", Format: "xml"}); err == nil {
+		t.Error("want an error for an unknown format")
+	}
+}
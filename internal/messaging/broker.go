@@ -0,0 +1,87 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/config"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Event brokers selectable with EVENT_BROKER
+const (
+	BrokerKafka   = "kafka"
+	BrokerRedis   = "redis"   // Redis Streams
+	BrokerNATS    = "nats"    // NATS JetStream
+	BrokerMemory  = "memory"  // In-process, events are lost on restart
+	BrokerWebhook = "webhook" // HTTP POST, publish only
+)
+
+// Pinger is implemented by publishers that can check that their broker is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// memoryBrokerMaxLen bounds the messages the in-process broker keeps per
+// topic, as nothing else trims them
+const memoryBrokerMaxLen = 100000
+
+// inProcess is shared by every memory publisher and subscriber so they see each other
+var (
+	inProcessOnce sync.Once
+	inProcess     *MemoryBroker
+)
+
+func inProcessBroker(logger *slog.Logger) *MemoryBroker {
+	inProcessOnce.Do(func() { inProcess = NewMemoryBroker(memoryBrokerMaxLen, logger) })
+	return inProcess
+}
+
+// NewPublisher creates the publisher for cfg.EventBroker. spool is only used
+// by Kafka and may be nil.
+func NewPublisher(cfg *config.Config, redisClient *redis.Client, spool *DiskSpool, logger *slog.Logger) (Publisher, error) {
+	switch cfg.EventBroker {
+	case BrokerKafka:
+		return NewKafkaPublisher(cfg.KafkaBrokers, KafkaConfig{
+			Mode:        cfg.KafkaProducerMode,
+			Partitioner: cfg.KafkaPartitioner,
+			Linger:      cfg.KafkaLinger,
+			BatchSize:   cfg.KafkaBatchSize,
+			Compression: cfg.KafkaCompression,
+			Idempotent:  cfg.KafkaIdempotent,
+		}, spool, logger)
+	case BrokerRedis:
+		return NewRedisStreamPublisher(redisClient, int64(cfg.RedisStreamMaxLen), logger), nil
+	case BrokerNATS:
+		return NewNATSPublisher(cfg.NATSURL, logger)
+	case BrokerMemory:
+		return inProcessBroker(logger), nil
+	case BrokerWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("WEBHOOK_URL is required for the webhook event broker")
+		}
+		return NewWebhookPublisher(cfg.WebhookURL, cfg.WebhookTimeout, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown event broker %q", cfg.EventBroker)
+	}
+}
+
+// NewSubscriber creates the subscriber for cfg.EventBroker in consumer group cfg.EventConsumerGroup
+func NewSubscriber(cfg *config.Config, redisClient *redis.Client, logger *slog.Logger) (Subscriber, error) {
+	switch cfg.EventBroker {
+	case BrokerKafka:
+		return NewKafkaSubscriber(cfg.KafkaBrokers, cfg.EventConsumerGroup, logger)
+	case BrokerRedis:
+		return NewRedisStreamSubscriber(redisClient, cfg.EventConsumerGroup, logger), nil
+	case BrokerNATS:
+		return NewNATSSubscriber(cfg.NATSURL, cfg.EventConsumerGroup, logger)
+	case BrokerMemory:
+		return inProcessBroker(logger), nil
+	case BrokerWebhook:
+		return nil, fmt.Errorf("the webhook event broker has no subscriber")
+	default:
+		return nil, fmt.Errorf("unknown event broker %q", cfg.EventBroker)
+	}
+}
@@ -0,0 +1,161 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/tracing"
+	"ad-tracking-system/internal/utils/metrics"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Partitioner strategies
+const (
+	PartitionerHash       = "hash"    // FNV-1a hash of the key (sarama default)
+	PartitionerMurmur2    = "murmur2" // Same partitions as the Java client for a given key
+	PartitionerRoundRobin = "roundrobin"
+	PartitionerRandom     = "random"
+)
+
+// Kafka producer modes
+const (
+	ModeSync  = "sync"  // Publish waits for the broker acknowledgement
+	ModeAsync = "async" // Publish enqueues the message; delivery is batched in the background
+)
+
+// KafkaConfig holds the Kafka producer settings
+type KafkaConfig struct {
+	Mode        string        // ModeSync or ModeAsync
+	Partitioner string        // See NewPartitioner
+	Linger      time.Duration // Async only: how long to wait for a batch to fill
+	BatchSize   int           // Async only: messages per batch; 0 leaves batching to Linger
+	Compression string        // none, gzip, snappy, lz4 or zstd
+	Idempotent  bool          // Exactly-once delivery per partition
+}
+
+// NewPartitioner returns the sarama partitioner for a strategy name
+func NewPartitioner(strategy string) (sarama.PartitionerConstructor, error) {
+	switch strategy {
+	case "", PartitionerHash:
+		return sarama.NewHashPartitioner, nil
+	case PartitionerMurmur2:
+		return sarama.NewReferenceHashPartitioner, nil
+	case PartitionerRoundRobin:
+		return sarama.NewRoundRobinPartitioner, nil
+	case PartitionerRandom:
+		return sarama.NewRandomPartitioner, nil
+	default:
+		return nil, fmt.Errorf("unknown Kafka partitioner %q", strategy)
+	}
+}
+
+// NewSaramaConfig translates a KafkaConfig into a sarama configuration
+func NewSaramaConfig(cfg KafkaConfig) (*sarama.Config, error) {
+	partitioner, err := NewPartitioner(cfg.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+
+	config := sarama.NewConfig()
+	config.Producer.Partitioner = partitioner
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+
+	if cfg.Compression != "" {
+		if err := config.Producer.Compression.UnmarshalText([]byte(cfg.Compression)); err != nil {
+			return nil, fmt.Errorf("invalid Kafka compression %q: %w", cfg.Compression, err)
+		}
+	}
+
+	if cfg.Idempotent {
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1 // Required to keep ordering with retries
+	}
+
+	if cfg.Mode == ModeAsync {
+		config.Producer.Flush.Frequency = cfg.Linger
+		config.Producer.Flush.Messages = cfg.BatchSize
+	}
+
+	return config, config.Validate()
+}
+
+// NewProducerMessage builds the sarama message for msg, adding the producer-host header
+func NewProducerMessage(topic string, msg Message) *sarama.ProducerMessage {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	if _, ok := msg.Headers[HeaderProducerHost]; !ok {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(HeaderProducerHost), Value: []byte(hostname)})
+	}
+
+	pm := &sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+	if msg.Key != "" {
+		pm.Key = sarama.StringEncoder(msg.Key)
+	}
+	return pm
+}
+
+// NewKafkaEnvelope wraps a consumed sarama message
+func NewKafkaEnvelope(msg *sarama.ConsumerMessage) *Envelope {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, h := range msg.Headers {
+		if h != nil {
+			headers[string(h.Key)] = string(h.Value)
+		}
+	}
+	return newEnvelope(msg.Topic, msg.Partition, msg.Offset, msg.Timestamp, string(msg.Key), msg.Value, headers)
+}
+
+// StartKafkaConsumerSpan starts the span of processing msg, continuing the
+// trace found in its headers
+func StartKafkaConsumerSpan(ctx context.Context, msg *sarama.ConsumerMessage) (context.Context, trace.Span) {
+	envelope := NewKafkaEnvelope(msg)
+	return StartConsumerSpan(tracing.Extract(ctx, envelope.Headers), BrokerKafka, msg.Topic, msg.Partition, msg.Offset)
+}
+
+// messageFromProducerMessage recovers the Message a sarama message was built from
+func messageFromProducerMessage(pm *sarama.ProducerMessage) Message {
+	msg := Message{Headers: make(map[string]string, len(pm.Headers))}
+	if pm.Key != nil {
+		if key, err := pm.Key.Encode(); err == nil {
+			msg.Key = string(key)
+		}
+	}
+	if pm.Value != nil {
+		msg.Value, _ = pm.Value.Encode()
+	}
+	for _, h := range pm.Headers {
+		msg.Headers[string(h.Key)] = string(h.Value)
+	}
+	return msg
+}
+
+var hostname = func() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return name
+}()
+
+// RecordConsumerLag sets the lag of group on the partition of msg: the
+// messages after msg that it has yet to consume
+func RecordConsumerLag(group string, claim sarama.ConsumerGroupClaim, msg *sarama.ConsumerMessage) {
+	lag := claim.HighWaterMarkOffset() - msg.Offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	metrics.KafkaConsumerLag.WithLabelValues(group, msg.Topic, strconv.Itoa(int(msg.Partition))).Set(float64(lag))
+}
@@ -0,0 +1,224 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sony/gobreaker"
+)
+
+// KafkaPublisher publishes messages to Kafka through a circuit breaker.
+// Messages that cannot be published, for instance while the breaker is open,
+// are written to the spool and published in order by Run once Kafka is
+// reachable again.
+type KafkaPublisher struct {
+	client   sarama.Client
+	producer sarama.SyncProducer
+	async    sarama.AsyncProducer
+	cb       *gobreaker.CircuitBreaker
+	spool    *DiskSpool
+	logger   *slog.Logger
+	wg       sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+
+	pingMu  sync.Mutex
+	refresh *metadataRefresh // In flight, nil when none is
+}
+
+// metadataRefresh is one RefreshMetadata call shared by concurrent pings
+type metadataRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// NewKafkaPublisher creates a new Kafka publisher. spool may be nil, in which
+// case publish errors are returned and async delivery failures only logged.
+func NewKafkaPublisher(brokers []string, cfg KafkaConfig, spool *DiskSpool, logger *slog.Logger) (*KafkaPublisher, error) {
+	config, err := NewSaramaConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Mode != "" && cfg.Mode != ModeSync && cfg.Mode != ModeAsync {
+		return nil, fmt.Errorf("unknown Kafka producer mode %q", cfg.Mode)
+	}
+
+	// The producer shares its client with Ping, so health checks reuse its connections
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	p := &KafkaPublisher{
+		client: client,
+		cb:     circuitbreaker.NewCircuitBreaker("kafka-producer", logger),
+		spool:  spool,
+		logger: logger,
+	}
+
+	if cfg.Mode == ModeAsync {
+		if p.async, err = sarama.NewAsyncProducerFromClient(client); err != nil {
+			client.Close()
+			return nil, err
+		}
+		p.wg.Add(2)
+		go p.drainSuccesses()
+		go p.drainErrors()
+	} else if p.producer, err = sarama.NewSyncProducerFromClient(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Publish publishes msg to topic. In async mode it returns once the message is
+// queued; delivery failures are counted and spooled.
+func (p *KafkaPublisher) Publish(ctx context.Context, topic string, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Keep messages in order: while older ones are spooled, new ones queue behind them
+	if p.spool != nil && p.spool.Pending() {
+		return p.spool.Append(topic, msg)
+	}
+
+	err := p.send(ctx, topic, msg)
+	if err != nil && p.spool != nil && ctx.Err() == nil {
+		p.logger.WarnContext(ctx, "Failed to publish message to Kafka, spooling it", "topic", topic, "error", err)
+		return p.spool.Append(topic, msg)
+	}
+	return err
+}
+
+// send publishes one message through the circuit breaker
+func (p *KafkaPublisher) send(ctx context.Context, topic string, msg Message) error {
+	_, err := circuitbreaker.Execute(ctx, p.cb, func(ctx context.Context) (interface{}, error) {
+		pm := NewProducerMessage(topic, msg)
+
+		if p.async != nil {
+			pm.Metadata = time.Now()
+			select {
+			case p.async.Input() <- pm:
+				return nil, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		// SendMessage cannot be interrupted, so it runs on its own goroutine and
+		// the caller stops waiting when ctx is done. The message may then still
+		// be delivered, which the at-least-once consumers already tolerate.
+		done := make(chan error, 1)
+		go func() { done <- p.sendSync(topic, pm) }()
+		select {
+		case err := <-done:
+			return nil, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+	return err
+}
+
+// sendSync publishes one message with the sync producer and records the outcome
+func (p *KafkaPublisher) sendSync(topic string, pm *sarama.ProducerMessage) error {
+	start := time.Now()
+	if _, _, err := p.producer.SendMessage(pm); err != nil {
+		publishedTotal.WithLabelValues(topic, "error").Inc()
+		return err
+	}
+	publishedTotal.WithLabelValues(topic, "success").Inc()
+	publishLatency.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+	return nil
+}
+
+// Run drains the spool whenever the circuit breaker is not open, until ctx is cancelled
+func (p *KafkaPublisher) Run(ctx context.Context, interval time.Duration) {
+	if p.spool == nil {
+		return
+	}
+	RunSpoolDrainer(ctx, p.spool, interval,
+		func() bool { return p.cb.State() != gobreaker.StateOpen },
+		func(topic string, msg Message) error { return p.send(ctx, topic, msg) },
+	)
+}
+
+func (p *KafkaPublisher) drainSuccesses() {
+	defer p.wg.Done()
+	for pm := range p.async.Successes() {
+		publishedTotal.WithLabelValues(pm.Topic, "success").Inc()
+		if enqueued, ok := pm.Metadata.(time.Time); ok {
+			publishLatency.WithLabelValues(pm.Topic).Observe(time.Since(enqueued).Seconds())
+		}
+	}
+}
+
+func (p *KafkaPublisher) drainErrors() {
+	defer p.wg.Done()
+	for perr := range p.async.Errors() {
+		publishedTotal.WithLabelValues(perr.Msg.Topic, "error").Inc()
+		p.logger.Error("Failed to publish message to Kafka", "topic", perr.Msg.Topic, "error", perr.Err)
+
+		if p.spool == nil {
+			continue
+		}
+		if err := p.spool.Append(perr.Msg.Topic, messageFromProducerMessage(perr.Msg)); err != nil {
+			spoolErrorsTotal.Inc()
+			p.logger.Error("Failed to spool undelivered message, it is lost", "topic", perr.Msg.Topic, "error", err)
+		}
+	}
+}
+
+// Ping refreshes the cluster metadata, which needs at least one reachable
+// broker. RefreshMetadata cannot be interrupted, so Ping stops waiting when ctx
+// is done and later pings wait for the same refresh rather than starting
+// another; a hung refresh holds one goroutine, however often Ping is called.
+func (p *KafkaPublisher) Ping(ctx context.Context) error {
+	p.pingMu.Lock()
+	refresh := p.refresh
+	if refresh == nil {
+		refresh = &metadataRefresh{done: make(chan struct{})}
+		p.refresh = refresh
+		go func() {
+			refresh.err = p.client.RefreshMetadata()
+			p.pingMu.Lock()
+			p.refresh = nil
+			p.pingMu.Unlock()
+			close(refresh.done)
+		}()
+	}
+	p.pingMu.Unlock()
+
+	select {
+	case <-refresh.done:
+		return refresh.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close shuts down the Kafka producer, flushing any queued messages first.
+// Sarama panics when a producer is closed twice, so later calls only return
+// the result of the first.
+func (p *KafkaPublisher) Close() error {
+	p.closeOnce.Do(func() {
+		if p.async != nil {
+			p.async.AsyncClose()
+			p.wg.Wait()
+		} else {
+			p.closeErr = p.producer.Close()
+		}
+		if err := p.client.Close(); p.closeErr == nil {
+			p.closeErr = err
+		}
+	})
+	return p.closeErr
+}
@@ -0,0 +1,102 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"ad-tracking-system/internal/utils/metrics"
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/sony/gobreaker"
+)
+
+// KafkaSubscriber consumes topics as a member of a Kafka consumer group.
+// Handlers run through a circuit breaker (see handleWithBreaker).
+type KafkaSubscriber struct {
+	groupID string
+	group   sarama.ConsumerGroup
+	cb      *gobreaker.CircuitBreaker
+	logger  *slog.Logger
+}
+
+// NewKafkaSubscriber creates a subscriber in consumer group groupID. A group
+// without committed offsets starts at the newest messages.
+func NewKafkaSubscriber(brokers []string, groupID string, logger *slog.Logger) (*KafkaSubscriber, error) {
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+
+	group, err := sarama.NewConsumerGroup(brokers, groupID, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaSubscriber{
+		groupID: groupID,
+		group:   group,
+		cb:      circuitbreaker.NewCircuitBreaker("kafka-consumer", logger),
+		logger:  logger,
+	}, nil
+}
+
+// Subscribe consumes topic until ctx is cancelled or the subscriber is closed.
+// Messages are marked consumed once handled; handler errors are logged.
+func (s *KafkaSubscriber) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	s.logger.InfoContext(ctx, "Started consuming messages", "topic", topic, "group", s.groupID)
+
+	for {
+		err := s.group.Consume(ctx, []string{topic}, &groupHandler{subscriber: s, handler: handler})
+		if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+			return nil
+		}
+		if err != nil {
+			s.logger.WarnContext(ctx, "Kafka consumer group session ended", "group", s.groupID, "error", err)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Close leaves the consumer group
+func (s *KafkaSubscriber) Close() error {
+	return s.group.Close()
+}
+
+// groupHandler adapts a Handler to sarama's consumer group interface
+type groupHandler struct {
+	subscriber *KafkaSubscriber
+	handler    Handler
+}
+
+func (h *groupHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (h *groupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := session.Context()
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			start := time.Now()
+			err := handleWithBreaker(ctx, h.subscriber.cb, h.handler, NewKafkaEnvelope(msg))
+			metrics.KafkaProcessingLatency.WithLabelValues(msg.Topic).Observe(time.Since(start).Seconds())
+			RecordConsumerLag(h.subscriber.groupID, claim, msg)
+			if err != nil {
+				if ctx.Err() != nil {
+					// Not marked, the message is redelivered to the next owner of the partition
+					return nil
+				}
+				h.subscriber.logger.ErrorContext(ctx, "Failed to process message", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+			}
+			session.MarkMessage(msg, "")
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/logging"
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"ad-tracking-system/internal/utils/metrics"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeSession is a consumer group session recording the marked offsets
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+// fakeClaim claims one partition holding the messages of its channel
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages      chan *sarama.ConsumerMessage
+	highWaterMark int64
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return c.highWaterMark }
+
+// latencySamples returns the number of observations of the processing latency of topic
+func latencySamples(t *testing.T, topic string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.KafkaProcessingLatency.WithLabelValues(topic).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestKafkaSubscriberRecordsLagAndLatency(t *testing.T) {
+	const topic = "lag-test-clicks"
+	subscriber := &KafkaSubscriber{
+		groupID: "lag-test",
+		cb:      circuitbreaker.NewCircuitBreaker("lag-test", logging.Discard()),
+		logger:  logging.Discard(),
+	}
+	handled := 0
+	handler := &groupHandler{subscriber: subscriber, handler: func(ctx context.Context, envelope *Envelope) error {
+		handled++
+		if envelope.Offset == 11 {
+			return errors.New("cannot store click")
+		}
+		return nil
+	}}
+
+	// Offsets 10 to 12 of a partition whose next offset is 20
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 3), highWaterMark: 20}
+	for offset := int64(10); offset <= 12; offset++ {
+		claim.messages <- &sarama.ConsumerMessage{Topic: topic, Partition: 3, Offset: offset, Timestamp: time.Now()}
+	}
+	close(claim.messages)
+	session := &fakeSession{ctx: context.Background()}
+
+	before := latencySamples(t, topic)
+	if err := handler.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+
+	if handled != 3 || len(session.marked) != 3 {
+		t.Errorf("handled %d messages and marked %v, want all 3 of them: failures are logged and skipped", handled, session.marked)
+	}
+	if got := latencySamples(t, topic) - before; got != 3 {
+		t.Errorf("%d processing latency samples, want 3", got)
+	}
+	// Offsets 13 to 19 are left
+	if lag := testutil.ToFloat64(metrics.KafkaConsumerLag.WithLabelValues("lag-test", topic, "3")); lag != 7 {
+		t.Errorf("kafka_consumer_lag = %g, want 7", lag)
+	}
+}
@@ -0,0 +1,146 @@
+package messaging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// MemoryBroker is an in-process Publisher and Subscriber, for tests and for
+// running without a broker. Each topic is a single partition kept in memory;
+// every subscription receives every retained message of its topic from the
+// oldest one.
+type MemoryBroker struct {
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+	maxLen int
+	notify chan struct{} // Closed and replaced whenever a message is published
+	closed bool
+	logger *slog.Logger
+}
+
+// memoryTopic holds the retained messages of a topic; first is the offset of
+// messages[0]
+type memoryTopic struct {
+	first    int64
+	messages []*Envelope
+}
+
+// NewMemoryBroker creates an empty MemoryBroker keeping the newest maxLen
+// messages of each topic; 0 keeps every message
+func NewMemoryBroker(maxLen int, logger *slog.Logger) *MemoryBroker {
+	return &MemoryBroker{
+		topics: make(map[string]*memoryTopic),
+		maxLen: maxLen,
+		notify: make(chan struct{}),
+		logger: logger,
+	}
+}
+
+// Publish appends msg to topic and wakes up its subscribers
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	headers := make(map[string]string, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	if _, ok := headers[HeaderProducerHost]; !ok {
+		headers[HeaderProducerHost] = hostname
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+
+	t := b.topics[topic]
+	if t == nil {
+		t = &memoryTopic{}
+		b.topics[topic] = t
+	}
+	offset := t.first + int64(len(t.messages))
+	t.messages = append(t.messages, newEnvelope(topic, 0, offset, time.Now(), msg.Key, msg.Value, headers))
+	if b.maxLen > 0 && len(t.messages) > b.maxLen {
+		// The dropped messages are freed once append reallocates
+		drop := len(t.messages) - b.maxLen
+		t.first += int64(drop)
+		t.messages = t.messages[drop:]
+	}
+	b.broadcast()
+	return nil
+}
+
+// Subscribe passes every retained message of topic to handler in order, then
+// waits for new ones until ctx is cancelled or the broker is closed. Handler
+// errors are logged and the message is not redelivered. A subscription that
+// falls more than maxLen messages behind skips the dropped ones.
+func (b *MemoryBroker) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	next := int64(-1)
+	for {
+		b.mu.Lock()
+		var pending []*Envelope
+		if t := b.topics[topic]; t != nil {
+			if next < t.first {
+				if next >= 0 {
+					b.logger.WarnContext(ctx, "Subscription fell behind, skipping dropped messages", "topic", topic, "skipped", t.first-next)
+				}
+				next = t.first
+			}
+			pending = t.messages[next-t.first:]
+		}
+		notify := b.notify
+		closed := b.closed
+		b.mu.Unlock()
+
+		for _, envelope := range pending {
+			if err := handler(ctx, envelope); err != nil {
+				b.logger.ErrorContext(ctx, "Failed to process message", "topic", envelope.Topic, "partition", envelope.Partition, "offset", envelope.Offset, "error", err)
+			}
+			next++
+		}
+		if len(pending) > 0 {
+			continue
+		}
+
+		if closed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-notify:
+		}
+	}
+}
+
+// Messages returns the retained messages of topic
+func (b *MemoryBroker) Messages(topic string) []*Envelope {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t := b.topics[topic]; t != nil {
+		return append([]*Envelope(nil), t.messages...)
+	}
+	return nil
+}
+
+// Close stops the subscriptions once they have handled the published messages
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.broadcast()
+	}
+	return nil
+}
+
+// broadcast wakes up waiting subscribers; b.mu must be held
+func (b *MemoryBroker) broadcast() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
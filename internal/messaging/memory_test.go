@@ -0,0 +1,112 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/logging"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryBrokerRoundTrip(t *testing.T) {
+	broker := NewMemoryBroker(0, logging.Discard())
+	var publisher Publisher = broker
+	var subscriber Subscriber = broker
+	ctx := context.Background()
+
+	for _, key := range []string{"ad-1", "ad-2", "ad-1"} {
+		msg := Message{Key: key, Value: []byte("click on " + key), Headers: map[string]string{HeaderEventType: "click", HeaderTraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+		if err := publisher.Publish(ctx, "clicks", msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := publisher.Publish(ctx, "other", Message{Key: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan *Envelope, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- subscriber.Subscribe(ctx, "clicks", func(ctx context.Context, envelope *Envelope) error {
+			received <- envelope
+			if envelope.Offset == 1 {
+				return errors.New("handler failed") // Logged, not redelivered
+			}
+			return nil
+		})
+	}()
+
+	// Messages published after the subscription started are delivered too
+	if err := publisher.Publish(ctx, "clicks", Message{Key: "ad-3", Value: []byte("click on ad-3")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, wantKey := range []string{"ad-1", "ad-2", "ad-1", "ad-3"} {
+		select {
+		case envelope := <-received:
+			if envelope.Key != wantKey || envelope.Offset != int64(i) || envelope.Topic != "clicks" {
+				t.Errorf("message %d = %s at offset %d of %s, want %s at offset %d", i, envelope.Key, envelope.Offset, envelope.Topic, wantKey, i)
+			}
+			if string(envelope.Value) != "click on "+wantKey {
+				t.Errorf("message %d value = %q", i, envelope.Value)
+			}
+			if i < 3 && (envelope.EventType != "click" || envelope.TraceParent == "" || envelope.ProducerHost == "") {
+				t.Errorf("message %d headers not decoded: %+v", i, envelope)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("message %d not delivered", i)
+		}
+	}
+
+	// Closing ends the subscription and refuses further messages
+	if err := subscriber.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Subscribe() = %v after Close", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscribe() did not return after Close")
+	}
+	if err := publisher.Publish(ctx, "clicks", Message{Key: "late"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish() after Close = %v, want ErrClosed", err)
+	}
+	if len(received) != 0 {
+		t.Errorf("%d messages delivered twice", len(received))
+	}
+}
+
+func TestMemoryBrokerKeepsNewestMessages(t *testing.T) {
+	broker := NewMemoryBroker(3, logging.Discard())
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		if err := broker.Publish(ctx, "clicks", Message{Key: "ad"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := broker.Messages("clicks")
+	if len(messages) != 3 || messages[0].Offset != 7 || messages[2].Offset != 9 {
+		t.Fatalf("retained %d messages from offset %d, want offsets 7 to 9", len(messages), messages[0].Offset)
+	}
+
+	// A new subscription starts at the oldest retained message
+	received := make(chan int64, 10)
+	go broker.Subscribe(ctx, "clicks", func(ctx context.Context, envelope *Envelope) error {
+		received <- envelope.Offset
+		return nil
+	})
+	for want := int64(7); want < 10; want++ {
+		select {
+		case offset := <-received:
+			if offset != want {
+				t.Errorf("offset = %d, want %d", offset, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("offset %d not delivered", want)
+		}
+	}
+	broker.Close()
+}
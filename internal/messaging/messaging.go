@@ -0,0 +1,111 @@
+// Package messaging publishes and consumes events independently of the broker.
+// Publishers and subscribers are wrapped with middleware for cross-cutting
+// concerns such as metrics, tracing and retries.
+package messaging
+
+import (
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// Header names set on every published message
+const (
+	HeaderEventType     = "event-type"
+	HeaderSchemaID      = "schema-id"
+	HeaderSchemaVersion = "schema-version"
+	HeaderProducerHost  = "producer-host"
+	HeaderTraceParent   = "traceparent" // W3C trace context
+	HeaderTraceState    = "tracestate"
+)
+
+// breakerOpenBackoff is how long a subscriber waits before retrying a message
+// while its circuit breaker is open
+const breakerOpenBackoff = time.Second
+
+// ErrClosed is returned when publishing to or subscribing on a closed broker
+var ErrClosed = errors.New("messaging: closed")
+
+// Message is a message to publish
+type Message struct {
+	Key     string // Messages with the same key go to the same partition, in order
+	Value   []byte
+	Headers map[string]string
+}
+
+// Envelope is a consumed message with its metadata and well-known headers decoded
+type Envelope struct {
+	ID        string // Broker-assigned ID for brokers without offsets, such as Redis Streams
+	Topic     string
+	Partition int32
+	Offset    int64 // Kafka offset or JetStream stream sequence
+	Timestamp time.Time
+	Key       string
+	Value     []byte
+
+	EventType     string
+	SchemaVersion string
+	ProducerHost  string
+	TraceParent   string
+	TraceState    string
+	Headers       map[string]string // All headers, including the ones above
+}
+
+// Publisher publishes messages to topics
+type Publisher interface {
+	Publish(ctx context.Context, topic string, msg Message) error
+	Close() error
+}
+
+// Handler processes one consumed message. Returning an error reports the
+// message as failed; whether it is redelivered depends on the Subscriber.
+type Handler func(ctx context.Context, envelope *Envelope) error
+
+// Subscriber delivers the messages of a topic to a handler
+type Subscriber interface {
+	// Subscribe calls handler for every message of topic until ctx is
+	// cancelled or the subscriber is closed
+	Subscribe(ctx context.Context, topic string, handler Handler) error
+	Close() error
+}
+
+// newEnvelope builds an envelope, decoding the well-known headers
+func newEnvelope(topic string, partition int32, offset int64, timestamp time.Time, key string, value []byte, headers map[string]string) *Envelope {
+	return &Envelope{
+		Topic:         topic,
+		Partition:     partition,
+		Offset:        offset,
+		Timestamp:     timestamp,
+		Key:           key,
+		Value:         value,
+		EventType:     headers[HeaderEventType],
+		SchemaVersion: headers[HeaderSchemaVersion],
+		ProducerHost:  headers[HeaderProducerHost],
+		TraceParent:   headers[HeaderTraceParent],
+		TraceState:    headers[HeaderTraceState],
+		Headers:       headers,
+	}
+}
+
+// handleWithBreaker runs handler through cb. While cb is open the message is
+// held back and retried rather than skipped, so nothing is lost while a
+// dependency of the handler is down.
+func handleWithBreaker(ctx context.Context, cb *gobreaker.CircuitBreaker, handler Handler, envelope *Envelope) error {
+	for {
+		_, err := circuitbreaker.Execute(ctx, cb, func(ctx context.Context) (interface{}, error) {
+			return nil, handler(ctx, envelope)
+		})
+		if !errors.Is(err, gobreaker.ErrOpenState) && !errors.Is(err, gobreaker.ErrTooManyRequests) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(breakerOpenBackoff):
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package messaging
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// Messages passed through PublishMetrics, by topic and result (success or error)
+	messagesPublishedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "messaging_messages_published_total",
+			Help: "Total number of messages published, by topic and result",
+		},
+		[]string{"topic", "result"},
+	)
+
+	// Time spent in Publish, including any spooling and retries
+	publishDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "messaging_publish_duration_seconds",
+			Help:    "Time spent publishing a message, by topic",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"topic"},
+	)
+
+	// Messages passed through HandlerMetrics, by topic and result
+	messagesHandledTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "messaging_messages_handled_total",
+			Help: "Total number of consumed messages handled, by topic and result",
+		},
+		[]string{"topic", "result"},
+	)
+
+	// Time spent in message handlers
+	handleDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "messaging_handle_duration_seconds",
+			Help:    "Time spent handling a consumed message, by topic",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"topic"},
+	)
+)
+
+var (
+	// Messages published to Kafka, by topic and result (success or error)
+	publishedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_messages_published_total",
+			Help: "Total number of messages published to Kafka, by result",
+		},
+		[]string{"topic", "result"},
+	)
+
+	// Time from Publish to broker acknowledgement
+	publishLatency = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "kafka_publish_latency_seconds",
+			Help:    "Time from publishing a message to its acknowledgement by Kafka",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"topic"},
+	)
+
+	// Undelivered messages that could not be written to the spool either
+	spoolErrorsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kafka_spool_errors_total",
+			Help: "Total number of undelivered messages that could not be spooled",
+		},
+	)
+)
+
+var (
+	// Size of the on-disk spool
+	spoolBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "kafka_spool_bytes",
+			Help: "Bytes of undelivered messages held in the on-disk spool",
+		},
+	)
+
+	// Messages written to the spool
+	spoolAppendedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kafka_spool_appended_total",
+			Help: "Total number of messages written to the on-disk spool",
+		},
+	)
+
+	// Messages drained from the spool to Kafka
+	spoolDrainedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kafka_spool_drained_total",
+			Help: "Total number of spooled messages published to Kafka",
+		},
+	)
+
+	// Messages rejected because the spool was full
+	spoolRejectedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kafka_spool_rejected_total",
+			Help: "Total number of messages rejected because the spool was full",
+		},
+	)
+
+	// Corrupt or torn records skipped while draining
+	spoolCorruptTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "kafka_spool_corrupt_records_total",
+			Help: "Total number of corrupt spool records skipped while draining",
+		},
+	)
+)
@@ -0,0 +1,166 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/tracing"
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PublishFunc publishes one message
+type PublishFunc func(ctx context.Context, topic string, msg Message) error
+
+// PublishMiddleware wraps a PublishFunc
+type PublishMiddleware func(next PublishFunc) PublishFunc
+
+// HandlerMiddleware wraps a Handler
+type HandlerMiddleware func(next Handler) Handler
+
+// WithPublishMiddleware returns a Publisher that passes every message through
+// middlewares before pub; the first middleware is the outermost
+func WithPublishMiddleware(pub Publisher, middlewares ...PublishMiddleware) Publisher {
+	publish := PublishFunc(pub.Publish)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		publish = middlewares[i](publish)
+	}
+	return &middlewarePublisher{Publisher: pub, publish: publish}
+}
+
+type middlewarePublisher struct {
+	Publisher
+	publish PublishFunc
+}
+
+func (p *middlewarePublisher) Publish(ctx context.Context, topic string, msg Message) error {
+	return p.publish(ctx, topic, msg)
+}
+
+// WithHandlerMiddleware wraps handler in middlewares; the first middleware is the outermost
+func WithHandlerMiddleware(handler Handler, middlewares ...HandlerMiddleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// PublishMetrics counts published messages and times Publish, by topic
+func PublishMetrics() PublishMiddleware {
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, topic string, msg Message) error {
+			start := time.Now()
+			err := next(ctx, topic, msg)
+			messagesPublishedTotal.WithLabelValues(topic, result(err)).Inc()
+			publishDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// HandlerMetrics counts handled messages and times the handler, by topic
+func HandlerMetrics() HandlerMiddleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, envelope *Envelope) error {
+			start := time.Now()
+			err := next(ctx, envelope)
+			messagesHandledTotal.WithLabelValues(envelope.Topic, result(err)).Inc()
+			handleDuration.WithLabelValues(envelope.Topic).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// PublishRetry retries a failed publish up to attempts times in total, doubling
+// backoff after every attempt
+func PublishRetry(attempts int, backoff time.Duration) PublishMiddleware {
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, topic string, msg Message) error {
+			return retry(ctx, attempts, backoff, func() error { return next(ctx, topic, msg) })
+		}
+	}
+}
+
+// HandlerRetry retries a failed handler up to attempts times in total, doubling
+// backoff after every attempt
+func HandlerRetry(attempts int, backoff time.Duration) HandlerMiddleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, envelope *Envelope) error {
+			return retry(ctx, attempts, backoff, func() error { return next(ctx, envelope) })
+		}
+	}
+}
+
+// PublishTracing publishes every message in a producer span and adds the
+// span's W3C trace context to the message headers, so that consumers continue
+// the trace. system names the broker, e.g. "kafka".
+func PublishTracing(system string) PublishMiddleware {
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, topic string, msg Message) error {
+			ctx, span := tracing.Start(ctx, topic+" publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+				attribute.String("messaging.system", system),
+				attribute.String("messaging.destination.name", topic),
+				attribute.String("messaging.operation.type", "publish"),
+			))
+
+			headers := make(map[string]string, len(msg.Headers)+2)
+			for k, v := range msg.Headers {
+				headers[k] = v
+			}
+			tracing.Inject(ctx, headers)
+			msg.Headers = headers
+
+			err := next(ctx, topic, msg)
+			tracing.End(span, err)
+			return err
+		}
+	}
+}
+
+// HandlerTracing handles every message in a consumer span continuing the
+// trace found in the message headers. system names the broker, e.g. "kafka".
+func HandlerTracing(system string) HandlerMiddleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, envelope *Envelope) error {
+			ctx, span := StartConsumerSpan(tracing.Extract(ctx, envelope.Headers), system, envelope.Topic, envelope.Partition, envelope.Offset)
+			err := next(ctx, envelope)
+			tracing.End(span, err)
+			return err
+		}
+	}
+}
+
+// StartConsumerSpan starts the span of processing a consumed message. ctx
+// should carry the trace context extracted from the message headers.
+func StartConsumerSpan(ctx context.Context, system, topic string, partition int32, offset int64) (context.Context, trace.Span) {
+	return tracing.Start(ctx, topic+" process", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+		attribute.String("messaging.system", system),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.operation.type", "process"),
+		attribute.Int("messaging.destination.partition.id", int(partition)),
+		attribute.Int64("messaging.kafka.offset", offset),
+	))
+}
+
+func retry(ctx context.Context, attempts int, backoff time.Duration, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || attempt >= attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
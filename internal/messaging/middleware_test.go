@@ -0,0 +1,54 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/tracing"
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingHeaders(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), tracing.Config{Exporter: tracing.ExporterNone}); err != nil {
+		t.Fatal(err)
+	}
+
+	var published Message
+	publish := PublishTracing("kafka")(func(ctx context.Context, topic string, msg Message) error {
+		published = msg
+		return nil
+	})
+
+	// Without a trace in ctx there is no trace context to send
+	if err := publish(context.Background(), "clicks", Message{Key: "acme/ad-1", Headers: map[string]string{HeaderEventType: "click"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := published.Headers[HeaderTraceParent]; ok || published.Headers[HeaderEventType] != "click" {
+		t.Errorf("headers without a trace = %v", published.Headers)
+	}
+
+	// A request's trace is sent on with its state
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := tracing.Extract(context.Background(), map[string]string{"traceparent": traceParent, "tracestate": "vendor=abc"})
+	if err := publish(ctx, "clicks", Message{Key: "acme/ad-1"}); err != nil {
+		t.Fatal(err)
+	}
+	envelope := newEnvelope("clicks", 0, 0, time.Now(), published.Key, published.Value, published.Headers)
+	if envelope.TraceParent != traceParent || envelope.TraceState != "vendor=abc" {
+		t.Errorf("envelope trace context = %q, %q, want %q, vendor=abc", envelope.TraceParent, envelope.TraceState, traceParent)
+	}
+
+	// and continued by the consumer
+	var traceID string
+	handle := HandlerTracing("kafka")(func(ctx context.Context, envelope *Envelope) error {
+		traceID = trace.SpanContextFromContext(ctx).TraceID().String()
+		return nil
+	})
+	if err := handle(context.Background(), envelope); err != nil {
+		t.Fatal(err)
+	}
+	if traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("consumer trace ID = %s, want the publisher's", traceID)
+	}
+}
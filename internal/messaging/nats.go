@@ -0,0 +1,261 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sony/gobreaker"
+)
+
+// natsHeaderKey carries the message key, which JetStream has no field for
+const natsHeaderKey = "message-key"
+
+// natsFetchWait is how long a subscriber waits for a batch of messages
+const natsFetchWait = 5 * time.Second
+
+// natsMaxDeliver is how often a message is delivered before a subscriber
+// terminates it, so that a message that can never be processed does not come
+// back forever. It is also the consumer's MaxDeliver.
+const natsMaxDeliver = 5
+
+// natsStreams creates a JetStream stream per topic on first use
+type natsStreams struct {
+	js      nats.JetStreamContext
+	mu      sync.Mutex
+	created map[string]bool
+}
+
+// ensure creates the stream for topic if it does not exist and returns its name
+func (s *natsStreams) ensure(topic string) (string, error) {
+	name := natsName(topic)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.created[topic] {
+		return name, nil
+	}
+
+	_, err := s.js.StreamInfo(name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = s.js.AddStream(&nats.StreamConfig{
+			Name:     name,
+			Subjects: []string{topic},
+			Storage:  nats.FileStorage,
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+	s.created[topic] = true
+	return name, nil
+}
+
+// NATSPublisher publishes messages to NATS JetStream, one stream per topic
+// with the topic as its subject
+type NATSPublisher struct {
+	conn    *nats.Conn
+	streams *natsStreams
+	cb      *gobreaker.CircuitBreaker
+}
+
+// NewNATSPublisher connects to the NATS server at url
+func NewNATSPublisher(url string, logger *slog.Logger) (*NATSPublisher, error) {
+	conn, js, err := connectNATS(url)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSPublisher{
+		conn:    conn,
+		streams: &natsStreams{js: js, created: make(map[string]bool)},
+		cb:      circuitbreaker.NewCircuitBreaker("nats-producer", logger),
+	}, nil
+}
+
+// Publish publishes msg and waits for JetStream to store it
+func (p *NATSPublisher) Publish(ctx context.Context, topic string, msg Message) error {
+	m := nats.NewMsg(topic)
+	m.Data = msg.Value
+	for k, v := range msg.Headers {
+		m.Header.Set(k, v)
+	}
+	if _, ok := msg.Headers[HeaderProducerHost]; !ok {
+		m.Header.Set(HeaderProducerHost, hostname)
+	}
+	if msg.Key != "" {
+		m.Header.Set(natsHeaderKey, msg.Key)
+	}
+
+	_, err := circuitbreaker.Execute(ctx, p.cb, func(ctx context.Context) (interface{}, error) {
+		if _, err := p.streams.ensure(topic); err != nil {
+			return nil, err
+		}
+		return p.streams.js.PublishMsg(m, nats.Context(ctx))
+	})
+	return err
+}
+
+// Ping round-trips to the NATS server
+func (p *NATSPublisher) Ping(ctx context.Context) error {
+	if !p.conn.IsConnected() {
+		return fmt.Errorf("not connected to NATS: %s", p.conn.Status())
+	}
+	return p.conn.FlushWithContext(ctx)
+}
+
+// Close closes the NATS connection
+func (p *NATSPublisher) Close() error {
+	p.conn.Close()
+	return nil
+}
+
+// NATSSubscriber consumes JetStream streams through a durable pull consumer
+// per group. Handled messages are acknowledged; failed ones are negatively
+// acknowledged so JetStream redelivers them, up to natsMaxDeliver deliveries.
+type NATSSubscriber struct {
+	conn    *nats.Conn
+	streams *natsStreams
+	group   string
+	cb      *gobreaker.CircuitBreaker
+	logger  *slog.Logger
+}
+
+// NewNATSSubscriber connects to the NATS server at url as consumer group group
+func NewNATSSubscriber(url, group string, logger *slog.Logger) (*NATSSubscriber, error) {
+	conn, js, err := connectNATS(url)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSSubscriber{
+		conn:    conn,
+		streams: &natsStreams{js: js, created: make(map[string]bool)},
+		group:   group,
+		cb:      circuitbreaker.NewCircuitBreaker("nats-consumer", logger),
+		logger:  logger,
+	}, nil
+}
+
+// Subscribe consumes topic until ctx is cancelled or the subscriber is closed
+func (s *NATSSubscriber) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	stream, err := s.streams.ensure(topic)
+	if err != nil {
+		return err
+	}
+	sub, err := s.streams.js.PullSubscribe(topic, natsName(s.group), nats.BindStream(stream), nats.MaxDeliver(natsMaxDeliver))
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	s.logger.InfoContext(ctx, "Started consuming messages", "subject", topic, "group", s.group)
+
+	for ctx.Err() == nil {
+		msgs, err := sub.Fetch(100, nats.MaxWait(natsFetchWait))
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+		if errors.Is(err, nats.ErrConnectionClosed) || errors.Is(err, nats.ErrBadSubscription) {
+			return nil
+		}
+		if err != nil {
+			s.logger.ErrorContext(ctx, "Failed to fetch from subject", "subject", topic, "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, msg := range msgs {
+			envelope := newNATSEnvelope(topic, msg)
+			err := handleWithBreaker(ctx, s.cb, handler, envelope)
+			if err != nil && ctx.Err() != nil {
+				return nil
+			}
+			var deliveries uint64
+			if meta, metaErr := msg.Metadata(); metaErr == nil {
+				deliveries = meta.NumDelivered
+			}
+			s.settle(ctx, msg, envelope, deliveries, err)
+		}
+	}
+	return nil
+}
+
+// natsAcker is the part of *nats.Msg that settles a delivery
+type natsAcker interface {
+	Ack(opts ...nats.AckOpt) error
+	Nak(opts ...nats.AckOpt) error
+	Term(opts ...nats.AckOpt) error
+}
+
+// settle acknowledges a handled message. A failed one is negatively
+// acknowledged for redelivery, or terminated once it has been delivered
+// natsMaxDeliver times.
+func (s *NATSSubscriber) settle(ctx context.Context, msg natsAcker, envelope *Envelope, deliveries uint64, handleErr error) {
+	if handleErr == nil {
+		if err := msg.Ack(); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to acknowledge message", "subject", envelope.Topic, "offset", envelope.Offset, "error", err)
+		}
+		return
+	}
+
+	s.logger.ErrorContext(ctx, "Failed to process message", "subject", envelope.Topic, "offset", envelope.Offset, "deliveries", deliveries, "error", handleErr)
+	if deliveries >= natsMaxDeliver {
+		s.logger.ErrorContext(ctx, "Giving up on message after repeated failures", "subject", envelope.Topic, "offset", envelope.Offset, "deliveries", deliveries)
+		if err := msg.Term(); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to terminate message", "subject", envelope.Topic, "offset", envelope.Offset, "error", err)
+		}
+		return
+	}
+	if err := msg.Nak(); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to negatively acknowledge message", "subject", envelope.Topic, "offset", envelope.Offset, "error", err)
+	}
+}
+
+// Close closes the NATS connection
+func (s *NATSSubscriber) Close() error {
+	s.conn.Close()
+	return nil
+}
+
+func connectNATS(url string) (*nats.Conn, nats.JetStreamContext, error) {
+	conn, err := nats.Connect(url, nats.Name("ad-tracking-system"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, js, nil
+}
+
+// newNATSEnvelope wraps a JetStream message; the stream sequence is its offset
+func newNATSEnvelope(topic string, msg *nats.Msg) *Envelope {
+	headers := make(map[string]string, len(msg.Header))
+	for k := range msg.Header {
+		if k != natsHeaderKey {
+			headers[k] = msg.Header.Get(k)
+		}
+	}
+
+	var offset int64
+	var timestamp time.Time
+	if meta, err := msg.Metadata(); err == nil {
+		offset = int64(meta.Sequence.Stream)
+		timestamp = meta.Timestamp
+	}
+	return newEnvelope(topic, 0, offset, timestamp, msg.Header.Get(natsHeaderKey), msg.Data, headers)
+}
+
+// natsName turns a topic or group into a valid stream or consumer name
+func natsName(name string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(name)
+}
@@ -0,0 +1,47 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/logging"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+// fakeAcker records how a delivery was settled
+type fakeAcker struct {
+	settled string
+}
+
+func (a *fakeAcker) Ack(...nats.AckOpt) error  { a.settled = "ack"; return nil }
+func (a *fakeAcker) Nak(...nats.AckOpt) error  { a.settled = "nak"; return nil }
+func (a *fakeAcker) Term(...nats.AckOpt) error { a.settled = "term"; return nil }
+
+func TestNATSSubscriberSettle(t *testing.T) {
+	s := &NATSSubscriber{logger: logging.Discard()}
+	envelope := &Envelope{Topic: "clicks", Offset: 42}
+	failed := errors.New("cannot process")
+
+	for _, tc := range []struct {
+		name       string
+		deliveries uint64
+		err        error
+		want       string
+	}{
+		{"handled", 1, nil, "ack"},
+		{"handled on redelivery", natsMaxDeliver, nil, "ack"},
+		{"failed", 1, failed, "nak"},
+		{"failed before the last delivery", natsMaxDeliver - 1, failed, "nak"},
+		{"failed on the last delivery", natsMaxDeliver, failed, "term"},
+		{"failed with unknown deliveries", 0, failed, "nak"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &fakeAcker{}
+			s.settle(context.Background(), msg, envelope, tc.deliveries, tc.err)
+			if msg.settled != tc.want {
+				t.Errorf("settled with %s, want %s", msg.settled, tc.want)
+			}
+		})
+	}
+}
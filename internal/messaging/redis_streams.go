@@ -0,0 +1,311 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sony/gobreaker"
+)
+
+// Fields of a stream entry; headers are stored as one field each, prefixed with redisHeaderPrefix
+const (
+	redisFieldKey     = "key"
+	redisFieldValue   = "value"
+	redisHeaderPrefix = "header:"
+)
+
+// redisReadBlock is how long a subscriber blocks waiting for new entries
+const redisReadBlock = 5 * time.Second
+
+// Entries left pending by a consumer that failed or went away, such as the
+// previous pod of a restarted deployment, are claimed by the other consumers
+// of the group once idle for redisClaimIdle; subscribers look for them every
+// redisClaimEvery. An entry delivered redisMaxDeliveries times is given up on
+// and acknowledged, so that a message that can never be processed does not
+// come back forever.
+const (
+	redisClaimIdle     = time.Minute
+	redisClaimEvery    = 30 * time.Second
+	redisMaxDeliveries = 5
+)
+
+// RedisStreamPublisher publishes messages to Redis Streams, one stream per topic
+type RedisStreamPublisher struct {
+	client *redis.Client
+	maxLen int64
+	cb     *gobreaker.CircuitBreaker
+}
+
+// NewRedisStreamPublisher creates a publisher on client. Streams are trimmed
+// to about maxLen entries; 0 keeps every entry.
+func NewRedisStreamPublisher(client *redis.Client, maxLen int64, logger *slog.Logger) *RedisStreamPublisher {
+	return &RedisStreamPublisher{
+		client: client,
+		maxLen: maxLen,
+		cb:     circuitbreaker.NewCircuitBreaker("redis-stream-producer", logger),
+	}
+}
+
+// Publish appends msg to the stream named topic
+func (p *RedisStreamPublisher) Publish(ctx context.Context, topic string, msg Message) error {
+	values := make(map[string]interface{}, len(msg.Headers)+3)
+	values[redisFieldKey] = msg.Key
+	values[redisFieldValue] = msg.Value
+	for k, v := range msg.Headers {
+		values[redisHeaderPrefix+k] = v
+	}
+	if _, ok := msg.Headers[HeaderProducerHost]; !ok {
+		values[redisHeaderPrefix+HeaderProducerHost] = hostname
+	}
+
+	_, err := circuitbreaker.Execute(ctx, p.cb, func(ctx context.Context) (interface{}, error) {
+		return nil, p.client.XAdd(ctx, &redis.XAddArgs{
+			Stream: topic,
+			MaxLen: p.maxLen,
+			Approx: true,
+			Values: values,
+		}).Err()
+	})
+	return err
+}
+
+// Ping checks that Redis is reachable
+func (p *RedisStreamPublisher) Ping(ctx context.Context) error {
+	return p.client.Ping(ctx).Err()
+}
+
+// Close does nothing; the Redis client is owned by the caller
+func (p *RedisStreamPublisher) Close() error {
+	return nil
+}
+
+// RedisStreamSubscriber consumes Redis Streams as a member of a consumer
+// group. Entries are acknowledged with XACK once handled; entries whose
+// handler failed stay pending and are claimed again with XAUTOCLAIM once idle.
+type RedisStreamSubscriber struct {
+	client   *redis.Client
+	group    string
+	consumer string
+	cb       *gobreaker.CircuitBreaker
+	logger   *slog.Logger
+
+	readBlock  time.Duration
+	claimIdle  time.Duration
+	claimEvery time.Duration
+}
+
+// NewRedisStreamSubscriber creates a subscriber in consumer group group,
+// named after the host so a restarted instance picks up its pending entries
+// right away; entries of consumers that are gone are claimed once idle
+func NewRedisStreamSubscriber(client *redis.Client, group string, logger *slog.Logger) *RedisStreamSubscriber {
+	return &RedisStreamSubscriber{
+		client:     client,
+		group:      group,
+		consumer:   hostname,
+		cb:         circuitbreaker.NewCircuitBreaker("redis-stream-consumer", logger),
+		logger:     logger,
+		readBlock:  redisReadBlock,
+		claimIdle:  redisClaimIdle,
+		claimEvery: redisClaimEvery,
+	}
+}
+
+// Subscribe consumes the stream named topic until ctx is cancelled. The
+// consumer group is created at the start of the stream if it does not exist.
+func (s *RedisStreamSubscriber) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	err := s.client.XGroupCreateMkStream(ctx, topic, s.group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	s.logger.InfoContext(ctx, "Started consuming messages", "stream", topic, "group", s.group)
+
+	// Entries delivered to this consumer before a restart but never
+	// acknowledged come first, then new entries (">")
+	next := "0"
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= s.claimEvery {
+			if !s.claim(ctx, topic, handler) {
+				return nil
+			}
+			lastClaim = time.Now()
+		}
+
+		streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.group,
+			Consumer: s.consumer,
+			Streams:  []string{topic, next},
+			Count:    100,
+			Block:    s.readBlock,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			s.logger.ErrorContext(ctx, "Failed to read stream", "stream", topic, "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		var entries []redis.XMessage
+		if len(streams) > 0 {
+			entries = streams[0].Messages
+		}
+		if next != ">" {
+			if len(entries) == 0 {
+				next = ">"
+				continue
+			}
+			next = entries[len(entries)-1].ID
+		}
+
+		for _, entry := range entries {
+			if !s.handle(ctx, topic, handler, entry) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// handle passes entry to handler and acknowledges it once handled, or once it
+// has failed redisMaxDeliveries times. It returns false when ctx is done.
+func (s *RedisStreamSubscriber) handle(ctx context.Context, topic string, handler Handler, entry redis.XMessage) bool {
+	if err := handleWithBreaker(ctx, s.cb, handler, newRedisEnvelope(topic, entry)); err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		s.logger.ErrorContext(ctx, "Failed to process message", "stream", topic, "id", entry.ID, "error", err)
+		deliveries := s.deliveries(ctx, topic, entry.ID)
+		if deliveries < redisMaxDeliveries {
+			return true
+		}
+		s.logger.ErrorContext(ctx, "Giving up on message after repeated failures", "stream", topic, "id", entry.ID, "deliveries", deliveries)
+	}
+	if err := s.client.XAck(ctx, topic, s.group, entry.ID).Err(); err != nil {
+		s.logger.ErrorContext(ctx, "Failed to acknowledge message", "stream", topic, "id", entry.ID, "error", err)
+	}
+	return true
+}
+
+// deliveries returns how often the pending entry id has been delivered, or 0
+// if that cannot be told
+func (s *RedisStreamSubscriber) deliveries(ctx context.Context, topic, id string) int64 {
+	pending, err := s.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: topic,
+		Group:  s.group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return 0
+	}
+	return pending[0].RetryCount
+}
+
+// claim takes over the entries of topic pending for longer than claimIdle,
+// whichever consumer they were delivered to, and handles them. It returns
+// false when ctx is done.
+func (s *RedisStreamSubscriber) claim(ctx context.Context, topic string, handler Handler) bool {
+	start := "0-0"
+	for {
+		next, entries, err := s.autoClaim(ctx, topic, start)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			s.logger.ErrorContext(ctx, "Failed to claim pending messages", "stream", topic, "error", err)
+			return true
+		}
+		for _, entry := range entries {
+			if !s.handle(ctx, topic, handler, entry) {
+				return false
+			}
+		}
+		if next == "0-0" || next == "" {
+			return true
+		}
+		start = next
+	}
+}
+
+// autoClaim runs one XAUTOCLAIM from start and returns the cursor to continue
+// from. It is sent as a raw command since go-redis v8 cannot parse the
+// three-element reply of Redis 7.
+func (s *RedisStreamSubscriber) autoClaim(ctx context.Context, topic, start string) (string, []redis.XMessage, error) {
+	reply, err := s.client.Do(ctx, "XAUTOCLAIM", topic, s.group, s.consumer, s.claimIdle.Milliseconds(), start, "COUNT", 100).Slice()
+	if err != nil {
+		return "", nil, err
+	}
+	if len(reply) < 2 {
+		return "", nil, fmt.Errorf("unexpected XAUTOCLAIM reply of %d elements", len(reply))
+	}
+	next, _ := reply[0].(string)
+	items, _ := reply[1].([]interface{})
+
+	var entries []redis.XMessage
+	for _, item := range items {
+		// Entries trimmed from the stream while pending come back empty
+		pair, ok := item.([]interface{})
+		if !ok || len(pair) != 2 {
+			continue
+		}
+		id, _ := pair[0].(string)
+		fields, _ := pair[1].([]interface{})
+		values := make(map[string]interface{}, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			field, _ := fields[i].(string)
+			values[field] = fields[i+1]
+		}
+		entries = append(entries, redis.XMessage{ID: id, Values: values})
+	}
+	return next, entries, nil
+}
+
+// Close does nothing; the Redis client is owned by the caller
+func (s *RedisStreamSubscriber) Close() error {
+	return nil
+}
+
+// newRedisEnvelope wraps a stream entry; its ID "<ms>-<seq>" gives the timestamp
+func newRedisEnvelope(topic string, entry redis.XMessage) *Envelope {
+	var key string
+	var value []byte
+	headers := make(map[string]string)
+	for field, v := range entry.Values {
+		str, _ := v.(string)
+		switch {
+		case field == redisFieldKey:
+			key = str
+		case field == redisFieldValue:
+			value = []byte(str)
+		case strings.HasPrefix(field, redisHeaderPrefix):
+			headers[strings.TrimPrefix(field, redisHeaderPrefix)] = str
+		}
+	}
+
+	var timestamp time.Time
+	if ms, _, ok := strings.Cut(entry.ID, "-"); ok {
+		if millis, err := strconv.ParseInt(ms, 10, 64); err == nil {
+			timestamp = time.UnixMilli(millis)
+		}
+	}
+
+	envelope := newEnvelope(topic, 0, 0, timestamp, key, value, headers)
+	envelope.ID = entry.ID
+	return envelope
+}
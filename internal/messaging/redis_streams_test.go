@@ -0,0 +1,101 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/logging"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// recordingHandler counts deliveries by message key and fails the keys in fail
+type recordingHandler struct {
+	mu         sync.Mutex
+	deliveries map[string]int
+	fail       map[string]bool
+}
+
+func (h *recordingHandler) handle(ctx context.Context, envelope *Envelope) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.deliveries[envelope.Key]++
+	if h.fail[envelope.Key] {
+		return errors.New("cannot process " + envelope.Key)
+	}
+	return nil
+}
+
+func (h *recordingHandler) count(key string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.deliveries[key]
+}
+
+func newTestRedisSubscriber(client *redis.Client, consumer string, claimIdle time.Duration) *RedisStreamSubscriber {
+	s := NewRedisStreamSubscriber(client, "clicks-consumers", logging.Discard())
+	s.consumer = consumer
+	s.readBlock = 10 * time.Millisecond
+	s.claimIdle = claimIdle
+	s.claimEvery = 0
+	return s
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRedisStreamSubscriberClaimsAndGivesUp(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+
+	publisher := NewRedisStreamPublisher(client, 0, logging.Discard())
+	for _, key := range []string{"good", "poison"} {
+		if err := publisher.Publish(ctx, "clicks", Message{Key: key, Value: []byte(key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first pod fails everything and goes away, leaving both entries
+	// pending under its name
+	gone := &recordingHandler{deliveries: make(map[string]int), fail: map[string]bool{"good": true, "poison": true}}
+	goneCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		newTestRedisSubscriber(client, "pod-1", time.Hour).Subscribe(goneCtx, "clicks", gone.handle)
+		close(done)
+	}()
+	waitFor(t, "the first deliveries", func() bool { return gone.count("good") == 1 && gone.count("poison") == 1 })
+	stop()
+	<-done
+
+	// Its replacement has a new name; it claims the idle entries, handles
+	// one, and gives up on the other after redisMaxDeliveries deliveries
+	replacement := &recordingHandler{deliveries: make(map[string]int), fail: map[string]bool{"poison": true}}
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go newTestRedisSubscriber(client, "pod-2", 0).Subscribe(runCtx, "clicks", replacement.handle)
+
+	waitFor(t, "the pending entries to be acknowledged", func() bool {
+		pending, err := client.XPending(ctx, "clicks", "clicks-consumers").Result()
+		return err == nil && pending.Count == 0
+	})
+	if n := replacement.count("good"); n != 1 {
+		t.Errorf("good message handled %d times by the replacement, want 1", n)
+	}
+	if n := gone.count("poison") + replacement.count("poison"); n != redisMaxDeliveries {
+		t.Errorf("poison message delivered %d times, want %d", n, redisMaxDeliveries)
+	}
+}
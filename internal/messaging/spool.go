@@ -0,0 +1,385 @@
+package messaging
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSpoolFull is returned by Append when the spool has reached its size limit
+var ErrSpoolFull = errors.New("kafka spool is full")
+
+// spooledMessage is the on-disk form of a spooled message
+type spooledMessage struct {
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key,omitempty"`
+	Value   []byte            `json:"value"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+const (
+	segmentSuffix     = ".seg"
+	positionFile      = "drain.pos"
+	recordHeaderBytes = 8 // 4-byte length + 4-byte CRC-32C
+
+	// The drain position is saved every positionInterval published records,
+	// so a crash while draining publishes at most that many again
+	positionInterval = 100
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// DiskSpool is a durable write-ahead spool of messages in append-only segment
+// files. Each record is its length, a CRC-32C checksum and the JSON-encoded
+// message, and is synced to disk before Append returns. Records are drained
+// in the order they were appended; a segment is deleted once fully drained.
+type DiskSpool struct {
+	dir             string
+	maxSegmentBytes int64
+	maxTotalBytes   int64
+	logger          *slog.Logger
+
+	mu         sync.Mutex
+	active     *os.File
+	activeSeq  uint64
+	activeSize int64
+	totalBytes int64
+
+	drainMu sync.Mutex
+}
+
+// NewDiskSpool opens the spool in dir, picking up any segments left by a
+// previous run. Empty ones, such as the active segment of a run that spooled
+// nothing, are removed.
+func NewDiskSpool(dir string, maxSegmentBytes, maxTotalBytes int64, logger *slog.Logger) (*DiskSpool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &DiskSpool{dir: dir, maxSegmentBytes: maxSegmentBytes, maxTotalBytes: maxTotalBytes, logger: logger}
+
+	seqs, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	left := 0
+	for _, seq := range seqs {
+		// Sequence numbers are never reused, even those of removed segments
+		s.activeSeq = seq
+		path := s.segmentPath(seq)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() == 0 {
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		s.totalBytes += info.Size()
+		left++
+	}
+	if left > 0 {
+		logger.Info("Kafka spool has segments left from a previous run", "dir", dir, "segments", left, "bytes", s.totalBytes)
+	}
+
+	// Never append to a segment from a previous run, it may end in a torn record
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	spoolBytes.Set(float64(s.totalBytes))
+	return s, nil
+}
+
+// Append durably writes msg to the spool
+func (s *DiskSpool) Append(topic string, msg Message) error {
+	payload, err := json.Marshal(spooledMessage{
+		Topic:   topic,
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: msg.Headers,
+	})
+	if err != nil {
+		return err
+	}
+	record := make([]byte, recordHeaderBytes+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(payload, crcTable))
+	copy(record[recordHeaderBytes:], payload)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := int64(len(record))
+	if s.maxTotalBytes > 0 && s.totalBytes+size > s.maxTotalBytes {
+		spoolRejectedTotal.Inc()
+		return ErrSpoolFull
+	}
+	if s.activeSize > 0 && s.activeSize+size > s.maxSegmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.active.Write(record); err != nil {
+		return err
+	}
+	if err := s.active.Sync(); err != nil {
+		return err
+	}
+	s.activeSize += size
+	s.totalBytes += size
+	spoolAppendedTotal.Inc()
+	spoolBytes.Set(float64(s.totalBytes))
+	return nil
+}
+
+// Pending reports whether the spool holds undrained messages
+func (s *DiskSpool) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.totalBytes > 0
+}
+
+// Drain passes spooled messages to publish in order, deleting each segment once
+// all its messages are published. It stops at the first publish error and
+// resumes from that message on the next call, or after a crash from the last
+// saved position.
+func (s *DiskSpool) Drain(publish func(topic string, msg Message) error) (int, error) {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	// Seal the active segment so everything appended so far can be drained
+	s.mu.Lock()
+	if s.activeSize > 0 {
+		if err := s.rotate(); err != nil {
+			s.mu.Unlock()
+			return 0, err
+		}
+	}
+	sealed := s.activeSeq
+	s.mu.Unlock()
+
+	seqs, err := s.segments()
+	if err != nil {
+		return 0, err
+	}
+
+	drained := 0
+	for _, seq := range seqs {
+		if seq >= sealed {
+			break
+		}
+		n, err := s.drainSegment(seq, publish)
+		drained += n
+		if err != nil {
+			return drained, err
+		}
+	}
+	return drained, nil
+}
+
+func (s *DiskSpool) drainSegment(seq uint64, publish func(topic string, msg Message) error) (int, error) {
+	path := s.segmentPath(seq)
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	offset := s.readPosition(seq)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+
+	drained, unsaved := 0, 0
+	for {
+		payload, size, err := readRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A torn or corrupt record can only be followed by garbage, skip the rest
+			spoolCorruptTotal.Inc()
+			s.logger.Error("Kafka spool segment is corrupt, skipping the rest", "segment", path, "offset", offset, "error", err)
+			break
+		}
+
+		var m spooledMessage
+		if err := json.Unmarshal(payload, &m); err != nil {
+			spoolCorruptTotal.Inc()
+			s.logger.Error("Kafka spool segment has an undecodable record", "segment", path, "offset", offset, "error", err)
+		} else if err := publish(m.Topic, Message{Key: m.Key, Value: m.Value, Headers: m.Headers}); err != nil {
+			if perr := s.writePosition(seq, offset); perr != nil {
+				s.logger.Error("Failed to save Kafka spool position", "error", perr)
+			}
+			return drained, err
+		} else {
+			drained++
+			spoolDrainedTotal.Inc()
+		}
+		offset += size
+
+		if unsaved++; unsaved == positionInterval {
+			if err := s.writePosition(seq, offset); err != nil {
+				s.logger.Error("Failed to save Kafka spool position", "error", err)
+			}
+			unsaved = 0
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return drained, err
+	}
+	os.Remove(filepath.Join(s.dir, positionFile))
+
+	s.mu.Lock()
+	s.totalBytes -= info.Size()
+	spoolBytes.Set(float64(s.totalBytes))
+	s.mu.Unlock()
+	return drained, nil
+}
+
+// Close closes the active segment
+func (s *DiskSpool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active.Close()
+}
+
+// rotate closes the active segment and starts a new one; s.mu must be held
+func (s *DiskSpool) rotate() error {
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			return err
+		}
+	}
+	s.activeSeq++
+	f, err := os.OpenFile(s.segmentPath(s.activeSeq), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	s.active = f
+	s.activeSize = 0
+	return nil
+}
+
+func (s *DiskSpool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+// segments returns the sequence numbers of all segment files, oldest first
+func (s *DiskSpool) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// readPosition returns where draining of segment seq stopped last time
+func (s *DiskSpool) readPosition(seq uint64) int64 {
+	data, err := os.ReadFile(filepath.Join(s.dir, positionFile))
+	if err != nil {
+		return 0
+	}
+	var posSeq uint64
+	var offset int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &posSeq, &offset); err != nil || posSeq != seq {
+		return 0
+	}
+	return offset
+}
+
+func (s *DiskSpool) writePosition(seq uint64, offset int64) error {
+	path := filepath.Join(s.dir, positionFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", seq, offset)), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readRecord reads one record of at most remaining bytes and returns its
+// payload and size on disk. A corrupt length cannot make it allocate more than
+// the rest of the segment.
+func readRecord(r *bufio.Reader, remaining int64) ([]byte, int64, error) {
+	var header [recordHeaderBytes]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("torn record header: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if int64(recordHeaderBytes)+int64(length) > remaining {
+		return nil, 0, fmt.Errorf("torn record: %d bytes, %d left in the segment", length, remaining-recordHeaderBytes)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, fmt.Errorf("torn record: %w", err)
+	}
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+	return payload, int64(recordHeaderBytes) + int64(length), nil
+}
+
+// RunSpoolDrainer drains spool through publish on start-up, replaying anything
+// left by a previous run, and then on every tick while ready reports true,
+// until ctx is cancelled
+func RunSpoolDrainer(ctx context.Context, spool *DiskSpool, interval time.Duration, ready func() bool, publish func(topic string, msg Message) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if spool.Pending() && ready() {
+			drained, err := spool.Drain(publish)
+			if drained > 0 {
+				spool.logger.InfoContext(ctx, "Drained messages from the Kafka spool", "messages", drained)
+			}
+			if err != nil {
+				spool.logger.WarnContext(ctx, "Kafka spool drain stopped", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/logging"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openTestSpool(t *testing.T, dir string, maxSegmentBytes, maxTotalBytes int64) *DiskSpool {
+	t.Helper()
+	spool, err := NewDiskSpool(dir, maxSegmentBytes, maxTotalBytes, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { spool.Close() })
+	return spool
+}
+
+func appendKeys(t *testing.T, spool *DiskSpool, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := spool.Append("clicks", Message{Key: key, Value: []byte("click on " + key), Headers: map[string]string{HeaderEventType: "click"}}); err != nil {
+			t.Fatalf("Append(%s) error = %v", key, err)
+		}
+	}
+}
+
+// drainKeys drains spool and returns the keys of the drained messages
+func drainKeys(t *testing.T, spool *DiskSpool) []string {
+	t.Helper()
+	keys := []string{}
+	if _, err := spool.Drain(func(topic string, msg Message) error {
+		keys = append(keys, msg.Key)
+		return nil
+	}); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	return keys
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestDiskSpoolDrainsInOrder(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir(), 1<<20, 0)
+	appendKeys(t, spool, "ad-1", "ad-2", "ad-3")
+	if !spool.Pending() {
+		t.Fatal("Pending() = false after Append")
+	}
+
+	var got []Message
+	if _, err := spool.Drain(func(topic string, msg Message) error {
+		if topic != "clicks" {
+			t.Errorf("topic = %s, want clicks", topic)
+		}
+		got = append(got, msg)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Key != "ad-1" || got[2].Key != "ad-3" || string(got[1].Value) != "click on ad-2" || got[1].Headers[HeaderEventType] != "click" {
+		t.Errorf("drained %+v", got)
+	}
+	if spool.Pending() {
+		t.Error("Pending() = true after a full drain")
+	}
+}
+
+func TestDiskSpoolRotatesSegments(t *testing.T) {
+	dir := t.TempDir()
+	// Each record is a little over 100 bytes, so every segment holds two
+	spool := openTestSpool(t, dir, 250, 0)
+	appendKeys(t, spool, "ad-1", "ad-2", "ad-3", "ad-4", "ad-5")
+	if n := len(segmentFiles(t, dir)); n != 3 {
+		t.Fatalf("%d segments, want 3", n)
+	}
+
+	// A failed publish keeps its segment and those after it
+	published := 0
+	if _, err := spool.Drain(func(topic string, msg Message) error {
+		if msg.Key == "ad-4" {
+			return errors.New("kafka unavailable")
+		}
+		published++
+		return nil
+	}); err == nil || published != 3 {
+		t.Fatalf("Drain() published %d, error %v; want 3 and an error", published, err)
+	}
+	if n := len(segmentFiles(t, dir)); n != 3 { // The second, the third and the new active one
+		t.Errorf("%d segments after a partial drain, want 3", n)
+	}
+	if got, want := drainKeys(t, spool), []string{"ad-4", "ad-5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed drain = %v, want %v", got, want)
+	}
+	if n := len(segmentFiles(t, dir)); n != 1 {
+		t.Errorf("%d segments after a full drain, want only the active one", n)
+	}
+}
+
+func TestDiskSpoolMaxTotalBytes(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir(), 1<<20, 250)
+	appendKeys(t, spool, "ad-1", "ad-2")
+	if err := spool.Append("clicks", Message{Key: "ad-3", Value: []byte("click on ad-3")}); !errors.Is(err, ErrSpoolFull) {
+		t.Fatalf("Append() over the limit error = %v, want %v", err, ErrSpoolFull)
+	}
+
+	// Draining frees the space again
+	if got := drainKeys(t, spool); len(got) != 2 {
+		t.Fatalf("drained %v, want the two messages that fit", got)
+	}
+	appendKeys(t, spool, "ad-3")
+}
+
+func TestDiskSpoolReplaysAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewDiskSpool(dir, 1<<20, 0, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendKeys(t, spool, "ad-1", "ad-2", "ad-3")
+
+	// Publish ad-1, then fail on ad-2 and crash without closing
+	if _, err := spool.Drain(func(topic string, msg Message) error {
+		if msg.Key == "ad-2" {
+			return errors.New("kafka unavailable")
+		}
+		return nil
+	}); err == nil {
+		t.Fatal("Drain() error = nil, want the publish error")
+	}
+
+	restarted := openTestSpool(t, dir, 1<<20, 0)
+	if !restarted.Pending() {
+		t.Fatal("Pending() = false after a restart with undrained messages")
+	}
+	if got, want := drainKeys(t, restarted), []string{"ad-2", "ad-3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed %v, want %v: from where the last drain stopped", got, want)
+	}
+	// New messages go to a new segment and are drained after the replayed ones
+	appendKeys(t, restarted, "ad-4")
+	if got, want := drainKeys(t, restarted), []string{"ad-4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+}
+
+func TestDiskSpoolSavesPositionWhileDraining(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewDiskSpool(dir, 1<<20, 0, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for i := 0; i < 250; i++ {
+		keys = append(keys, fmt.Sprintf("ad-%03d", i))
+	}
+	appendKeys(t, spool, keys...)
+
+	// Crash while publishing ad-150, with no publish error to save the position on
+	func() {
+		defer func() { recover() }()
+		spool.Drain(func(topic string, msg Message) error {
+			if msg.Key == "ad-150" {
+				panic("killed")
+			}
+			return nil
+		})
+	}()
+
+	// Only what was published since the last saved position goes out again
+	restarted := openTestSpool(t, dir, 1<<20, 0)
+	if got, want := drainKeys(t, restarted), keys[positionInterval:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed %d messages from %v, want %d from %s", len(got), got[:1], len(want), want[0])
+	}
+}
+
+func TestDiskSpoolRemovesEmptySegments(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewDiskSpool(dir, 1<<20, 0, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendKeys(t, spool, "ad-1")
+	spool.Close()
+
+	// Restarts without spooling anything leave only the active segment behind
+	for i := 0; i < 3; i++ {
+		spool, err := NewDiskSpool(dir, 1<<20, 0, logging.Discard())
+		if err != nil {
+			t.Fatal(err)
+		}
+		spool.Close()
+	}
+	restarted := openTestSpool(t, dir, 1<<20, 0)
+	if n := len(segmentFiles(t, dir)); n != 2 {
+		t.Errorf("%d segments, want the one holding ad-1 and the active one", n)
+	}
+	if got, want := drainKeys(t, restarted), []string{"ad-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("drained %v, want %v", got, want)
+	}
+	if n := len(segmentFiles(t, dir)); n != 1 {
+		t.Errorf("%d segments after a full drain, want only the active one", n)
+	}
+}
+
+func TestDiskSpoolSkipsCorruptRecords(t *testing.T) {
+	corrupt := map[string]func(data []byte) []byte{
+		"checksum mismatch": func(data []byte) []byte {
+			data[len(data)-2] ^= 0xff // In the payload of the last record
+			return data
+		},
+		"torn record": func(data []byte) []byte {
+			return data[:len(data)-5]
+		},
+		"corrupt length": func(data []byte) []byte {
+			last := len(data) - recordSize(t, data, 2)
+			binary.BigEndian.PutUint32(data[last:], 1<<31)
+			return data
+		},
+	}
+	for name, corrupt := range corrupt {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			spool, err := NewDiskSpool(dir, 1<<20, 0, logging.Discard())
+			if err != nil {
+				t.Fatal(err)
+			}
+			appendKeys(t, spool, "ad-1", "ad-2", "ad-3")
+			spool.Close()
+
+			path := segmentFiles(t, dir)[0]
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, corrupt(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			// The records before the corrupt one are still delivered
+			restarted := openTestSpool(t, dir, 1<<20, 0)
+			if got, want := drainKeys(t, restarted), []string{"ad-1", "ad-2"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("drained %v, want %v", got, want)
+			}
+			if restarted.Pending() {
+				t.Error("Pending() = true after the corrupt segment was skipped")
+			}
+		})
+	}
+}
+
+// recordSize returns the size on disk of record i of a segment
+func recordSize(t *testing.T, data []byte, i int) int {
+	t.Helper()
+	offset := 0
+	for ; i > 0; i-- {
+		offset += recordHeaderBytes + int(binary.BigEndian.Uint32(data[offset:]))
+	}
+	return recordHeaderBytes + int(binary.BigEndian.Uint32(data[offset:]))
+}
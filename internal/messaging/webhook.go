@@ -0,0 +1,80 @@
+package messaging
+
+import (
+	"ad-tracking-system/internal/utils/circuitbreaker"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/sony/gobreaker"
+)
+
+// Request headers set by WebhookPublisher; message headers are sent as
+// WebhookHeaderPrefix followed by the header name
+const (
+	WebhookHeaderTopic  = "X-Message-Topic"
+	WebhookHeaderKey    = "X-Message-Key"
+	WebhookHeaderPrefix = "X-Message-Header-"
+)
+
+// WebhookPublisher publishes messages by POSTing them to an HTTP endpoint.
+// It has no subscriber side: the receiving service is the consumer.
+type WebhookPublisher struct {
+	url    string
+	client *http.Client
+	cb     *gobreaker.CircuitBreaker
+}
+
+// NewWebhookPublisher creates a publisher posting to url
+func NewWebhookPublisher(url string, timeout time.Duration, logger *slog.Logger) *WebhookPublisher {
+	return &WebhookPublisher{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+		cb:     circuitbreaker.NewCircuitBreaker("webhook-producer", logger),
+	}
+}
+
+// Publish posts the message value as the request body. Any response other than
+// 2xx is an error.
+func (p *WebhookPublisher) Publish(ctx context.Context, topic string, msg Message) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(msg.Value))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(WebhookHeaderTopic, topic)
+	if msg.Key != "" {
+		req.Header.Set(WebhookHeaderKey, msg.Key)
+	}
+	for k, v := range msg.Headers {
+		req.Header.Set(WebhookHeaderPrefix+k, v)
+	}
+	if _, ok := msg.Headers[HeaderProducerHost]; !ok {
+		req.Header.Set(WebhookHeaderPrefix+HeaderProducerHost, hostname)
+	}
+
+	_, err = circuitbreaker.Execute(ctx, p.cb, func(ctx context.Context) (interface{}, error) {
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, resp.Body)
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return nil, fmt.Errorf("webhook %s returned %s", p.url, resp.Status)
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// Close releases idle connections
+func (p *WebhookPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
@@ -2,24 +2,26 @@ package repository
 
 import (
 	"ad-tracking-system/internal/domain/models"
+	"context"
 	"database/sql"
-	"log"
+	"log/slog"
 )
 
 // AdRepository manages database operations for ads
 type AdRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	logger *slog.Logger
 }
 
 // NewAdRepository creates a new AdRepository
-func NewAdRepository(db *sql.DB) *AdRepository {
-	return &AdRepository{db: db}
+func NewAdRepository(db *sql.DB, logger *slog.Logger) *AdRepository {
+	return &AdRepository{db: db, logger: logger}
 }
 
-// FetchAll fetches all ads from the database
-func (r *AdRepository) FetchAll() ([]models.Ad, error) {
-	query := `SELECT id, image_url, target_url FROM ads`
-	rows, err := r.db.Query(query)
+// FetchAll fetches all ads of a tenant from the database
+func (r *AdRepository) FetchAll(ctx context.Context, tenantID string) ([]models.Ad, error) {
+	query := `SELECT id, image_url, target_url FROM ads WHERE tenant_id = $1`
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -36,20 +38,20 @@ func (r *AdRepository) FetchAll() ([]models.Ad, error) {
 	return ads, nil
 }
 
-// CountAds returns the number of ads in the database
-func (r *AdRepository) CountAds() (int, error) {
+// CountAds returns the number of ads of a tenant in the database
+func (r *AdRepository) CountAds(ctx context.Context, tenantID string) (int, error) {
 	var count int
-	query := `SELECT COUNT(*) FROM ads`
-	err := r.db.QueryRow(query).Scan(&count)
+	query := `SELECT COUNT(*) FROM ads WHERE tenant_id = $1`
+	err := r.db.QueryRowContext(ctx, query, tenantID).Scan(&count)
 	if err != nil {
-		log.Printf("Failed to count ads: %v", err)
+		r.logger.ErrorContext(ctx, "Failed to count ads", "error", err)
 		return 0, err
 	}
 	return count, nil
 }
 
-// Seed inserts 10 dummy ads into the ads table
-func (r *AdRepository) Seed() error {
+// Seed inserts 10 dummy ads for a tenant into the ads table
+func (r *AdRepository) Seed(ctx context.Context, tenantID string) error {
 	// Define 10 dummy ads
 	dummyAds := []models.Ad{
 		{
@@ -106,14 +108,14 @@ func (r *AdRepository) Seed() error {
 
 	// Insert dummy ads into the database
 	for _, ad := range dummyAds {
-		query := `INSERT INTO ads (id, image_url, target_url) VALUES ($1, $2, $3)`
-		_, err := r.db.Exec(query, ad.ID, ad.ImageURL, ad.TargetURL)
+		query := `INSERT INTO ads (tenant_id, id, image_url, target_url) VALUES ($1, $2, $3, $4)`
+		_, err := r.db.ExecContext(ctx, query, tenantID, ad.ID, ad.ImageURL, ad.TargetURL)
 		if err != nil {
-			log.Printf("Failed to insert ad %s: %v", ad.ID, err)
+			r.logger.ErrorContext(ctx, "Failed to insert ad", "tenant_id", tenantID, "ad_id", ad.ID, "error", err)
 			return err
 		}
 	}
 
-	log.Println("Successfully seeded 10 dummy ads")
+	r.logger.InfoContext(ctx, "Seeded dummy ads", "tenant_id", tenantID, "ads", len(dummyAds))
 	return nil
 }
\ No newline at end of file
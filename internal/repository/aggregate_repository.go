@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"context"
+	"database/sql"
+	"log/slog"
+)
+
+// AggregateRepository stores the windowed click counts produced by the click aggregator
+type AggregateRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewAggregateRepository creates a new AggregateRepository
+func NewAggregateRepository(db *sql.DB, logger *slog.Logger) *AggregateRepository {
+	return &AggregateRepository{db: db, logger: logger}
+}
+
+// Apply adds the counts of a batch to the window counts unless the batch was
+// already applied. Returns whether the batch was applied.
+func (r *AggregateRepository) Apply(ctx context.Context, batch models.ClickAggregateBatch) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Advance the source offset; nothing is updated if these aggregates are a redelivery
+	advance := `
+		INSERT INTO click_aggregate_offsets (source_topic, source_partition, last_offset)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (source_topic, source_partition) DO UPDATE SET last_offset = EXCLUDED.last_offset
+		WHERE click_aggregate_offsets.last_offset < EXCLUDED.last_offset`
+	result, err := tx.ExecContext(ctx, advance, batch.SourceTopic, batch.SourcePartition, batch.LastOffset)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to advance aggregate offset", "error", err)
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	upsert := `
+		INSERT INTO click_window_counts (tenant_id, ad_id, window_start, window_end, clicks)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, ad_id, window_start) DO UPDATE SET clicks = click_window_counts.clicks + EXCLUDED.clicks`
+	for _, count := range batch.Counts {
+		if _, err := tx.ExecContext(ctx, upsert, count.TenantID, count.AdID, count.WindowStart, count.WindowEnd, count.Clicks); err != nil {
+			r.logger.ErrorContext(ctx, "Failed to apply click aggregate", "error", err)
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
@@ -1,44 +1,169 @@
 package repository
 
 import (
+	"ad-tracking-system/internal/domain/models"
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
-// AnalyticsRepository manages analytics data in Redis
+// clickCountTTL bounds how long a cached click count can drift from Postgres
+const clickCountTTL = 10 * time.Minute
+
+// incrementIfCached only increments counters that are already cached, so a
+// missing key is never restarted from zero
+var incrementIfCached = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("INCR", KEYS[1])
+end
+return false
+`)
+
+// windowCountTTL is how long windowed click counts from the aggregator are kept in Redis
+const windowCountTTL = 7 * 24 * time.Hour
+
+// applyAggregateBatch applies a batch of window counts unless a batch with the
+// same or a later source offset was already applied for that source partition.
+// KEYS[1] is the offsets hash; ARGV is the partition field, the last offset, the
+// TTL in seconds, then pairs of window count key and clicks.
+var applyAggregateBatch = redis.NewScript(`
+local applied = tonumber(redis.call("HGET", KEYS[1], ARGV[1]) or "-1")
+if tonumber(ARGV[2]) <= applied then
+	return 0
+end
+for i = 4, #ARGV, 2 do
+	redis.call("INCRBY", ARGV[i], ARGV[i + 1])
+	redis.call("EXPIRE", ARGV[i], ARGV[3])
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// clickCountKey is the key of an ad's cached click count. Every key of a tenant
+// starts with tenantKeyPrefix, so tenants never share a key.
+func clickCountKey(tenantID, adID string) string {
+	return tenantKeyPrefix(tenantID) + "clicks:" + adID
+}
+
+func tenantKeyPrefix(tenantID string) string {
+	return "tenant:" + tenantID + ":"
+}
+
+// AnalyticsRepository manages the hot cache of click counts in Redis.
+// The rollups in Postgres are the source of truth.
 type AnalyticsRepository struct {
 	redisClient *redis.Client
+	logger      *slog.Logger
 }
 
 // NewAnalyticsRepository creates a new AnalyticsRepository
-func NewAnalyticsRepository(redisClient *redis.Client) *AnalyticsRepository {
-	return &AnalyticsRepository{redisClient: redisClient}
+func NewAnalyticsRepository(redisClient *redis.Client, logger *slog.Logger) *AnalyticsRepository {
+	return &AnalyticsRepository{redisClient: redisClient, logger: logger}
 }
 
-// IncrementClickCount increments the click count for a specific ad
-func (r *AnalyticsRepository) IncrementClickCount(adID string) error {
-	ctx := context.Background()
-	key := "clicks:" + adID
-	if err := r.redisClient.Incr(ctx, key).Err(); err != nil {
-		log.Printf("Failed to increment click count: %v", err)
+// IncrementClickCount increments the cached click count for a specific ad, if it is cached
+func (r *AnalyticsRepository) IncrementClickCount(ctx context.Context, tenantID, adID string) error {
+	key := clickCountKey(tenantID, adID)
+	if err := incrementIfCached.Run(ctx, r.redisClient, []string{key}).Err(); err != nil && err != redis.Nil {
+		r.logger.ErrorContext(ctx, "Failed to increment click count", "error", err)
 		return err
 	}
 	return nil
 }
 
-// GetClickCount returns the total click count for a specific ad
-func (r *AnalyticsRepository) GetClickCount(adID string) (int64, error) {
-	ctx := context.Background()
-	key := "clicks:" + adID
+// GetClickCount returns the cached click count for a specific ad and whether it was cached
+func (r *AnalyticsRepository) GetClickCount(ctx context.Context, tenantID, adID string) (int64, bool, error) {
+	key := clickCountKey(tenantID, adID)
 	count, err := r.redisClient.Get(ctx, key).Int64()
 	if err != nil {
 		if err == redis.Nil {
-			return 0, nil // No clicks recorded yet
+			return 0, false, nil // Not cached
+		}
+		r.logger.ErrorContext(ctx, "Failed to get click count", "error", err)
+		return 0, false, err
+	}
+	return count, true, nil
+}
+
+// CacheClickCount caches the click count for a specific ad unless it is already cached
+func (r *AnalyticsRepository) CacheClickCount(ctx context.Context, tenantID, adID string, count int64) error {
+	key := clickCountKey(tenantID, adID)
+	if err := r.redisClient.SetNX(ctx, key, count, clickCountTTL).Err(); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to cache click count", "error", err)
+		return err
+	}
+	return nil
+}
+
+// GetClickCounts returns the cached click counts of the given ads; ads that are
+// not cached are left out of the result
+func (r *AnalyticsRepository) GetClickCounts(ctx context.Context, tenantID string, adIDs []string) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	if len(adIDs) == 0 {
+		return counts, nil
+	}
+
+	keys := make([]string, len(adIDs))
+	for i, adID := range adIDs {
+		keys[i] = clickCountKey(tenantID, adID)
+	}
+	values, err := r.redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to get click counts", "error", err)
+		return nil, err
+	}
+
+	for i, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			continue // Not cached
+		}
+		count, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cached click count for ad %s: %w", adIDs[i], err)
 		}
-		log.Printf("Failed to get click count: %v", err)
-		return 0, err
+		counts[adIDs[i]] = count
+	}
+	return counts, nil
+}
+
+// SetClickCounts overwrites the cached click counts of the given ads in a single MULTI/EXEC transaction
+func (r *AnalyticsRepository) SetClickCounts(ctx context.Context, tenantID string, counts map[string]int64) error {
+	_, err := r.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for adID, count := range counts {
+			pipe.Set(ctx, clickCountKey(tenantID, adID), count, clickCountTTL)
+		}
+		return nil
+	})
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to set click counts", "error", err)
+		return err
+	}
+	return nil
+}
+
+// ApplyAggregateBatch adds the window counts of a batch from the click aggregator
+// to tenant:<tenantID>:clicks:window:<adID>:<unix window start> unless the batch
+// was already applied
+func (r *AnalyticsRepository) ApplyAggregateBatch(ctx context.Context, batch models.ClickAggregateBatch) (bool, error) {
+	args := []interface{}{
+		fmt.Sprintf("%s/%d", batch.SourceTopic, batch.SourcePartition),
+		batch.LastOffset,
+		int64(windowCountTTL.Seconds()),
+	}
+	for _, count := range batch.Counts {
+		key := fmt.Sprintf("%sclicks:window:%s:%d", tenantKeyPrefix(count.TenantID), count.AdID, count.WindowStart.Unix())
+		args = append(args, key, count.Clicks)
+	}
+
+	applied, err := applyAggregateBatch.Run(ctx, r.redisClient, []string{"clicks:aggregate-offsets"}, args...).Int()
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to apply click aggregate batch", "error", err)
+		return false, err
 	}
-	return count, nil
+	return applied == 1, nil
 }
@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrAPIKeyNotFound is returned for API keys that do not exist
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+const apiKeyColumns = `id, tenant_id, name, prefix, scopes, created_at, last_used_at, expires_at, revoked_at, rotated_from`
+
+// APIKeyRepository stores API keys in the api_keys table
+type APIKeyRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewAPIKeyRepository creates a new APIKeyRepository
+func NewAPIKeyRepository(db *sql.DB, logger *slog.Logger) *APIKeyRepository {
+	return &APIKeyRepository{db: db, logger: logger}
+}
+
+// Create stores a new key with the given hash and fills in its ID and creation time
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey, hash string) error {
+	query := `INSERT INTO api_keys (tenant_id, name, prefix, key_hash, scopes) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, key.TenantID, key.Name, key.Prefix, hash, pq.Array(key.Scopes)).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to create API key", "name", key.Name, "error", err)
+		return err
+	}
+	return nil
+}
+
+// GetByHash returns the key with the given hash, including revoked and expired
+// keys. It is not scoped to a tenant: the key is what identifies the tenant.
+func (r *APIKeyRepository) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	return scanAPIKey(conn(ctx, r.db).QueryRowContext(ctx, query, hash))
+}
+
+// Get returns a key of a tenant, including revoked and expired keys
+func (r *APIKeyRepository) Get(ctx context.Context, tenantID string, id int64) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE tenant_id = $1 AND id = $2`
+	return scanAPIKey(conn(ctx, r.db).QueryRowContext(ctx, query, tenantID, id))
+}
+
+// GetForUpdate returns a key of a tenant like Get and, in a transaction, locks
+// it until the transaction ends so that it cannot change in the meantime
+func (r *APIKeyRepository) GetForUpdate(ctx context.Context, tenantID string, id int64) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE tenant_id = $1 AND id = $2 FOR UPDATE`
+	return scanAPIKey(conn(ctx, r.db).QueryRowContext(ctx, query, tenantID, id))
+}
+
+// List returns all keys of a tenant, newest first
+func (r *APIKeyRepository) List(ctx context.Context, tenantID string) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE tenant_id = $1 ORDER BY id DESC`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// Rotate replaces the tenant's active key id with a new key with the same name
+// and scopes. Revoked and expired keys cannot be rotated. The old key keeps working for grace, or until its own expiry if
+// that is sooner.
+func (r *APIKeyRepository) Rotate(ctx context.Context, tenantID string, id int64, key *models.APIKey, hash string, grace time.Duration) error {
+	err := inTx(ctx, r.db, func(ctx context.Context, tx querier) error {
+		query := `SELECT name, scopes FROM api_keys
+			WHERE tenant_id = $1 AND id = $2 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW()) FOR UPDATE`
+		err := tx.QueryRowContext(ctx, query, tenantID, id).Scan(&key.Name, pq.Array(&key.Scopes))
+		if err == sql.ErrNoRows {
+			return ErrAPIKeyNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		query = `INSERT INTO api_keys (tenant_id, name, prefix, key_hash, scopes, rotated_from) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+		if err := tx.QueryRowContext(ctx, query, tenantID, key.Name, key.Prefix, hash, pq.Array(key.Scopes), id).Scan(&key.ID, &key.CreatedAt); err != nil {
+			return err
+		}
+		key.TenantID = tenantID
+		key.RotatedFrom = &id
+
+		query = `UPDATE api_keys SET expires_at = LEAST(expires_at, NOW() + make_interval(secs => $2)) WHERE id = $1`
+		_, err = tx.ExecContext(ctx, query, id, grace.Seconds())
+		return err
+	})
+	if err != nil && err != ErrAPIKeyNotFound {
+		r.logger.ErrorContext(ctx, "Failed to rotate API key", "api_key_id", id, "error", err)
+	}
+	return err
+}
+
+// Revoke revokes a tenant's key immediately. Revoking a revoked key keeps the original revocation time.
+func (r *APIKeyRepository) Revoke(ctx context.Context, tenantID string, id int64) error {
+	query := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()) WHERE tenant_id = $1 AND id = $2`
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, tenantID, id)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to revoke API key", "api_key_id", id, "error", err)
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// TouchLastUsed records that a key was used just now
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id int64) error {
+	query := `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	return err
+}
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	var lastUsedAt, expiresAt, revokedAt sql.NullTime
+	var rotatedFrom sql.NullInt64
+	err := row.Scan(&key.ID, &key.TenantID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &lastUsedAt, &expiresAt, &revokedAt, &rotatedFrom)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	if rotatedFrom.Valid {
+		key.RotatedFrom = &rotatedFrom.Int64
+	}
+	return &key, nil
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// AuditFilter selects audit events of a tenant. Empty fields match everything.
+type AuditFilter struct {
+	TenantID   string
+	EntityType string
+	EntityID   string
+	Actor      string
+	From       time.Time // Inclusive
+	To         time.Time // Exclusive
+	Limit      int
+}
+
+// AuditRepository appends to and queries the audit_events table
+type AuditRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewAuditRepository creates a new AuditRepository
+func NewAuditRepository(db *sql.DB, logger *slog.Logger) *AuditRepository {
+	return &AuditRepository{db: db, logger: logger}
+}
+
+// Append stores an event and fills in its ID and time. In a transaction of
+// Transactor, the event is stored if and only if the transaction commits.
+func (r *AuditRepository) Append(ctx context.Context, event *models.AuditEvent) error {
+	query := `INSERT INTO audit_events (tenant_id, actor, action, entity_type, entity_id, before, after, request_id, source_ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, occurred_at`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, event.TenantID, event.Actor, event.Action, event.EntityType, event.EntityID,
+		nullJSON(event.Before), nullJSON(event.After), event.RequestID, event.SourceIP).Scan(&event.ID, &event.OccurredAt)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to append audit event", "action", event.Action, "entity_type", event.EntityType, "entity_id", event.EntityID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// List returns the events matching filter, newest first
+func (r *AuditRepository) List(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error) {
+	conditions := []string{"tenant_id = $1"}
+	args := []interface{}{filter.TenantID}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.EntityType != "" {
+		add("entity_type = $%d", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		add("entity_id = $%d", filter.EntityID)
+	}
+	if filter.Actor != "" {
+		add("actor = $%d", filter.Actor)
+	}
+	if !filter.From.IsZero() {
+		add("occurred_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("occurred_at < $%d", filter.To)
+	}
+	args = append(args, filter.Limit)
+
+	query := fmt.Sprintf(`SELECT id, tenant_id, occurred_at, actor, action, entity_type, entity_id, before, after, request_id, source_ip
+		FROM audit_events WHERE %s ORDER BY occurred_at DESC, id DESC LIMIT $%d`, strings.Join(conditions, " AND "), len(args))
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var before, after []byte
+		if err := rows.Scan(&event.ID, &event.TenantID, &event.OccurredAt, &event.Actor, &event.Action, &event.EntityType,
+			&event.EntityID, &before, &after, &event.RequestID, &event.SourceIP); err != nil {
+			return nil, err
+		}
+		event.Before, event.After = before, after
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// nullJSON stores empty JSON as NULL
+func nullJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
@@ -2,54 +2,166 @@ package repository
 
 import (
 	"ad-tracking-system/internal/domain/models"
+	"context"
 	"database/sql"
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+// ErrRangeChanged is returned by DeleteRange when the range does not hold the
+// number of clicks the caller expected, such as clicks written after it was archived
+var ErrRangeChanged = errors.New("click range changed")
+
 // ClickRepository manages database operations for click events
 type ClickRepository struct {
-	db *sql.DB
+	db     *sql.DB
+	logger *slog.Logger
 }
 
 // NewClickRepository creates a new ClickRepository
-func NewClickRepository(db *sql.DB) *ClickRepository {
-	return &ClickRepository{db: db}
+func NewClickRepository(db *sql.DB, logger *slog.Logger) *ClickRepository {
+	return &ClickRepository{db: db, logger: logger}
 }
 
-// Save saves a click event to the database
-func (r *ClickRepository) Save(click models.ClickEvent) error {
-	query := `INSERT INTO clicks (ad_id, timestamp, ip, playback_time) VALUES ($1, $2, $3, $4)`
-	_, err := r.db.Exec(query, click.AdID, click.Timestamp, click.IP, click.PlaybackTime)
+// Save saves a click event to the database and adds it to the outbox in the
+// same transaction, so it is published to Kafka if and only if it is stored
+func (r *ClickRepository) Save(ctx context.Context, click models.ClickEvent) error {
+	payload, err := json.Marshal(click)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Failed to save click event: %v", err)
+		r.logger.ErrorContext(ctx, "Failed to save click event", "error", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO clicks (tenant_id, ad_id, timestamp, ip, playback_time) VALUES ($1, $2, $3, $4, $5)`
+	if _, err := tx.ExecContext(ctx, query, click.TenantID, click.AdID, click.Timestamp, click.IP, click.PlaybackTime); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to save click event", "error", err)
+		return err
+	}
+	if err := insertOutboxMessage(ctx, tx, OutboxEventClick, click.Key(), payload); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to add click event to outbox", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveConsumed saves a click event received from Kafka. It is not added to the
+// outbox because it has already been published.
+func (r *ClickRepository) SaveConsumed(ctx context.Context, click models.ClickEvent) error {
+	query := `INSERT INTO clicks (tenant_id, ad_id, timestamp, ip, playback_time) VALUES ($1, $2, $3, $4, $5)`
+	_, err := r.db.ExecContext(ctx, query, click.TenantID, click.AdID, click.Timestamp, click.IP, click.PlaybackTime)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to save click event", "error", err)
 		return err
 	}
 	return nil
 }
 
-// AdExists checks if an ad with the given ID exists
-func (r *ClickRepository) AdExists(adID string) (bool, error) {
+// AdExists checks if the tenant has an ad with the given ID
+func (r *ClickRepository) AdExists(ctx context.Context, tenantID, adID string) (bool, error) {
 	var exists bool
-	query := "SELECT EXISTS(SELECT 1 FROM ads WHERE id = $1)"
-	err := r.db.QueryRow(query, adID).Scan(&exists)
+	query := "SELECT EXISTS(SELECT 1 FROM ads WHERE tenant_id = $1 AND id = $2)"
+	err := r.db.QueryRowContext(ctx, query, tenantID, adID).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
 
-// GetClickCountByIP returns the number of clicks from a specific IP in the last hour
-func (r *ClickRepository) GetClickCountByIP(ip string) (int, error) {
+// GetClickCountByIP returns the number of clicks on a tenant's ads from a specific IP in the last hour
+func (r *ClickRepository) GetClickCountByIP(ctx context.Context, tenantID, ip string) (int, error) {
 	var count int
-	query := "SELECT COUNT(*) FROM clicks WHERE ip = $1 AND timestamp > NOW() - INTERVAL '1 hour'"
-	err := r.db.QueryRow(query, ip).Scan(&count)
+	query := "SELECT COUNT(*) FROM clicks WHERE tenant_id = $1 AND ip = $2 AND timestamp > NOW() - INTERVAL '1 hour'"
+	err := r.db.QueryRowContext(ctx, query, tenantID, ip).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
+// StreamRange calls fn for every click of every tenant with a timestamp in
+// [from, to), ordered by id. If partition is set, only the clicks stored in
+// that partition of clicks are read. Like CountRange and DeleteRange it is
+// meant for maintenance that works on whole time ranges, such as archival.
+func (r *ClickRepository) StreamRange(ctx context.Context, partition string, from, to time.Time, fn func(id int64, click models.ClickEvent) error) error {
+	query := fmt.Sprintf(`SELECT id, tenant_id, ad_id, timestamp, ip, playback_time FROM %s WHERE timestamp >= $1 AND timestamp < $2 ORDER BY id`, clicksTable(partition))
+	rows, err := r.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var click models.ClickEvent
+		if err := rows.Scan(&id, &click.TenantID, &click.AdID, &click.Timestamp, &click.IP, &click.PlaybackTime); err != nil {
+			return err
+		}
+		if err := fn(id, click); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountRange returns the number of clicks of every tenant with a timestamp in
+// [from, to), of only partition if it is set
+func (r *ClickRepository) CountRange(ctx context.Context, partition string, from, to time.Time) (int64, error) {
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE timestamp >= $1 AND timestamp < $2", clicksTable(partition))
+	if err := r.db.QueryRowContext(ctx, query, from, to).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// DeleteRange deletes the clicks of every tenant with a timestamp in [from, to)
+// in one transaction, provided there are exactly want of them. Otherwise
+// nothing is deleted and the error wraps ErrRangeChanged.
+func (r *ClickRepository) DeleteRange(ctx context.Context, from, to time.Time, want int64) (int64, error) {
+	var deleted int64
+	err := inTx(ctx, r.db, func(ctx context.Context, q querier) error {
+		query := "DELETE FROM clicks WHERE timestamp >= $1 AND timestamp < $2"
+		result, err := q.ExecContext(ctx, query, from, to)
+		if err != nil {
+			r.logger.ErrorContext(ctx, "Failed to delete clicks", "error", err)
+			return err
+		}
+		if deleted, err = result.RowsAffected(); err != nil {
+			return err
+		}
+		if deleted != want {
+			return fmt.Errorf("%w: range holds %d clicks, %d expected", ErrRangeChanged, deleted, want)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// clicksTable returns the table to read the clicks of partition from: the
+// partition itself, or clicks if partition is empty
+func clicksTable(partition string) string {
+	if partition == "" {
+		return "clicks"
+	}
+	return pq.QuoteIdentifier(partition)
+}
+
 // IsValidIP checks if the IP address is valid
 func (r *ClickRepository) IsValidIP(ip string) bool {
 	return net.ParseIP(ip) != nil
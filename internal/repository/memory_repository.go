@@ -0,0 +1,837 @@
+package repository
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryAdRepository is an in-memory AdStore, for tests and running without Postgres
+type MemoryAdRepository struct {
+	mu  sync.Mutex
+	ads map[string][]models.Ad // By tenant ID
+}
+
+// NewMemoryAdRepository creates an empty MemoryAdRepository
+func NewMemoryAdRepository() *MemoryAdRepository {
+	return &MemoryAdRepository{ads: make(map[string][]models.Ad)}
+}
+
+// FetchAll returns all ads of a tenant
+func (r *MemoryAdRepository) FetchAll(ctx context.Context, tenantID string) ([]models.Ad, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.Ad(nil), r.ads[tenantID]...), nil
+}
+
+// CountAds returns the number of ads of a tenant
+func (r *MemoryAdRepository) CountAds(ctx context.Context, tenantID string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.ads[tenantID]), nil
+}
+
+// Seed adds the same 10 dummy ads as AdRepository.Seed for a tenant
+func (r *MemoryAdRepository) Seed(ctx context.Context, tenantID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := 1; i <= 10; i++ {
+		r.ads[tenantID] = append(r.ads[tenantID], models.Ad{
+			ID:        fmt.Sprint(i),
+			ImageURL:  fmt.Sprintf("https://example.com/images/ad%d.jpg", i),
+			TargetURL: fmt.Sprintf("https://example.com/landing/ad%d", i),
+		})
+	}
+	return nil
+}
+
+func (r *MemoryAdRepository) exists(tenantID, adID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ad := range r.ads[tenantID] {
+		if ad.ID == adID {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryClickRepository is an in-memory ClickStore, for tests and running
+// without Postgres. It also implements RollupStore, computing the rollups
+// from the stored clicks.
+type MemoryClickRepository struct {
+	ads *MemoryAdRepository
+
+	mu     sync.Mutex
+	clicks []models.ClickEvent
+	err    error
+}
+
+// NewMemoryClickRepository creates an empty MemoryClickRepository for the ads in ads
+func NewMemoryClickRepository(ads *MemoryAdRepository) *MemoryClickRepository {
+	return &MemoryClickRepository{ads: ads}
+}
+
+// SetError makes every call that can fail return err, until it is reset with nil
+func (r *MemoryClickRepository) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// fail returns the error a call should fail with, if any; r.mu must be held
+func (r *MemoryClickRepository) fail(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+// Clicks returns the stored clicks in the order they were saved
+func (r *MemoryClickRepository) Clicks() []models.ClickEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]models.ClickEvent(nil), r.clicks...)
+}
+
+// Save stores a click event
+func (r *MemoryClickRepository) Save(ctx context.Context, click models.ClickEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return err
+	}
+	r.clicks = append(r.clicks, click)
+	return nil
+}
+
+// AdExists checks if the tenant has an ad with the given ID
+func (r *MemoryClickRepository) AdExists(ctx context.Context, tenantID, adID string) (bool, error) {
+	r.mu.Lock()
+	err := r.fail(ctx)
+	r.mu.Unlock()
+	if err != nil {
+		return false, err
+	}
+	return r.ads.exists(tenantID, adID), nil
+}
+
+// GetClickCountByIP returns the number of clicks on a tenant's ads from a specific IP in the last hour
+func (r *MemoryClickRepository) GetClickCountByIP(ctx context.Context, tenantID, ip string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return 0, err
+	}
+
+	since := time.Now().Add(-time.Hour)
+	count := 0
+	for _, click := range r.clicks {
+		if click.TenantID == tenantID && click.IP == ip && click.Timestamp.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// IsValidIP checks if the IP address is valid
+func (r *MemoryClickRepository) IsValidIP(ip string) bool {
+	return net.ParseIP(ip) != nil
+}
+
+// IsPlaybackTimeValid checks if the playback time is within a valid range
+func (r *MemoryClickRepository) IsPlaybackTimeValid(playbackTime int) bool {
+	return playbackTime >= 0 && playbackTime <= 3600
+}
+
+// StreamRange calls fn for every click with a timestamp in [from, to), in the
+// order they were saved. A click's ID is its position among the stored clicks.
+// There are no partitions, so partition is ignored.
+func (r *MemoryClickRepository) StreamRange(ctx context.Context, partition string, from, to time.Time, fn func(id int64, click models.ClickEvent) error) error {
+	r.mu.Lock()
+	if err := r.fail(ctx); err != nil {
+		r.mu.Unlock()
+		return err
+	}
+	clicks := append([]models.ClickEvent(nil), r.clicks...)
+	r.mu.Unlock()
+
+	for i, click := range clicks {
+		if inRange(click.Timestamp, from, to) {
+			if err := fn(int64(i+1), click); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CountRange returns the number of clicks with a timestamp in [from, to)
+func (r *MemoryClickRepository) CountRange(ctx context.Context, partition string, from, to time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, click := range r.clicks {
+		if inRange(click.Timestamp, from, to) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DeleteRange deletes the clicks with a timestamp in [from, to), provided
+// there are exactly want of them
+func (r *MemoryClickRepository) DeleteRange(ctx context.Context, from, to time.Time, want int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return 0, err
+	}
+
+	var kept []models.ClickEvent
+	for _, click := range r.clicks {
+		if !inRange(click.Timestamp, from, to) {
+			kept = append(kept, click)
+		}
+	}
+	deleted := int64(len(r.clicks) - len(kept))
+	if deleted != want {
+		return 0, fmt.Errorf("%w: range holds %d clicks, %d expected", ErrRangeChanged, deleted, want)
+	}
+	r.clicks = kept
+	return deleted, nil
+}
+
+// inRange reports whether t is in [from, to)
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+// GetTotalClickCount returns the number of stored clicks of a tenant's ad
+func (r *MemoryClickRepository) GetTotalClickCount(ctx context.Context, tenantID, adID string) (int64, error) {
+	counts, err := r.GetTotalClickCounts(ctx, tenantID)
+	return counts[adID], err
+}
+
+// GetTotalClickCounts returns the number of stored clicks of every ad of a tenant with clicks
+func (r *MemoryClickRepository) GetTotalClickCounts(ctx context.Context, tenantID string) (map[string]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64)
+	for _, click := range r.clicks {
+		if click.TenantID == tenantID {
+			counts[click.AdID]++
+		}
+	}
+	return counts, nil
+}
+
+// GetHourlyClicks returns the click counts of a tenant's ad per hour in [from, to)
+func (r *MemoryClickRepository) GetHourlyClicks(ctx context.Context, tenantID, adID string, from, to time.Time) ([]RollupBucket, error) {
+	return r.buckets(ctx, tenantID, adID, from, to, func(t time.Time) time.Time { return t.Truncate(time.Hour) })
+}
+
+// GetDailyClicks returns the click counts of a tenant's ad per UTC day in [from, to)
+func (r *MemoryClickRepository) GetDailyClicks(ctx context.Context, tenantID, adID string, from, to time.Time) ([]RollupBucket, error) {
+	return r.buckets(ctx, tenantID, adID, from, to, func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	})
+}
+
+func (r *MemoryClickRepository) buckets(ctx context.Context, tenantID, adID string, from, to time.Time, bucket func(time.Time) time.Time) ([]RollupBucket, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[time.Time]int64)
+	for _, click := range r.clicks {
+		start := bucket(click.Timestamp.UTC())
+		if click.TenantID == tenantID && click.AdID == adID && !start.Before(from) && start.Before(to) {
+			counts[start]++
+		}
+	}
+
+	buckets := make([]RollupBucket, 0, len(counts))
+	for start, clicks := range counts {
+		buckets = append(buckets, RollupBucket{Bucket: start, Clicks: clicks})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Bucket.Before(buckets[j].Bucket) })
+	return buckets, nil
+}
+
+// MemoryAnalyticsRepository is an in-memory AnalyticsStore, for tests and
+// running without Redis. Like AnalyticsRepository it only increments counts
+// that are cached; unlike it, cached counts never expire.
+type MemoryAnalyticsRepository struct {
+	mu     sync.Mutex
+	counts map[memoryCountKey]int64
+	err    error
+}
+
+type memoryCountKey struct {
+	tenantID, adID string
+}
+
+// NewMemoryAnalyticsRepository creates an empty MemoryAnalyticsRepository
+func NewMemoryAnalyticsRepository() *MemoryAnalyticsRepository {
+	return &MemoryAnalyticsRepository{counts: make(map[memoryCountKey]int64)}
+}
+
+// SetError makes every call return err, until it is reset with nil
+func (r *MemoryAnalyticsRepository) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+}
+
+// fail returns the error a call should fail with, if any; r.mu must be held
+func (r *MemoryAnalyticsRepository) fail(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.err
+}
+
+// IncrementClickCount increments the cached click count for a specific ad, if it is cached
+func (r *MemoryAnalyticsRepository) IncrementClickCount(ctx context.Context, tenantID, adID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return err
+	}
+	key := memoryCountKey{tenantID, adID}
+	if _, ok := r.counts[key]; ok {
+		r.counts[key]++
+	}
+	return nil
+}
+
+// GetClickCount returns the cached click count for a specific ad and whether it was cached
+func (r *MemoryAnalyticsRepository) GetClickCount(ctx context.Context, tenantID, adID string) (int64, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return 0, false, err
+	}
+	count, ok := r.counts[memoryCountKey{tenantID, adID}]
+	return count, ok, nil
+}
+
+// CacheClickCount caches the click count of an ad loaded from Postgres, unless
+// a count is already cached
+func (r *MemoryAnalyticsRepository) CacheClickCount(ctx context.Context, tenantID, adID string, count int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return err
+	}
+	key := memoryCountKey{tenantID, adID}
+	if _, ok := r.counts[key]; !ok {
+		r.counts[key] = count
+	}
+	return nil
+}
+
+// GetClickCounts returns the cached click counts of the given ads; ads that are
+// not cached are left out of the result
+func (r *MemoryAnalyticsRepository) GetClickCounts(ctx context.Context, tenantID string, adIDs []string) (map[string]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(adIDs))
+	for _, adID := range adIDs {
+		if count, ok := r.counts[memoryCountKey{tenantID, adID}]; ok {
+			counts[adID] = count
+		}
+	}
+	return counts, nil
+}
+
+// SetClickCounts overwrites the cached counts of the given ads
+func (r *MemoryAnalyticsRepository) SetClickCounts(ctx context.Context, tenantID string, counts map[string]int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.fail(ctx); err != nil {
+		return err
+	}
+	for adID, count := range counts {
+		r.counts[memoryCountKey{tenantID, adID}] = count
+	}
+	return nil
+}
+
+// MemoryTenantRepository is an in-memory TenantStore, for tests and running without Postgres
+type MemoryTenantRepository struct {
+	mu      sync.Mutex
+	tenants map[string]models.Tenant
+}
+
+// NewMemoryTenantRepository creates a MemoryTenantRepository holding tenants
+func NewMemoryTenantRepository(tenants ...models.Tenant) *MemoryTenantRepository {
+	r := &MemoryTenantRepository{tenants: make(map[string]models.Tenant)}
+	for _, tenant := range tenants {
+		r.tenants[tenant.ID] = tenant
+	}
+	return r
+}
+
+// Create stores a new tenant
+func (r *MemoryTenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tenants[tenant.ID]; ok {
+		return fmt.Errorf("tenant %s already exists", tenant.ID)
+	}
+	tenant.CreatedAt = time.Now()
+	r.tenants[tenant.ID] = *tenant
+	return nil
+}
+
+// Get returns a tenant
+func (r *MemoryTenantRepository) Get(ctx context.Context, id string) (*models.Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenant, ok := r.tenants[id]
+	if !ok {
+		return nil, ErrTenantNotFound
+	}
+	return &tenant, nil
+}
+
+// List returns all tenants, ordered by ID
+func (r *MemoryTenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenants := make([]models.Tenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants, nil
+}
+
+// MemoryQuotaRepository is an in-memory QuotaStore, for tests and running without Redis
+type MemoryQuotaRepository struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// NewMemoryQuotaRepository creates an empty MemoryQuotaRepository
+func NewMemoryQuotaRepository() *MemoryQuotaRepository {
+	return &MemoryQuotaRepository{counts: make(map[string]int64)}
+}
+
+// IncrementRequests counts a request of a tenant and returns its number of requests in the current minute
+func (r *MemoryQuotaRepository) IncrementRequests(ctx context.Context, tenantID string, now time.Time) (int64, error) {
+	return r.increment(tenantID + ":requests:" + now.UTC().Format("200601021504")), nil
+}
+
+// IncrementClicks counts a click of a tenant and returns its number of clicks in the current UTC day
+func (r *MemoryQuotaRepository) IncrementClicks(ctx context.Context, tenantID string, now time.Time) (int64, error) {
+	return r.increment(tenantID + ":clicks:" + now.UTC().Format("20060102")), nil
+}
+
+// DecrementClicks takes back a click counted by IncrementClicks at now
+func (r *MemoryQuotaRepository) DecrementClicks(ctx context.Context, tenantID string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key := tenantID + ":clicks:" + now.UTC().Format("20060102"); r.counts[key] > 0 {
+		r.counts[key]--
+	}
+	return nil
+}
+
+func (r *MemoryQuotaRepository) increment(key string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[key]++
+	return r.counts[key]
+}
+
+// MemoryAuditRepository is an in-memory AuditStore, for tests and running without Postgres
+type MemoryAuditRepository struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+// NewMemoryAuditRepository creates an empty MemoryAuditRepository
+func NewMemoryAuditRepository() *MemoryAuditRepository {
+	return &MemoryAuditRepository{}
+}
+
+// Append stores an event and fills in its ID and time
+func (r *MemoryAuditRepository) Append(ctx context.Context, event *models.AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event.ID = int64(len(r.events) + 1)
+	event.OccurredAt = time.Now()
+	r.events = append(r.events, *event)
+	return nil
+}
+
+// List returns the events matching filter, newest first
+func (r *MemoryAuditRepository) List(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := []models.AuditEvent{}
+	for i := len(r.events) - 1; i >= 0 && len(events) < filter.Limit; i-- {
+		event := r.events[i]
+		if event.TenantID != filter.TenantID ||
+			filter.EntityType != "" && event.EntityType != filter.EntityType ||
+			filter.EntityID != "" && event.EntityID != filter.EntityID ||
+			filter.Actor != "" && event.Actor != filter.Actor ||
+			!filter.From.IsZero() && event.OccurredAt.Before(filter.From) ||
+			!filter.To.IsZero() && !event.OccurredAt.Before(filter.To) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// MemoryAPIKeyRepository is an in-memory APIKeyStore, for tests
+type MemoryAPIKeyRepository struct {
+	mu     sync.Mutex
+	keys   []models.APIKey // In ID order
+	hashes map[string]int  // Index in keys by hash
+}
+
+// NewMemoryAPIKeyRepository creates an empty MemoryAPIKeyRepository
+func NewMemoryAPIKeyRepository() *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{hashes: make(map[string]int)}
+}
+
+// Create stores a new key with the given hash and fills in its ID and creation time
+func (r *MemoryAPIKeyRepository) Create(ctx context.Context, key *models.APIKey, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(key, hash)
+	return nil
+}
+
+// add stores key; r.mu must be held
+func (r *MemoryAPIKeyRepository) add(key *models.APIKey, hash string) {
+	key.ID = int64(len(r.keys) + 1)
+	key.CreatedAt = time.Now()
+	r.hashes[hash] = len(r.keys)
+	r.keys = append(r.keys, copyAPIKey(*key))
+}
+
+// GetByHash returns the key with the given hash, including revoked and expired keys
+func (r *MemoryAPIKeyRepository) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, ok := r.hashes[hash]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	key := copyAPIKey(r.keys[i])
+	return &key, nil
+}
+
+// Get returns a key of a tenant, including revoked and expired keys
+func (r *MemoryAPIKeyRepository) Get(ctx context.Context, tenantID string, id int64) (*models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, err := r.get(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	key := copyAPIKey(*stored)
+	return &key, nil
+}
+
+// GetForUpdate returns a key of a tenant like Get; the memory store has no locks
+func (r *MemoryAPIKeyRepository) GetForUpdate(ctx context.Context, tenantID string, id int64) (*models.APIKey, error) {
+	return r.Get(ctx, tenantID, id)
+}
+
+// get returns the stored key; r.mu must be held
+func (r *MemoryAPIKeyRepository) get(tenantID string, id int64) (*models.APIKey, error) {
+	if id < 1 || id > int64(len(r.keys)) || r.keys[id-1].TenantID != tenantID {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &r.keys[id-1], nil
+}
+
+// List returns all keys of a tenant, newest first
+func (r *MemoryAPIKeyRepository) List(ctx context.Context, tenantID string) ([]models.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := []models.APIKey{}
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if r.keys[i].TenantID == tenantID {
+			keys = append(keys, copyAPIKey(r.keys[i]))
+		}
+	}
+	return keys, nil
+}
+
+// Rotate replaces the tenant's active key id with a new key, like APIKeyRepository.Rotate
+func (r *MemoryAPIKeyRepository) Rotate(ctx context.Context, tenantID string, id int64, key *models.APIKey, hash string, grace time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, err := r.get(tenantID, id)
+	if err != nil || !old.Active(time.Now()) {
+		return ErrAPIKeyNotFound
+	}
+
+	key.TenantID, key.Name, key.Scopes = tenantID, old.Name, append([]string(nil), old.Scopes...)
+	key.RotatedFrom = &id
+	expiresAt := time.Now().Add(grace)
+	if old.ExpiresAt == nil || expiresAt.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &expiresAt
+	}
+	r.add(key, hash)
+	return nil
+}
+
+// Revoke revokes a tenant's key immediately, keeping the original revocation time
+func (r *MemoryAPIKeyRepository) Revoke(ctx context.Context, tenantID string, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, err := r.get(tenantID, id)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+	}
+	return nil
+}
+
+// TouchLastUsed records that a key was used just now
+func (r *MemoryAPIKeyRepository) TouchLastUsed(ctx context.Context, id int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id >= 1 && id <= int64(len(r.keys)) {
+		now := time.Now()
+		r.keys[id-1].LastUsedAt = &now
+	}
+	return nil
+}
+
+// copyAPIKey returns a copy of key sharing no memory with it
+func copyAPIKey(key models.APIKey) models.APIKey {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	for _, t := range []**time.Time{&key.LastUsedAt, &key.ExpiresAt, &key.RevokedAt} {
+		if *t != nil {
+			v := **t
+			*t = &v
+		}
+	}
+	if key.RotatedFrom != nil {
+		v := *key.RotatedFrom
+		key.RotatedFrom = &v
+	}
+	return key
+}
+
+var (
+	_ AdStore           = (*MemoryAdRepository)(nil)
+	_ ClickStore        = (*MemoryClickRepository)(nil)
+	_ ClickArchiveStore = (*MemoryClickRepository)(nil)
+	_ RollupStore       = (*MemoryClickRepository)(nil)
+	_ AnalyticsStore    = (*MemoryAnalyticsRepository)(nil)
+	_ APIKeyStore       = (*MemoryAPIKeyRepository)(nil)
+	_ TenantStore       = (*MemoryTenantRepository)(nil)
+	_ QuotaStore        = (*MemoryQuotaRepository)(nil)
+	_ AuditStore        = (*MemoryAuditRepository)(nil)
+	_ PartitionStore    = (*MemoryPartitionRepository)(nil)
+	_ OutboxStore       = (*MemoryOutboxRepository)(nil)
+)
+
+// MemoryPartitionRepository is an in-memory PartitionStore, for tests. Like
+// Postgres it refuses partitions overlapping an existing one.
+type MemoryPartitionRepository struct {
+	lock       sync.Mutex // Held by WithLock
+	mu         sync.Mutex
+	partitions map[string][2]time.Time // Range [from, to) by name
+}
+
+// NewMemoryPartitionRepository creates a MemoryPartitionRepository with no partitions
+func NewMemoryPartitionRepository() *MemoryPartitionRepository {
+	return &MemoryPartitionRepository{partitions: make(map[string][2]time.Time)}
+}
+
+// WithLock calls fn unless another call of WithLock is running, in which case
+// it returns false
+func (r *MemoryPartitionRepository) WithLock(ctx context.Context, fn func() error) (bool, error) {
+	if !r.lock.TryLock() {
+		return false, nil
+	}
+	defer r.lock.Unlock()
+	return true, fn()
+}
+
+// CreatePartition creates a partition covering [from, to) if it does not exist yet
+func (r *MemoryPartitionRepository) CreatePartition(ctx context.Context, name string, from, to time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.partitions[name]; ok {
+		return nil
+	}
+	for other, bounds := range r.partitions {
+		if from.Before(bounds[1]) && bounds[0].Before(to) {
+			return fmt.Errorf("partition %q would overlap partition %q", name, other)
+		}
+	}
+	r.partitions[name] = [2]time.Time{from, to}
+	return nil
+}
+
+// ListPartitions returns the names of all partitions, sorted
+func (r *MemoryPartitionRepository) ListPartitions(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.partitions))
+	for name := range r.partitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DetachPartition removes a partition; the memory store keeps no detached tables
+func (r *MemoryPartitionRepository) DetachPartition(ctx context.Context, name string) error {
+	return r.DropPartition(ctx, name)
+}
+
+// DropPartition removes a partition
+func (r *MemoryPartitionRepository) DropPartition(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.partitions, name)
+	return nil
+}
+
+// MemoryOutboxRepository is an in-memory OutboxStore, for tests. Messages are
+// relayed in the order they were added.
+type MemoryOutboxRepository struct {
+	mu       sync.Mutex
+	messages []*memoryOutboxMessage
+	nextID   int64
+}
+
+type memoryOutboxMessage struct {
+	OutboxMessage
+	sentAt         time.Time
+	deadLetteredAt time.Time
+}
+
+// NewMemoryOutboxRepository creates an empty MemoryOutboxRepository
+func NewMemoryOutboxRepository() *MemoryOutboxRepository {
+	return &MemoryOutboxRepository{}
+}
+
+// Add adds a message to the outbox and returns its ID
+func (r *MemoryOutboxRepository) Add(eventType, key string, payload []byte, headers map[string]string) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	r.messages = append(r.messages, &memoryOutboxMessage{OutboxMessage: OutboxMessage{
+		ID: r.nextID, EventType: eventType, Key: key, Payload: payload, Headers: headers, CreatedAt: time.Now(),
+	}})
+	return r.nextID
+}
+
+// Relay passes up to batchSize pending messages to publish, like OutboxRepository.Relay
+func (r *MemoryOutboxRepository) Relay(ctx context.Context, batchSize int, publish func(OutboxMessage) error) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sent, passed := 0, 0
+	for _, m := range r.messages {
+		if passed == batchSize {
+			break
+		}
+		if !m.sentAt.IsZero() || !m.deadLetteredAt.IsZero() {
+			continue
+		}
+		passed++
+		err := publish(m.OutboxMessage)
+		if err == nil {
+			m.sentAt = time.Now()
+			sent++
+			continue
+		}
+		m.Attempts++
+		if errors.Is(err, ErrOutboxDeadLetter) {
+			m.deadLetteredAt = time.Now()
+			continue
+		}
+		return sent, err
+	}
+	return sent, nil
+}
+
+// Stats returns the number of pending and dead-lettered messages and the
+// creation time of the oldest pending one
+func (r *MemoryOutboxRepository) Stats(ctx context.Context) (OutboxStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var stats OutboxStats
+	for _, m := range r.messages {
+		switch {
+		case !m.sentAt.IsZero():
+		case !m.deadLetteredAt.IsZero():
+			stats.DeadLettered++
+		default:
+			if stats.Pending == 0 {
+				stats.Oldest = m.CreatedAt
+			}
+			stats.Pending++
+		}
+	}
+	return stats, nil
+}
+
+// DeleteSent removes messages that were sent before the given time
+func (r *MemoryOutboxRepository) DeleteSent(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.messages[:0]
+	for _, m := range r.messages {
+		if !m.sentAt.IsZero() && m.sentAt.Before(before) {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	deleted := int64(len(r.messages) - len(kept))
+	r.messages = kept
+	return deleted, nil
+}
+
+// DeadLettered returns the dead-lettered messages in the order they were added
+func (r *MemoryOutboxRepository) DeadLettered() []OutboxMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var dead []OutboxMessage
+	for _, m := range r.messages {
+		if !m.deadLetteredAt.IsZero() {
+			dead = append(dead, m.OutboxMessage)
+		}
+	}
+	return dead
+}
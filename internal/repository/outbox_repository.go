@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"ad-tracking-system/internal/tracing"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Event types written to the outbox
+const (
+	OutboxEventClick = "click"
+)
+
+// outboxRelayLockID is the advisory lock held while relaying, so that only one
+// replica publishes at a time and events leave the outbox in order
+const outboxRelayLockID = 0x6f7574626f78 // "outbox"
+
+// outboxMarkTimeout bounds marking a relayed batch
+const outboxMarkTimeout = 5 * time.Second
+
+// ErrOutboxDeadLetter is wrapped by publish errors of Relay to dead-letter the
+// message: it is set aside and never published, instead of being retried
+var ErrOutboxDeadLetter = errors.New("dead-lettered")
+
+// OutboxMessage is an event waiting in the outbox
+type OutboxMessage struct {
+	ID        int64
+	EventType string
+	Key       string
+	Payload   []byte
+	Headers   map[string]string // Trace context of the writer
+	CreatedAt time.Time
+	Attempts  int // Failed publishes so far
+}
+
+// OutboxStats describes the messages in the outbox that were not sent
+type OutboxStats struct {
+	Pending      int64
+	Oldest       time.Time // Creation time of the oldest pending message
+	DeadLettered int64
+}
+
+// OutboxRepository manages the transactional outbox table
+type OutboxRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewOutboxRepository creates a new OutboxRepository
+func NewOutboxRepository(db *sql.DB, logger *slog.Logger) *OutboxRepository {
+	return &OutboxRepository{db: db, logger: logger}
+}
+
+// insertOutboxMessage adds an event to the outbox as part of tx, with the
+// trace context of ctx
+func insertOutboxMessage(ctx context.Context, tx *sql.Tx, eventType, key string, payload []byte) error {
+	headers := make(map[string]string)
+	tracing.Inject(ctx, headers)
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO outbox (event_type, key, payload, headers) VALUES ($1, $2, $3, $4)`
+	_, err = tx.ExecContext(ctx, query, eventType, key, payload, headersJSON)
+	return err
+}
+
+// Relay passes up to batchSize pending messages, in commit order, to publish
+// and marks the published ones as sent. It stops at the first publish error so
+// that later messages are never sent before earlier ones, and counts the
+// failed attempt against the message. A message whose publish error wraps
+// ErrOutboxDeadLetter is dead-lettered instead and the batch goes on. If
+// another replica is relaying, Relay does nothing.
+//
+// Only messages of transactions older than every running transaction are
+// passed on, ordered by transaction ID: ids are handed out before commit, so
+// a transaction committing late could otherwise add a message behind ones
+// that were already published.
+//
+// No transaction is open while publishing: the batch is read, published, and
+// then marked in a short transaction. Replicas are kept apart by a session
+// advisory lock on a dedicated connection instead.
+func (r *OutboxRepository) Relay(ctx context.Context, batchSize int, publish func(OutboxMessage) error) (int, error) {
+	var sent int
+	_, err := withAdvisoryLock(ctx, r.db, outboxRelayLockID, r.logger, func(conn *sql.Conn) error {
+		var err error
+		sent, err = r.relay(ctx, conn, batchSize, publish)
+		return err
+	})
+	return sent, err
+}
+
+// relay relays one batch on conn, which holds the relay lock
+func (r *OutboxRepository) relay(ctx context.Context, conn *sql.Conn, batchSize int, publish func(OutboxMessage) error) (int, error) {
+	messages, err := r.pending(ctx, conn, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	type failure struct {
+		id         int64
+		err        error
+		deadLetter bool
+	}
+	var sent []int64
+	var failures []failure
+	var publishErr error
+	for _, m := range messages {
+		err := publish(m)
+		if err == nil {
+			sent = append(sent, m.ID)
+			continue
+		}
+		deadLetter := errors.Is(err, ErrOutboxDeadLetter)
+		failures = append(failures, failure{id: m.ID, err: err, deadLetter: deadLetter})
+		if !deadLetter {
+			publishErr = err
+			break
+		}
+	}
+
+	// What was published is recorded even if ctx was cancelled meanwhile, so
+	// that it is not published again
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), outboxMarkTimeout)
+	defer cancel()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if len(sent) > 0 {
+		if _, err := tx.ExecContext(ctx, `UPDATE outbox SET sent_at = NOW() WHERE id = ANY($1)`, pq.Array(sent)); err != nil {
+			r.logger.ErrorContext(ctx, "Failed to mark outbox messages as sent", "error", err)
+			return 0, err
+		}
+	}
+	for _, f := range failures {
+		if err := r.recordFailure(ctx, tx, f.id, f.err, f.deadLetter); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(sent), publishErr
+}
+
+// pending reads up to batchSize messages that can be relayed, in commit order
+func (r *OutboxRepository) pending(ctx context.Context, conn *sql.Conn, batchSize int) ([]OutboxMessage, error) {
+	query := `SELECT id, event_type, key, payload, headers, created_at, attempts FROM outbox
+		WHERE sent_at IS NULL AND dead_lettered_at IS NULL AND txid < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY txid, id LIMIT $1`
+	rows, err := conn.QueryContext(ctx, query, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		var headers []byte
+		if err := rows.Scan(&m.ID, &m.EventType, &m.Key, &m.Payload, &headers, &m.CreatedAt, &m.Attempts); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(headers, &m.Headers); err != nil {
+			r.logger.WarnContext(ctx, "Ignoring invalid headers of outbox message", "message_id", m.ID, "error", err)
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// recordFailure counts a failed publish of a message and, if deadLetter is
+// set, dead-letters it
+func (r *OutboxRepository) recordFailure(ctx context.Context, tx *sql.Tx, id int64, publishErr error, deadLetter bool) error {
+	query := `UPDATE outbox SET attempts = attempts + 1, last_error = $2,
+		dead_lettered_at = CASE WHEN $3 THEN NOW() END WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, query, id, publishErr.Error(), deadLetter); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to record failed outbox publish", "message_id", id, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Stats returns the number of pending and dead-lettered messages and the
+// creation time of the oldest pending one
+func (r *OutboxRepository) Stats(ctx context.Context) (OutboxStats, error) {
+	var stats OutboxStats
+	var oldest sql.NullTime
+	query := `SELECT COUNT(*) FILTER (WHERE dead_lettered_at IS NULL),
+		MIN(created_at) FILTER (WHERE dead_lettered_at IS NULL),
+		COUNT(*) FILTER (WHERE dead_lettered_at IS NOT NULL)
+		FROM outbox WHERE sent_at IS NULL`
+	if err := r.db.QueryRowContext(ctx, query).Scan(&stats.Pending, &oldest, &stats.DeadLettered); err != nil {
+		return OutboxStats{}, err
+	}
+	stats.Oldest = oldest.Time
+	return stats, nil
+}
+
+// DeleteSent removes messages that were sent before the given time
+func (r *OutboxRepository) DeleteSent(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < $1`, before)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to delete sent outbox messages", "error", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
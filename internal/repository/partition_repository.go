@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// partitionMaintenanceLockID is the advisory lock held by WithLock
+const partitionMaintenanceLockID = 0x7061727473 // "parts"
+
+// PartitionRepository manages the time partitions of the clicks table
+type PartitionRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewPartitionRepository creates a new PartitionRepository
+func NewPartitionRepository(db *sql.DB, logger *slog.Logger) *PartitionRepository {
+	return &PartitionRepository{db: db, logger: logger}
+}
+
+// WithLock calls fn while holding the partition maintenance lock, so that only
+// one replica maintains the partitions at a time. If another replica holds it,
+// fn is not called and WithLock returns false.
+func (r *PartitionRepository) WithLock(ctx context.Context, fn func() error) (bool, error) {
+	return withAdvisoryLock(ctx, r.db, partitionMaintenanceLockID, r.logger, func(*sql.Conn) error {
+		return fn()
+	})
+}
+
+// CreatePartition creates a clicks partition covering [from, to) if it does not exist yet
+func (r *PartitionRepository) CreatePartition(ctx context.Context, name string, from, to time.Time) error {
+	query := fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF clicks FOR VALUES FROM (%s) TO (%s)`,
+		pq.QuoteIdentifier(name),
+		pq.QuoteLiteral(from.Format("2006-01-02")),
+		pq.QuoteLiteral(to.Format("2006-01-02")),
+	)
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to create partition", "partition", name, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ListPartitions returns the names of all partitions attached to the clicks table
+func (r *PartitionRepository) ListPartitions(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT child.relname
+		FROM pg_inherits
+		JOIN pg_class parent ON pg_inherits.inhparent = parent.oid
+		JOIN pg_class child ON pg_inherits.inhrelid = child.oid
+		WHERE parent.relname = 'clicks'
+		ORDER BY child.relname`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// DetachPartition detaches a partition from clicks, keeping it as a standalone table
+func (r *PartitionRepository) DetachPartition(ctx context.Context, name string) error {
+	query := fmt.Sprintf(`ALTER TABLE clicks DETACH PARTITION %s`, pq.QuoteIdentifier(name))
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to detach partition", "partition", name, "error", err)
+		return err
+	}
+	return nil
+}
+
+// DropPartition drops a partition and all the clicks stored in it
+func (r *PartitionRepository) DropPartition(ctx context.Context, name string) error {
+	query := fmt.Sprintf(`DROP TABLE IF EXISTS %s`, pq.QuoteIdentifier(name))
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to drop partition", "partition", name, "error", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// incrementWindow increments a fixed-window counter and sets its expiry when
+// the window starts. KEYS[1] is the counter, ARGV[1] the expiry in seconds.
+var incrementWindow = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("EXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// decrementWindow takes back a count from a fixed-window counter that still
+// exists, so that a refund after the window has expired does not start a new
+// counter below zero. KEYS[1] is the counter.
+var decrementWindow = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0
+`)
+
+// QuotaRepository counts tenant usage in fixed windows in Redis
+type QuotaRepository struct {
+	redisClient *redis.Client
+	logger      *slog.Logger
+}
+
+// NewQuotaRepository creates a new QuotaRepository
+func NewQuotaRepository(redisClient *redis.Client, logger *slog.Logger) *QuotaRepository {
+	return &QuotaRepository{redisClient: redisClient, logger: logger}
+}
+
+// IncrementRequests counts a request of a tenant and returns its number of
+// requests in the current minute
+func (r *QuotaRepository) IncrementRequests(ctx context.Context, tenantID string, now time.Time) (int64, error) {
+	key := tenantKeyPrefix(tenantID) + "requests:" + now.UTC().Format("200601021504")
+	return r.increment(ctx, key, 2*time.Minute)
+}
+
+// IncrementClicks counts a click of a tenant and returns its number of clicks
+// in the current UTC day
+func (r *QuotaRepository) IncrementClicks(ctx context.Context, tenantID string, now time.Time) (int64, error) {
+	return r.increment(ctx, clicksQuotaKey(tenantID, now), 48*time.Hour)
+}
+
+// DecrementClicks takes back a click counted by IncrementClicks at now
+func (r *QuotaRepository) DecrementClicks(ctx context.Context, tenantID string, now time.Time) error {
+	key := clicksQuotaKey(tenantID, now)
+	if err := decrementWindow.Run(ctx, r.redisClient, []string{key}).Err(); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to decrement quota counter", "key", key, "error", err)
+		return err
+	}
+	return nil
+}
+
+func clicksQuotaKey(tenantID string, now time.Time) string {
+	return tenantKeyPrefix(tenantID) + "quota:clicks:" + now.UTC().Format("20060102")
+}
+
+func (r *QuotaRepository) increment(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	count, err := incrementWindow.Run(ctx, r.redisClient, []string{key}, int64(ttl.Seconds())).Int64()
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to increment quota counter", "key", key, "error", err)
+		return 0, err
+	}
+	return count, nil
+}
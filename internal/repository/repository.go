@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"context"
+	"time"
+)
+
+// Every method taking a tenant ID only sees and changes that tenant's data.
+
+// AdStore reads and seeds ads. It is implemented by AdRepository (Postgres)
+// and MemoryAdRepository.
+type AdStore interface {
+	FetchAll(ctx context.Context, tenantID string) ([]models.Ad, error)
+	CountAds(ctx context.Context, tenantID string) (int, error)
+	Seed(ctx context.Context, tenantID string) error
+}
+
+// ClickStore stores click events. It is implemented by ClickRepository
+// (Postgres) and MemoryClickRepository. Save stores the click under its own
+// TenantID.
+type ClickStore interface {
+	Save(ctx context.Context, click models.ClickEvent) error
+	AdExists(ctx context.Context, tenantID, adID string) (bool, error)
+	GetClickCountByIP(ctx context.Context, tenantID, ip string) (int, error)
+	IsValidIP(ip string) bool
+	IsPlaybackTimeValid(playbackTime int) bool
+}
+
+// ClickArchiveStore reads and deletes the clicks of every tenant by time range,
+// for archival. Reads can be limited to one partition of the clicks table,
+// which the memory store, having no partitions, ignores. It is implemented by
+// ClickRepository (Postgres) and MemoryClickRepository.
+type ClickArchiveStore interface {
+	StreamRange(ctx context.Context, partition string, from, to time.Time, fn func(id int64, click models.ClickEvent) error) error
+	CountRange(ctx context.Context, partition string, from, to time.Time) (int64, error)
+	DeleteRange(ctx context.Context, from, to time.Time, want int64) (int64, error)
+}
+
+// AnalyticsStore caches click counts. It is implemented by AnalyticsRepository
+// (Redis) and MemoryAnalyticsRepository.
+type AnalyticsStore interface {
+	IncrementClickCount(ctx context.Context, tenantID, adID string) error
+	GetClickCount(ctx context.Context, tenantID, adID string) (int64, bool, error)
+	CacheClickCount(ctx context.Context, tenantID, adID string, count int64) error
+	GetClickCounts(ctx context.Context, tenantID string, adIDs []string) (map[string]int64, error)
+	SetClickCounts(ctx context.Context, tenantID string, counts map[string]int64) error
+}
+
+// RollupStore reads rolled-up click counts. It is implemented by
+// RollupRepository (Postgres) and MemoryClickRepository.
+type RollupStore interface {
+	GetTotalClickCount(ctx context.Context, tenantID, adID string) (int64, error)
+	GetTotalClickCounts(ctx context.Context, tenantID string) (map[string]int64, error)
+	GetHourlyClicks(ctx context.Context, tenantID, adID string, from, to time.Time) ([]RollupBucket, error)
+	GetDailyClicks(ctx context.Context, tenantID, adID string, from, to time.Time) ([]RollupBucket, error)
+}
+
+// APIKeyStore stores API keys. It is implemented by APIKeyRepository (Postgres)
+// and MemoryAPIKeyRepository. Create stores the key under its own TenantID.
+type APIKeyStore interface {
+	Create(ctx context.Context, key *models.APIKey, hash string) error
+	GetByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	Get(ctx context.Context, tenantID string, id int64) (*models.APIKey, error)
+	GetForUpdate(ctx context.Context, tenantID string, id int64) (*models.APIKey, error)
+	List(ctx context.Context, tenantID string) ([]models.APIKey, error)
+	Rotate(ctx context.Context, tenantID string, id int64, key *models.APIKey, hash string, grace time.Duration) error
+	Revoke(ctx context.Context, tenantID string, id int64) error
+	TouchLastUsed(ctx context.Context, id int64) error
+}
+
+// TenantStore stores tenants. It is implemented by TenantRepository (Postgres)
+// and MemoryTenantRepository.
+type TenantStore interface {
+	Create(ctx context.Context, tenant *models.Tenant) error
+	Get(ctx context.Context, id string) (*models.Tenant, error)
+	List(ctx context.Context) ([]models.Tenant, error)
+}
+
+// QuotaStore counts tenant usage. It is implemented by QuotaRepository (Redis)
+// and MemoryQuotaRepository.
+type QuotaStore interface {
+	IncrementRequests(ctx context.Context, tenantID string, now time.Time) (int64, error)
+	IncrementClicks(ctx context.Context, tenantID string, now time.Time) (int64, error)
+	DecrementClicks(ctx context.Context, tenantID string, now time.Time) error
+}
+
+// AuditStore appends to and queries the audit log. It is implemented by
+// AuditRepository (Postgres) and MemoryAuditRepository.
+type AuditStore interface {
+	Append(ctx context.Context, event *models.AuditEvent) error
+	List(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error)
+}
+
+// PartitionStore manages the time partitions of the clicks table. It is
+// implemented by PartitionRepository (Postgres) and MemoryPartitionRepository.
+type PartitionStore interface {
+	WithLock(ctx context.Context, fn func() error) (bool, error)
+	CreatePartition(ctx context.Context, name string, from, to time.Time) error
+	ListPartitions(ctx context.Context) ([]string, error)
+	DetachPartition(ctx context.Context, name string) error
+	DropPartition(ctx context.Context, name string) error
+}
+
+// OutboxStore relays the messages of the transactional outbox. It is
+// implemented by OutboxRepository (Postgres) and MemoryOutboxRepository.
+type OutboxStore interface {
+	Relay(ctx context.Context, batchSize int, publish func(OutboxMessage) error) (int, error)
+	Stats(ctx context.Context) (OutboxStats, error)
+	DeleteSent(ctx context.Context, before time.Time) (int64, error)
+}
+
+var (
+	_ AdStore           = (*AdRepository)(nil)
+	_ ClickStore        = (*ClickRepository)(nil)
+	_ ClickArchiveStore = (*ClickRepository)(nil)
+	_ AnalyticsStore    = (*AnalyticsRepository)(nil)
+	_ RollupStore       = (*RollupRepository)(nil)
+	_ APIKeyStore       = (*APIKeyRepository)(nil)
+	_ TenantStore       = (*TenantRepository)(nil)
+	_ QuotaStore        = (*QuotaRepository)(nil)
+	_ AuditStore        = (*AuditRepository)(nil)
+	_ PartitionStore    = (*PartitionRepository)(nil)
+	_ OutboxStore       = (*OutboxRepository)(nil)
+)
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+const clickRollupName = "clicks"
+
+// RollupBucket is the click count of an ad in one hourly or daily bucket
+type RollupBucket struct {
+	Bucket time.Time `json:"bucket"`
+	Clicks int64     `json:"clicks"`
+}
+
+// RollupRepository manages the hourly and daily click rollups in Postgres
+type RollupRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewRollupRepository creates a new RollupRepository
+func NewRollupRepository(db *sql.DB, logger *slog.Logger) *RollupRepository {
+	return &RollupRepository{db: db, logger: logger}
+}
+
+// GetWatermark returns the time before which all clicks are included in the rollups
+func (r *RollupRepository) GetWatermark(ctx context.Context) (time.Time, error) {
+	var watermark time.Time
+	query := `SELECT rolled_up_to FROM rollup_state WHERE name = $1`
+	if err := r.db.QueryRowContext(ctx, query, clickRollupName).Scan(&watermark); err != nil {
+		return time.Time{}, err
+	}
+	return watermark, nil
+}
+
+// RollUp recomputes the hourly rollups for [from, to), the daily rollups of the
+// days they touch, and moves the watermark to to, all in one transaction.
+// from and to must be on hour boundaries.
+func (r *RollupRepository) RollUp(ctx context.Context, from, to time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hourly := `
+		INSERT INTO click_rollups_hourly (tenant_id, ad_id, bucket, clicks)
+		SELECT tenant_id, ad_id, date_trunc('hour', timestamp), COUNT(*)
+		FROM clicks
+		WHERE timestamp >= $1 AND timestamp < $2
+		GROUP BY tenant_id, ad_id, date_trunc('hour', timestamp)
+		ON CONFLICT (tenant_id, ad_id, bucket) DO UPDATE SET clicks = EXCLUDED.clicks`
+	if _, err := tx.ExecContext(ctx, hourly, from, to); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to roll up hourly clicks", "error", err)
+		return err
+	}
+
+	daily := `
+		INSERT INTO click_rollups_daily (tenant_id, ad_id, bucket, clicks)
+		SELECT tenant_id, ad_id, date_trunc('day', bucket)::DATE, SUM(clicks)
+		FROM click_rollups_hourly
+		WHERE bucket >= date_trunc('day', $1::TIMESTAMP) AND bucket < date_trunc('day', $2::TIMESTAMP) + INTERVAL '1 day'
+		GROUP BY tenant_id, ad_id, date_trunc('day', bucket)
+		ON CONFLICT (tenant_id, ad_id, bucket) DO UPDATE SET clicks = EXCLUDED.clicks`
+	if _, err := tx.ExecContext(ctx, daily, from, to); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to roll up daily clicks", "error", err)
+		return err
+	}
+
+	watermark := `UPDATE rollup_state SET rolled_up_to = $2 WHERE name = $1 AND rolled_up_to < $2`
+	if _, err := tx.ExecContext(ctx, watermark, clickRollupName, to); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to move rollup watermark", "error", err)
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTotalClickCount returns the total number of clicks for a tenant's ad: the
+// rolled up clicks before the watermark plus the raw clicks after it
+func (r *RollupRepository) GetTotalClickCount(ctx context.Context, tenantID, adID string) (int64, error) {
+	var count int64
+	query := `
+		SELECT
+			COALESCE((SELECT SUM(clicks) FROM click_rollups_hourly WHERE tenant_id = $1 AND ad_id = $2 AND bucket < s.rolled_up_to), 0)
+			+ (SELECT COUNT(*) FROM clicks WHERE tenant_id = $1 AND ad_id = $2 AND timestamp >= s.rolled_up_to)
+		FROM rollup_state s
+		WHERE s.name = $3`
+	if err := r.db.QueryRowContext(ctx, query, tenantID, adID, clickRollupName).Scan(&count); err != nil {
+		r.logger.ErrorContext(ctx, "Failed to get total click count", "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetTotalClickCounts returns the total number of clicks of every ad of a tenant, keyed by ad ID
+func (r *RollupRepository) GetTotalClickCounts(ctx context.Context, tenantID string) (map[string]int64, error) {
+	query := `
+		WITH s AS (SELECT rolled_up_to FROM rollup_state WHERE name = $1)
+		SELECT
+			a.id,
+			COALESCE((SELECT SUM(h.clicks) FROM click_rollups_hourly h, s WHERE h.tenant_id = a.tenant_id AND h.ad_id = a.id AND h.bucket < s.rolled_up_to), 0)
+			+ (SELECT COUNT(*) FROM clicks c, s WHERE c.tenant_id = a.tenant_id AND c.ad_id = a.id AND c.timestamp >= s.rolled_up_to)
+		FROM ads a
+		WHERE a.tenant_id = $2`
+	rows, err := r.db.QueryContext(ctx, query, clickRollupName, tenantID)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to get total click counts", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var adID string
+		var count int64
+		if err := rows.Scan(&adID, &count); err != nil {
+			return nil, err
+		}
+		counts[adID] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetHourlyClicks returns the hourly rollups of a tenant's ad with a bucket in [from, to)
+func (r *RollupRepository) GetHourlyClicks(ctx context.Context, tenantID, adID string, from, to time.Time) ([]RollupBucket, error) {
+	query := `SELECT bucket, clicks FROM click_rollups_hourly WHERE tenant_id = $1 AND ad_id = $2 AND bucket >= $3 AND bucket < $4 ORDER BY bucket`
+	return r.queryBuckets(ctx, query, tenantID, adID, from, to)
+}
+
+// GetDailyClicks returns the daily rollups of a tenant's ad with a bucket in [from, to)
+func (r *RollupRepository) GetDailyClicks(ctx context.Context, tenantID, adID string, from, to time.Time) ([]RollupBucket, error) {
+	query := `SELECT bucket, clicks FROM click_rollups_daily WHERE tenant_id = $1 AND ad_id = $2 AND bucket >= $3 AND bucket < $4 ORDER BY bucket`
+	return r.queryBuckets(ctx, query, tenantID, adID, from, to)
+}
+
+func (r *RollupRepository) queryBuckets(ctx context.Context, query, tenantID, adID string, from, to time.Time) ([]RollupBucket, error) {
+	rows, err := r.db.QueryContext(ctx, query, tenantID, adID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []RollupBucket{}
+	for rows.Next() {
+		var b RollupBucket
+		if err := rows.Scan(&b.Bucket, &b.Clicks); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
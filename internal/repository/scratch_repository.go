@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"github.com/lib/pq"
+)
+
+// CreateScratchSchema creates a schema holding an empty copy of the clicks table,
+// for replaying events without touching the live data. The copy numbers its
+// clicks from a sequence of its own, so replays use up no live click IDs.
+func CreateScratchSchema(ctx context.Context, db *sql.DB, schema string) error {
+	table := pq.QuoteIdentifier(schema) + ".clicks"
+	sequence := pq.QuoteIdentifier(schema) + ".clicks_id_seq"
+	statements := []string{
+		fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS %s`, pq.QuoteIdentifier(schema)),
+		fmt.Sprintf(`CREATE SEQUENCE IF NOT EXISTS %s AS INT`, sequence),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (LIKE public.clicks INCLUDING DEFAULTS)`, table),
+		fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN id SET DEFAULT nextval(%s)`, table, pq.QuoteLiteral(sequence)),
+		fmt.Sprintf(`ALTER SEQUENCE %s OWNED BY %s.id`, sequence, table),
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create scratch schema %s: %w", schema, err)
+		}
+	}
+	return nil
+}
+
+// ScratchDatabaseURL returns databaseURL with a search path that resolves tables
+// in schema first, falling back to public for the ones it does not have (ads)
+func ScratchDatabaseURL(databaseURL, schema string) (string, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("search_path", schema+",public")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
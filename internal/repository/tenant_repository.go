@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+)
+
+// ErrTenantNotFound is returned for tenants that do not exist
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// TenantRepository stores tenants and their quotas in the tenants table
+type TenantRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewTenantRepository creates a new TenantRepository
+func NewTenantRepository(db *sql.DB, logger *slog.Logger) *TenantRepository {
+	return &TenantRepository{db: db, logger: logger}
+}
+
+// Create stores a new tenant and fills in its creation time
+func (r *TenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	query := `INSERT INTO tenants (id, name, requests_per_minute, clicks_per_day) VALUES ($1, $2, $3, $4) RETURNING created_at`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, tenant.ID, tenant.Name, tenant.RequestsPerMinute, tenant.ClicksPerDay).Scan(&tenant.CreatedAt)
+	if err != nil {
+		r.logger.ErrorContext(ctx, "Failed to create tenant", "tenant_id", tenant.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Get returns a tenant
+func (r *TenantRepository) Get(ctx context.Context, id string) (*models.Tenant, error) {
+	var tenant models.Tenant
+	query := `SELECT id, name, requests_per_minute, clicks_per_day, created_at FROM tenants WHERE id = $1`
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&tenant.ID, &tenant.Name, &tenant.RequestsPerMinute, &tenant.ClicksPerDay, &tenant.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrTenantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+// List returns all tenants, ordered by ID
+func (r *TenantRepository) List(ctx context.Context) ([]models.Tenant, error) {
+	query := `SELECT id, name, requests_per_minute, clicks_per_day, created_at FROM tenants ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []models.Tenant
+	for rows.Next() {
+		var tenant models.Tenant
+		if err := rows.Scan(&tenant.ID, &tenant.Name, &tenant.RequestsPerMinute, &tenant.ClicksPerDay, &tenant.CreatedAt); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, rows.Err()
+}
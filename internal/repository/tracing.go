@@ -0,0 +1,309 @@
+package repository
+
+import (
+	"ad-tracking-system/internal/domain/models"
+	"ad-tracking-system/internal/tracing"
+	"context"
+	"reflect"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The Trace* functions wrap a store so that every call runs in a client span
+// named after the store's type and the method, e.g. ClickRepository.Save.
+// Methods that don't take a context are passed through untraced.
+
+// spanPrefix is the name of the type of store, without the package
+func spanPrefix(store interface{}) string {
+	t := reflect.TypeOf(store)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name() + "."
+}
+
+func traced[T any](ctx context.Context, name string, fn func(ctx context.Context) (T, error)) (T, error) {
+	ctx, span := tracing.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	result, err := fn(ctx)
+	tracing.End(span, err)
+	return result, err
+}
+
+func tracedErr(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	_, err := traced(ctx, name, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// TraceAdStore traces the calls to store
+func TraceAdStore(store AdStore) AdStore {
+	return &tracedAdStore{store: store, prefix: spanPrefix(store)}
+}
+
+type tracedAdStore struct {
+	store  AdStore
+	prefix string
+}
+
+func (s *tracedAdStore) FetchAll(ctx context.Context, tenantID string) ([]models.Ad, error) {
+	return traced(ctx, s.prefix+"FetchAll", func(ctx context.Context) ([]models.Ad, error) {
+		return s.store.FetchAll(ctx, tenantID)
+	})
+}
+
+func (s *tracedAdStore) CountAds(ctx context.Context, tenantID string) (int, error) {
+	return traced(ctx, s.prefix+"CountAds", func(ctx context.Context) (int, error) {
+		return s.store.CountAds(ctx, tenantID)
+	})
+}
+
+func (s *tracedAdStore) Seed(ctx context.Context, tenantID string) error {
+	return tracedErr(ctx, s.prefix+"Seed", func(ctx context.Context) error {
+		return s.store.Seed(ctx, tenantID)
+	})
+}
+
+// TraceClickStore traces the calls to store
+func TraceClickStore(store ClickStore) ClickStore {
+	return &tracedClickStore{ClickStore: store, prefix: spanPrefix(store)}
+}
+
+type tracedClickStore struct {
+	ClickStore // IsValidIP and IsPlaybackTimeValid
+	prefix     string
+}
+
+func (s *tracedClickStore) Save(ctx context.Context, click models.ClickEvent) error {
+	return tracedErr(ctx, s.prefix+"Save", func(ctx context.Context) error {
+		return s.ClickStore.Save(ctx, click)
+	})
+}
+
+func (s *tracedClickStore) AdExists(ctx context.Context, tenantID, adID string) (bool, error) {
+	return traced(ctx, s.prefix+"AdExists", func(ctx context.Context) (bool, error) {
+		return s.ClickStore.AdExists(ctx, tenantID, adID)
+	})
+}
+
+func (s *tracedClickStore) GetClickCountByIP(ctx context.Context, tenantID, ip string) (int, error) {
+	return traced(ctx, s.prefix+"GetClickCountByIP", func(ctx context.Context) (int, error) {
+		return s.ClickStore.GetClickCountByIP(ctx, tenantID, ip)
+	})
+}
+
+// TraceAnalyticsStore traces the calls to store
+func TraceAnalyticsStore(store AnalyticsStore) AnalyticsStore {
+	return &tracedAnalyticsStore{store: store, prefix: spanPrefix(store)}
+}
+
+type tracedAnalyticsStore struct {
+	store  AnalyticsStore
+	prefix string
+}
+
+func (s *tracedAnalyticsStore) IncrementClickCount(ctx context.Context, tenantID, adID string) error {
+	return tracedErr(ctx, s.prefix+"IncrementClickCount", func(ctx context.Context) error {
+		return s.store.IncrementClickCount(ctx, tenantID, adID)
+	})
+}
+
+func (s *tracedAnalyticsStore) GetClickCount(ctx context.Context, tenantID, adID string) (int64, bool, error) {
+	var cached bool
+	count, err := traced(ctx, s.prefix+"GetClickCount", func(ctx context.Context) (int64, error) {
+		var count int64
+		var err error
+		count, cached, err = s.store.GetClickCount(ctx, tenantID, adID)
+		return count, err
+	})
+	return count, cached, err
+}
+
+func (s *tracedAnalyticsStore) CacheClickCount(ctx context.Context, tenantID, adID string, count int64) error {
+	return tracedErr(ctx, s.prefix+"CacheClickCount", func(ctx context.Context) error {
+		return s.store.CacheClickCount(ctx, tenantID, adID, count)
+	})
+}
+
+func (s *tracedAnalyticsStore) GetClickCounts(ctx context.Context, tenantID string, adIDs []string) (map[string]int64, error) {
+	return traced(ctx, s.prefix+"GetClickCounts", func(ctx context.Context) (map[string]int64, error) {
+		return s.store.GetClickCounts(ctx, tenantID, adIDs)
+	})
+}
+
+func (s *tracedAnalyticsStore) SetClickCounts(ctx context.Context, tenantID string, counts map[string]int64) error {
+	return tracedErr(ctx, s.prefix+"SetClickCounts", func(ctx context.Context) error {
+		return s.store.SetClickCounts(ctx, tenantID, counts)
+	})
+}
+
+// TraceRollupStore traces the calls to store
+func TraceRollupStore(store RollupStore) RollupStore {
+	return &tracedRollupStore{store: store, prefix: spanPrefix(store)}
+}
+
+type tracedRollupStore struct {
+	store  RollupStore
+	prefix string
+}
+
+func (s *tracedRollupStore) GetTotalClickCount(ctx context.Context, tenantID, adID string) (int64, error) {
+	return traced(ctx, s.prefix+"GetTotalClickCount", func(ctx context.Context) (int64, error) {
+		return s.store.GetTotalClickCount(ctx, tenantID, adID)
+	})
+}
+
+func (s *tracedRollupStore) GetTotalClickCounts(ctx context.Context, tenantID string) (map[string]int64, error) {
+	return traced(ctx, s.prefix+"GetTotalClickCounts", func(ctx context.Context) (map[string]int64, error) {
+		return s.store.GetTotalClickCounts(ctx, tenantID)
+	})
+}
+
+func (s *tracedRollupStore) GetHourlyClicks(ctx context.Context, tenantID, adID string, from, to time.Time) ([]RollupBucket, error) {
+	return traced(ctx, s.prefix+"GetHourlyClicks", func(ctx context.Context) ([]RollupBucket, error) {
+		return s.store.GetHourlyClicks(ctx, tenantID, adID, from, to)
+	})
+}
+
+func (s *tracedRollupStore) GetDailyClicks(ctx context.Context, tenantID, adID string, from, to time.Time) ([]RollupBucket, error) {
+	return traced(ctx, s.prefix+"GetDailyClicks", func(ctx context.Context) ([]RollupBucket, error) {
+		return s.store.GetDailyClicks(ctx, tenantID, adID, from, to)
+	})
+}
+
+// TraceAPIKeyStore traces the calls to store
+func TraceAPIKeyStore(store APIKeyStore) APIKeyStore {
+	return &tracedAPIKeyStore{store: store, prefix: spanPrefix(store)}
+}
+
+type tracedAPIKeyStore struct {
+	store  APIKeyStore
+	prefix string
+}
+
+func (s *tracedAPIKeyStore) Create(ctx context.Context, key *models.APIKey, hash string) error {
+	return tracedErr(ctx, s.prefix+"Create", func(ctx context.Context) error {
+		return s.store.Create(ctx, key, hash)
+	})
+}
+
+func (s *tracedAPIKeyStore) GetByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	return traced(ctx, s.prefix+"GetByHash", func(ctx context.Context) (*models.APIKey, error) {
+		return s.store.GetByHash(ctx, hash)
+	})
+}
+
+func (s *tracedAPIKeyStore) Get(ctx context.Context, tenantID string, id int64) (*models.APIKey, error) {
+	return traced(ctx, s.prefix+"Get", func(ctx context.Context) (*models.APIKey, error) {
+		return s.store.Get(ctx, tenantID, id)
+	})
+}
+
+func (s *tracedAPIKeyStore) GetForUpdate(ctx context.Context, tenantID string, id int64) (*models.APIKey, error) {
+	return traced(ctx, s.prefix+"GetForUpdate", func(ctx context.Context) (*models.APIKey, error) {
+		return s.store.GetForUpdate(ctx, tenantID, id)
+	})
+}
+
+func (s *tracedAPIKeyStore) List(ctx context.Context, tenantID string) ([]models.APIKey, error) {
+	return traced(ctx, s.prefix+"List", func(ctx context.Context) ([]models.APIKey, error) {
+		return s.store.List(ctx, tenantID)
+	})
+}
+
+func (s *tracedAPIKeyStore) Rotate(ctx context.Context, tenantID string, id int64, key *models.APIKey, hash string, grace time.Duration) error {
+	return tracedErr(ctx, s.prefix+"Rotate", func(ctx context.Context) error {
+		return s.store.Rotate(ctx, tenantID, id, key, hash, grace)
+	})
+}
+
+func (s *tracedAPIKeyStore) Revoke(ctx context.Context, tenantID string, id int64) error {
+	return tracedErr(ctx, s.prefix+"Revoke", func(ctx context.Context) error {
+		return s.store.Revoke(ctx, tenantID, id)
+	})
+}
+
+func (s *tracedAPIKeyStore) TouchLastUsed(ctx context.Context, id int64) error {
+	return tracedErr(ctx, s.prefix+"TouchLastUsed", func(ctx context.Context) error {
+		return s.store.TouchLastUsed(ctx, id)
+	})
+}
+
+// TraceTenantStore traces the calls to store
+func TraceTenantStore(store TenantStore) TenantStore {
+	return &tracedTenantStore{store: store, prefix: spanPrefix(store)}
+}
+
+type tracedTenantStore struct {
+	store  TenantStore
+	prefix string
+}
+
+func (s *tracedTenantStore) Create(ctx context.Context, tenant *models.Tenant) error {
+	return tracedErr(ctx, s.prefix+"Create", func(ctx context.Context) error {
+		return s.store.Create(ctx, tenant)
+	})
+}
+
+func (s *tracedTenantStore) Get(ctx context.Context, id string) (*models.Tenant, error) {
+	return traced(ctx, s.prefix+"Get", func(ctx context.Context) (*models.Tenant, error) {
+		return s.store.Get(ctx, id)
+	})
+}
+
+func (s *tracedTenantStore) List(ctx context.Context) ([]models.Tenant, error) {
+	return traced(ctx, s.prefix+"List", func(ctx context.Context) ([]models.Tenant, error) {
+		return s.store.List(ctx)
+	})
+}
+
+// TraceQuotaStore traces the calls to store
+func TraceQuotaStore(store QuotaStore) QuotaStore {
+	return &tracedQuotaStore{store: store, prefix: spanPrefix(store)}
+}
+
+type tracedQuotaStore struct {
+	store  QuotaStore
+	prefix string
+}
+
+func (s *tracedQuotaStore) IncrementRequests(ctx context.Context, tenantID string, now time.Time) (int64, error) {
+	return traced(ctx, s.prefix+"IncrementRequests", func(ctx context.Context) (int64, error) {
+		return s.store.IncrementRequests(ctx, tenantID, now)
+	})
+}
+
+func (s *tracedQuotaStore) IncrementClicks(ctx context.Context, tenantID string, now time.Time) (int64, error) {
+	return traced(ctx, s.prefix+"IncrementClicks", func(ctx context.Context) (int64, error) {
+		return s.store.IncrementClicks(ctx, tenantID, now)
+	})
+}
+
+func (s *tracedQuotaStore) DecrementClicks(ctx context.Context, tenantID string, now time.Time) error {
+	return tracedErr(ctx, s.prefix+"DecrementClicks", func(ctx context.Context) error {
+		return s.store.DecrementClicks(ctx, tenantID, now)
+	})
+}
+
+// TraceAuditStore traces the calls to store
+func TraceAuditStore(store AuditStore) AuditStore {
+	return &tracedAuditStore{store: store, prefix: spanPrefix(store)}
+}
+
+type tracedAuditStore struct {
+	store  AuditStore
+	prefix string
+}
+
+func (s *tracedAuditStore) Append(ctx context.Context, event *models.AuditEvent) error {
+	return tracedErr(ctx, s.prefix+"Append", func(ctx context.Context) error {
+		return s.store.Append(ctx, event)
+	})
+}
+
+func (s *tracedAuditStore) List(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error) {
+	return traced(ctx, s.prefix+"List", func(ctx context.Context) ([]models.AuditEvent, error) {
+		return s.store.List(ctx, filter)
+	})
+}
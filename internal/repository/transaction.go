@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"log/slog"
+	"time"
+)
+
+// unlockTimeout bounds releasing an advisory lock
+const unlockTimeout = 5 * time.Second
+
+// TxRunner runs functions in a transaction. It is implemented by Transactor
+// (Postgres) and MemoryTransactor.
+type TxRunner interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// querier is what *sql.DB and *sql.Tx have in common
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txContextKey struct{}
+
+// Transactor runs functions in a Postgres transaction
+type Transactor struct {
+	db *sql.DB
+}
+
+// NewTransactor creates a new Transactor
+func NewTransactor(db *sql.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+// InTx runs fn in a transaction, which is committed if fn returns nil and
+// rolled back otherwise. The calls of Postgres repositories made with the
+// context passed to fn take part in the transaction, and so does a nested InTx.
+func (t *Transactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return inTx(ctx, t.db, func(ctx context.Context, _ querier) error {
+		return fn(ctx)
+	})
+}
+
+// inTx runs fn in the transaction of ctx, if there is one, or in a new
+// transaction on db
+func inTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context, q querier) error) error {
+	if tx, ok := ctx.Value(txContextKey{}).(*sql.Tx); ok {
+		return fn(ctx, tx)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(context.WithValue(ctx, txContextKey{}, tx), tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// conn returns the transaction of ctx, if there is one, or db
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txContextKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// withAdvisoryLock calls fn with a dedicated connection holding the session
+// advisory lock id, and releases it afterwards. If another session holds the
+// lock, fn is not called and withAdvisoryLock returns false. Should the lock
+// not be released, the connection is discarded rather than returned to the
+// pool still holding it.
+func withAdvisoryLock(ctx context.Context, db *sql.DB, id int64, logger *slog.Logger, fn func(conn *sql.Conn) error) (bool, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, id).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), unlockTimeout)
+		defer cancel()
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, id); err != nil {
+			logger.WarnContext(ctx, "Failed to release advisory lock, closing its connection", "lock_id", id, "error", err)
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+	return true, fn(conn)
+}
+
+// MemoryTransactor is a TxRunner for the memory repositories. They have no
+// transactions, so it only calls fn, and changes made before fn fails stay.
+type MemoryTransactor struct{}
+
+// InTx calls fn
+func (MemoryTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+var (
+	_ TxRunner = (*Transactor)(nil)
+	_ TxRunner = MemoryTransactor{}
+)
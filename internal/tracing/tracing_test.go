@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestPropagationAndLogging(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: ExporterNone}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A trace arriving in message headers is continued by spans started from
+	// the extracted context, even when spans are not recorded
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := Extract(context.Background(), map[string]string{"traceparent": traceParent})
+	ctx, span := Start(ctx, "handle")
+	defer span.End()
+	if got := trace.SpanContextFromContext(ctx).TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace ID = %s, want the one of the headers", got)
+	}
+
+	headers := make(map[string]string)
+	Inject(ctx, headers)
+	if headers["traceparent"] != traceParent {
+		t.Errorf("injected traceparent = %q, want %q", headers["traceparent"], traceParent)
+	}
+
+	var out bytes.Buffer
+	slog.New(NewLogHandler(slog.NewJSONHandler(&out, nil))).With("job", "test").InfoContext(ctx, "handled")
+	var record map[string]string
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || record["span_id"] != "00f067aa0ba902b7" || record["job"] != "test" {
+		t.Errorf("log record = %v, want the trace and span IDs", record)
+	}
+}
@@ -1,24 +1,89 @@
 package circuitbreaker
 
 import (
-	"log"
+	"ad-tracking-system/internal/tracing"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// NewCircuitBreaker creates a new circuit breaker
-func NewCircuitBreaker(name string) *gobreaker.CircuitBreaker {
-	return gobreaker.NewCircuitBreaker(gobreaker.Settings{
+var (
+	mu       sync.Mutex
+	breakers = make(map[string]*gobreaker.CircuitBreaker)
+
+	// failureThreshold is shared by every breaker so that it can be changed
+	// while they run
+	failureThreshold atomic.Int64
+)
+
+func init() {
+	failureThreshold.Store(5)
+}
+
+// SetFailureThreshold sets how many consecutive failures every breaker
+// tolerates before it trips, including breakers already created
+func SetFailureThreshold(failures int) {
+	failureThreshold.Store(int64(failures))
+}
+
+// NewCircuitBreaker creates a new circuit breaker and registers it by name,
+// replacing any earlier breaker of the same name, so that States reports it.
+// State changes are logged to logger.
+func NewCircuitBreaker(name string, logger *slog.Logger) *gobreaker.CircuitBreaker {
+	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
 		Name:        name,
 		MaxRequests: 3,                // Number of requests allowed in half-open state
 		Interval:    10 * time.Second, // Time window for counting failures
 		Timeout:     30 * time.Second, // Time to wait before switching from open to half-open
 		ReadyToTrip: func(counts gobreaker.Counts) bool {
-			return counts.ConsecutiveFailures > 5 // Trip after 5 consecutive failures
+			return int64(counts.ConsecutiveFailures) > failureThreshold.Load()
+		},
+		// A caller that gave up is not a failure of the dependency; a deadline
+		// that expired is, so slow dependencies still trip the breaker
+		IsSuccessful: func(err error) bool {
+			return err == nil || errors.Is(err, context.Canceled)
 		},
 		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
-			log.Printf("Circuit breaker %s changed from %s to %s", name, from, to)
+			logger.Warn("Circuit breaker changed state", "breaker", name, "from", from.String(), "to", to.String())
 		},
 	})
+
+	mu.Lock()
+	breakers[name] = cb
+	mu.Unlock()
+	return cb
+}
+
+// States returns the state of every breaker created in this process by name:
+// "closed", "half-open" or "open"
+func States() map[string]string {
+	mu.Lock()
+	defer mu.Unlock()
+	states := make(map[string]string, len(breakers))
+	for name, cb := range breakers {
+		states[name] = cb.State().String()
+	}
+	return states
+}
+
+// Execute runs fn through cb in a span named after the breaker. fn is given
+// the span's context, so its own spans nest under it; calls the breaker
+// rejects show up as failed spans.
+func Execute(ctx context.Context, cb *gobreaker.CircuitBreaker, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	ctx, span := tracing.Start(ctx, "circuit_breaker "+cb.Name(), trace.WithAttributes(
+		attribute.String("circuit_breaker.name", cb.Name()),
+		attribute.String("circuit_breaker.state", cb.State().String()),
+	))
+	result, err := cb.Execute(func() (interface{}, error) {
+		return fn(ctx)
+	})
+	tracing.End(span, err)
+	return result, err
 }
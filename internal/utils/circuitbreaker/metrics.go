@@ -0,0 +1,32 @@
+package circuitbreaker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var stateDesc = prometheus.NewDesc(
+	"circuit_breaker_state",
+	"State of each circuit breaker: 0 closed, 1 half-open, 2 open",
+	[]string{"name"}, nil,
+)
+
+// stateCollector reports the state of every registered breaker when scraped.
+// gobreaker only moves from open to half-open when asked for the state, so a
+// gauge set on state changes would stay open too long.
+type stateCollector struct{}
+
+func (stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- stateDesc
+}
+
+func (stateCollector) Collect(ch chan<- prometheus.Metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	for name, cb := range breakers {
+		ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, float64(cb.State()), name)
+	}
+}
+
+func init() {
+	prometheus.MustRegister(stateCollector{})
+}
@@ -5,6 +5,15 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// Outcomes of a click, the outcome label of ClickEventsTotal
+const (
+	ClickAccepted           = "accepted"
+	ClickRejectedValidation = "rejected_validation" // Invalid input, click token or ad
+	ClickRateLimited        = "rate_limited"        // Over the tenant's daily click quota
+	ClickFraud              = "fraud"               // Too many clicks from one IP
+	ClickError              = "error"               // Postgres or Redis failed
+)
+
 var (
 	// HTTP request count
 	HTTPRequestsTotal = promauto.NewCounterVec(
@@ -15,6 +24,16 @@ var (
 		[]string{"method", "endpoint", "status"},
 	)
 
+	// HTTP request latency
+	HTTPRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Latency of HTTP requests, by route template and status",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"method", "endpoint", "status"},
+	)
+
 	// Kafka event processing latency
 	KafkaProcessingLatency = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -25,11 +44,97 @@ var (
 		[]string{"topic"},
 	)
 
+	// Messages between a consumer's position and the end of its partition
+	KafkaConsumerLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Number of messages a consumer group has yet to consume, by partition",
+		},
+		[]string{"group", "topic", "partition"},
+	)
+
 	// Click event count
-	ClickEventsTotal = promauto.NewCounter(
+	ClickEventsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "click_events_total",
-			Help: "Total number of click events processed",
+			Help: "Total number of click events processed, by outcome",
+		},
+		[]string{"outcome"},
+	)
+)
+
+var (
+	// Absolute drift between the Redis click counters and Postgres, summed over all ads
+	ClickCounterDrift = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "click_counter_drift",
+			Help: "Sum of absolute differences between Redis click counters and Postgres",
+		},
+	)
+
+	// Number of ads whose Redis click counter differs from Postgres
+	ClickCounterDriftedAds = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "click_counter_drifted_ads",
+			Help: "Number of ads whose Redis click counter differs from Postgres",
+		},
+	)
+
+	// 1 when the click counter drift exceeds the configured threshold
+	ClickCounterDriftAlert = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "click_counter_drift_alert",
+			Help: "1 when the click counter drift exceeds the configured threshold, 0 otherwise",
+		},
+	)
+)
+
+var (
+	// Outbox messages not yet published to Kafka
+	OutboxPendingMessages = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "outbox_pending_messages",
+			Help: "Number of outbox messages not yet published to Kafka",
+		},
+	)
+
+	// Age of the oldest unpublished outbox message
+	OutboxLagSeconds = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "outbox_lag_seconds",
+			Help: "Age in seconds of the oldest outbox message not yet published to Kafka",
+		},
+	)
+
+	// Outbox messages published to Kafka
+	OutboxPublishedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "outbox_published_total",
+			Help: "Total number of outbox messages published to Kafka",
+		},
+	)
+
+	// Failed attempts to publish an outbox message
+	OutboxPublishFailuresTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "outbox_publish_failures_total",
+			Help: "Total number of failed attempts to publish an outbox message to Kafka",
+		},
+	)
+
+	// Outbox messages set aside because they could not be published
+	OutboxDeadLetteredTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "outbox_dead_lettered_total",
+			Help: "Total number of outbox messages dead-lettered instead of published",
+		},
+	)
+
+	// Dead-lettered outbox messages still in the outbox
+	OutboxDeadLetteredMessages = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "outbox_dead_lettered_messages",
+			Help: "Number of dead-lettered outbox messages waiting to be requeued or deleted",
 		},
 	)
 )
@@ -0,0 +1,54 @@
+-- Convert clicks into a table range-partitioned by month on timestamp.
+-- Monthly partitions are created here for the existing data plus the next
+-- three months; the partition maintenance job keeps creating future ones
+-- and enforces retention from then on.
+BEGIN;
+
+ALTER TABLE clicks RENAME TO clicks_legacy;
+ALTER SEQUENCE clicks_id_seq OWNED BY NONE;
+
+CREATE TABLE clicks (
+    id            INT NOT NULL DEFAULT nextval('clicks_id_seq'),
+    ad_id         VARCHAR(36) NOT NULL,
+    timestamp     TIMESTAMP NOT NULL,
+    ip            TEXT NOT NULL,
+    playback_time INT NOT NULL,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+ALTER SEQUENCE clicks_id_seq OWNED BY clicks.id;
+
+CREATE INDEX idx_clicks_ad_id_timestamp ON clicks (ad_id, timestamp);
+CREATE INDEX idx_clicks_ip_timestamp ON clicks (ip, timestamp);
+
+-- Catch-all for rows outside every range so inserts never fail; it should
+-- stay empty as long as the maintenance job is running.
+CREATE TABLE clicks_default PARTITION OF clicks DEFAULT;
+
+DO $$
+DECLARE
+    month_start DATE;
+    last_month  DATE;
+BEGIN
+    SELECT date_trunc('month', COALESCE(MIN(timestamp), NOW()))::DATE
+      INTO month_start
+      FROM clicks_legacy;
+    last_month := (date_trunc('month', NOW()) + INTERVAL '3 months')::DATE;
+
+    WHILE month_start <= last_month LOOP
+        EXECUTE format(
+            'CREATE TABLE IF NOT EXISTS %I PARTITION OF clicks FOR VALUES FROM (%L) TO (%L)',
+            'clicks_p' || to_char(month_start, 'YYYYMM'),
+            month_start,
+            (month_start + INTERVAL '1 month')::DATE
+        );
+        month_start := (month_start + INTERVAL '1 month')::DATE;
+    END LOOP;
+END $$;
+
+INSERT INTO clicks (id, ad_id, timestamp, ip, playback_time)
+SELECT id, ad_id, timestamp, ip, playback_time FROM clicks_legacy;
+
+DROP TABLE clicks_legacy;
+
+COMMIT;
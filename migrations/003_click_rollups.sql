@@ -0,0 +1,24 @@
+-- Durable click aggregates. Hourly rollups are rebuilt incrementally from
+-- clicks by the rollup job, daily rollups are derived from the hourly ones.
+CREATE TABLE click_rollups_hourly (
+    ad_id   VARCHAR(36) NOT NULL,
+    bucket  TIMESTAMP NOT NULL,
+    clicks  BIGINT NOT NULL,
+    PRIMARY KEY (ad_id, bucket)
+);
+
+CREATE TABLE click_rollups_daily (
+    ad_id   VARCHAR(36) NOT NULL,
+    bucket  DATE NOT NULL,
+    clicks  BIGINT NOT NULL,
+    PRIMARY KEY (ad_id, bucket)
+);
+
+-- rolled_up_to is the watermark: every click before it is counted in
+-- click_rollups_hourly, every click at or after it is only in clicks.
+CREATE TABLE rollup_state (
+    name          TEXT PRIMARY KEY,
+    rolled_up_to  TIMESTAMP NOT NULL
+);
+
+INSERT INTO rollup_state (name, rolled_up_to) VALUES ('clicks', '1970-01-01');
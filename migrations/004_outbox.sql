@@ -0,0 +1,13 @@
+-- Transactional outbox: events are written here in the same transaction as
+-- the row they describe and published to Kafka by the outbox relay.
+CREATE TABLE outbox (
+    id          BIGSERIAL PRIMARY KEY,
+    event_type  TEXT NOT NULL,
+    key         TEXT NOT NULL,
+    payload     BYTEA NOT NULL,
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    sent_at     TIMESTAMP
+);
+
+CREATE INDEX idx_outbox_pending ON outbox (id) WHERE sent_at IS NULL;
+CREATE INDEX idx_outbox_sent_at ON outbox (sent_at) WHERE sent_at IS NOT NULL;
@@ -0,0 +1,17 @@
+-- Windowed click counts produced by the exactly-once click aggregator.
+CREATE TABLE click_window_counts (
+    ad_id         VARCHAR(36) NOT NULL,
+    window_start  TIMESTAMP NOT NULL,
+    window_end    TIMESTAMP NOT NULL,
+    clicks        BIGINT NOT NULL,
+    PRIMARY KEY (ad_id, window_start)
+);
+
+-- Last source offset applied per click topic partition, so redelivered
+-- aggregates are not applied twice.
+CREATE TABLE click_aggregate_offsets (
+    source_topic      TEXT NOT NULL,
+    source_partition  INT NOT NULL,
+    last_offset       BIGINT NOT NULL,
+    PRIMARY KEY (source_topic, source_partition)
+);
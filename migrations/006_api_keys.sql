@@ -0,0 +1,14 @@
+-- API keys. Only the SHA-256 hash of a key is stored; the key itself is shown
+-- once, when it is created or rotated.
+CREATE TABLE api_keys (
+    id            BIGSERIAL PRIMARY KEY,
+    name          TEXT NOT NULL,
+    prefix        TEXT NOT NULL,
+    key_hash      TEXT NOT NULL UNIQUE,
+    scopes        TEXT[] NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at  TIMESTAMP,
+    expires_at    TIMESTAMP, -- Set on rotation, when the old key gets a grace period
+    revoked_at    TIMESTAMP,
+    rotated_from  BIGINT REFERENCES api_keys (id)
+);
@@ -0,0 +1,52 @@
+-- Tenants (publishers). Every ad, click, rollup and API key belongs to one;
+-- existing rows are assigned to the 'default' tenant.
+BEGIN;
+
+CREATE TABLE tenants (
+    id                   VARCHAR(36) PRIMARY KEY,
+    name                 TEXT NOT NULL,
+    requests_per_minute  INT NOT NULL DEFAULT 0,    -- API requests, 0 for unlimited
+    clicks_per_day       BIGINT NOT NULL DEFAULT 0, -- Recorded clicks per UTC day, 0 for unlimited
+    created_at           TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO tenants (id, name) VALUES ('default', 'Default');
+
+-- Ads: ad IDs are only unique within a tenant
+ALTER TABLE ads ADD COLUMN tenant_id VARCHAR(36) NOT NULL DEFAULT 'default' REFERENCES tenants (id);
+ALTER TABLE ads DROP CONSTRAINT ads_pkey;
+ALTER TABLE ads ADD PRIMARY KEY (tenant_id, id);
+
+-- Clicks
+ALTER TABLE clicks ADD COLUMN tenant_id VARCHAR(36) NOT NULL DEFAULT 'default';
+DROP INDEX idx_clicks_ad_id_timestamp;
+DROP INDEX idx_clicks_ip_timestamp;
+CREATE INDEX idx_clicks_tenant_ad_id_timestamp ON clicks (tenant_id, ad_id, timestamp);
+CREATE INDEX idx_clicks_tenant_ip_timestamp ON clicks (tenant_id, ip, timestamp);
+
+-- Rollups and window counts
+ALTER TABLE click_rollups_hourly ADD COLUMN tenant_id VARCHAR(36) NOT NULL DEFAULT 'default';
+ALTER TABLE click_rollups_hourly DROP CONSTRAINT click_rollups_hourly_pkey;
+ALTER TABLE click_rollups_hourly ADD PRIMARY KEY (tenant_id, ad_id, bucket);
+
+ALTER TABLE click_rollups_daily ADD COLUMN tenant_id VARCHAR(36) NOT NULL DEFAULT 'default';
+ALTER TABLE click_rollups_daily DROP CONSTRAINT click_rollups_daily_pkey;
+ALTER TABLE click_rollups_daily ADD PRIMARY KEY (tenant_id, ad_id, bucket);
+
+ALTER TABLE click_window_counts ADD COLUMN tenant_id VARCHAR(36) NOT NULL DEFAULT 'default';
+ALTER TABLE click_window_counts DROP CONSTRAINT click_window_counts_pkey;
+ALTER TABLE click_window_counts ADD PRIMARY KEY (tenant_id, ad_id, window_start);
+
+-- API keys
+ALTER TABLE api_keys ADD COLUMN tenant_id VARCHAR(36) NOT NULL DEFAULT 'default' REFERENCES tenants (id);
+CREATE INDEX idx_api_keys_tenant_id ON api_keys (tenant_id);
+
+-- From now on every write must name its tenant
+ALTER TABLE ads ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE clicks ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE click_rollups_hourly ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE click_rollups_daily ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE click_window_counts ALTER COLUMN tenant_id DROP DEFAULT;
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
+
+COMMIT;
@@ -0,0 +1,33 @@
+-- Audit log of every change made through the admin API and the admin
+-- commands. Rows can only be inserted: updates and deletes are rejected.
+BEGIN;
+
+CREATE TABLE audit_events (
+    id           BIGSERIAL PRIMARY KEY,
+    tenant_id    VARCHAR(36) NOT NULL,
+    occurred_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    actor        TEXT NOT NULL,  -- api_key:<id>, user:<subject>, cli:<user> or job:<name>
+    action       TEXT NOT NULL,  -- e.g. api_key.revoke
+    entity_type  TEXT NOT NULL,
+    entity_id    TEXT NOT NULL,
+    before       JSONB,          -- Changed fields before the change, NULL for creations
+    after        JSONB,          -- Changed fields after the change
+    request_id   TEXT NOT NULL DEFAULT '',
+    source_ip    TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_audit_events_entity ON audit_events (tenant_id, entity_type, entity_id, occurred_at);
+CREATE INDEX idx_audit_events_actor ON audit_events (tenant_id, actor, occurred_at);
+CREATE INDEX idx_audit_events_occurred_at ON audit_events (tenant_id, occurred_at);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+COMMIT;
@@ -0,0 +1,3 @@
+-- Message headers recorded with outbox events, such as the W3C trace context
+-- of the request that wrote them, so the published message continues its trace.
+ALTER TABLE outbox ADD COLUMN headers JSONB NOT NULL DEFAULT '{}';
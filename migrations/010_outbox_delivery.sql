@@ -0,0 +1,25 @@
+-- Outbox delivery bookkeeping:
+--  * txid is the ID of the transaction that wrote the row. The relay only
+--    takes rows of transactions older than every running one, in txid order,
+--    so a transaction that commits late can never slip in behind rows that
+--    were already published, as it could when ordering by id alone.
+--  * attempts and last_error count failed publishes; rows that keep failing
+--    are dead-lettered rather than blocking every row behind them.
+--  * Timestamps become TIMESTAMPTZ so that the outbox lag does not depend on
+--    the session time zone. Existing values are read in the session time
+--    zone, which is the one NOW() wrote them in.
+BEGIN;
+
+ALTER TABLE outbox
+    ADD COLUMN txid             xid8 NOT NULL DEFAULT pg_current_xact_id(),
+    ADD COLUMN attempts         INT NOT NULL DEFAULT 0,
+    ADD COLUMN last_error       TEXT,
+    ADD COLUMN dead_lettered_at TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN sent_at TYPE TIMESTAMPTZ;
+
+DROP INDEX idx_outbox_pending;
+CREATE INDEX idx_outbox_pending ON outbox (txid, id) WHERE sent_at IS NULL AND dead_lettered_at IS NULL;
+CREATE INDEX idx_outbox_dead_lettered ON outbox (dead_lettered_at) WHERE dead_lettered_at IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- API key, tenant and audit timestamps become TIMESTAMPTZ, as the outbox's did
+-- in 010, so that expiry checks and audit queries do not depend on the session
+-- time zone. Every value was written by NOW(), so existing values are read in
+-- the session time zone, which is the one NOW() wrote them in.
+--
+-- The ads:write scope is dropped: no route ever checked it.
+BEGIN;
+
+ALTER TABLE api_keys
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN last_used_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN revoked_at TYPE TIMESTAMPTZ;
+
+UPDATE api_keys SET scopes = array_remove(scopes, 'ads:write') WHERE 'ads:write' = ANY (scopes);
+
+ALTER TABLE tenants ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE audit_events ALTER COLUMN occurred_at TYPE TIMESTAMPTZ;
+
+COMMIT;